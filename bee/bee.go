@@ -65,6 +65,10 @@ type HandlerBuilder struct {
 	// digest. This is useful for filtering out dynamic content such as CSRF tokens. If nil then the entire response body
 	// is used.
 	ETagDigestFilter *regexp.Regexp
+
+	// SkipBodyParams prevents the request body from being parsed into params. Only route and query parameters are
+	// included. The handler is responsible for reading the body.
+	SkipBodyParams bool
 }
 
 // New returns a new http.Handler that calls fn. If fn returns an error then the error is passed to the ErrorHandlers.
@@ -81,7 +85,7 @@ func (hb *HandlerBuilder) New(fn func(ctx context.Context, w http.ResponseWriter
 			b: b,
 		}
 
-		params, err := parseParams(r)
+		params, err := parseParams(r, !hb.SkipBodyParams)
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
@@ -144,7 +148,7 @@ func (hb *HandlerBuilder) New(fn func(ctx context.Context, w http.ResponseWriter
 	})
 }
 
-func parseParams(r *http.Request) (map[string]any, error) {
+func parseParams(r *http.Request, parseBody bool) (map[string]any, error) {
 	params := make(map[string]any)
 
 	routeParams := chi.RouteContext(r.Context()).URLParams
@@ -166,6 +170,10 @@ func parseParams(r *http.Request) (map[string]any, error) {
 
 	addValuesToParams(r.URL.Query())
 
+	if !parseBody {
+		return params, nil
+	}
+
 	contentType := r.Header.Get("Content-Type")
 	switch {
 	case contentType == "application/json":
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/spf13/cobra"
+)
+
+var exportUserCmd = &cobra.Command{
+	Use:   "export-user USERNAME",
+	Short: "Export a user's account as a JSON backup",
+	Long: `Export a user's account as a JSON backup.
+
+Unlike the backup users can download themselves, the backup includes the password
+digest so the account can be recreated on another server with import-user.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		conn, err := connectDB(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+
+		user, err := data.GetUserMinByUsername(ctx, conn, args[0])
+		if err != nil {
+			return err
+		}
+
+		err = setCurrentUser(ctx, conn, user.ID)
+		if err != nil {
+			return err
+		}
+
+		backup, err := data.ExportAccount(ctx, conn, user.ID, true)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(backup)
+	},
+}
+
+var importUserCmd = &cobra.Command{
+	Use:   "import-user FILE",
+	Short: "Import a user's account from a JSON backup",
+	Long: `Import a user's account from a JSON backup.
+
+The user is created if it does not exist. This requires a backup made by
+export-user. If the user already exists all of their books, tags, import
+profiles, and reading goals are replaced by the backup when --replace is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		backup, err := data.ReadAccountBackup(f)
+		if err != nil {
+			return err
+		}
+
+		if username, _ := cmd.Flags().GetString("username"); username != "" {
+			backup.User.Username = username
+		}
+		replace, _ := cmd.Flags().GetBool("replace")
+
+		conn, err := connectDB(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		var created bool
+		user, err := data.GetUserMinByUsername(ctx, tx, backup.User.Username)
+		if err != nil {
+			var nfErr *data.NotFoundError
+			if !errors.As(err, &nfErr) {
+				return err
+			}
+
+			user, err = data.CreateUserFromAccountBackup(ctx, tx, backup)
+			if err != nil {
+				return validationErrorsToError(err)
+			}
+			created = true
+		} else if !replace {
+			return fmt.Errorf("user %s already exists: use --replace to replace their data with the backup", user.Username)
+		}
+
+		err = setCurrentUser(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if created {
+			err = data.RestoreRecoveryCodes(ctx, tx, user.ID, backup)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = data.RestoreAccount(ctx, tx, user.ID, backup, data.Today(time.Now(), user.Location()))
+		if err != nil {
+			return validationErrorsToError(err)
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Imported %d books for %s\n", len(backup.Books), user.Username)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportUserCmd)
+	exportUserCmd.Flags().StringP("database-url", "d", "", "Database URL or DSN (env: DATABASE_URL)")
+	exportUserCmd.Flags().StringP("output", "o", "", "Write the backup to this file instead of stdout")
+
+	rootCmd.AddCommand(importUserCmd)
+	importUserCmd.Flags().StringP("database-url", "d", "", "Database URL or DSN (env: DATABASE_URL)")
+	importUserCmd.Flags().String("username", "", "Import as this username instead of the one in the backup")
+	importUserCmd.Flags().Bool("replace", false, "Replace the data of an existing user")
+}
+
+// connectDB connects to the database given by the database-url flag or the DATABASE_URL environment variable.
+func connectDB(ctx context.Context, cmd *cobra.Command) (*pgx.Conn, error) {
+	databaseURL, _ := cmd.Flags().GetString("database-url")
+	if !cmd.Flags().Changed("database-url") {
+		if envValue, ok := os.LookupEnv("DATABASE_URL"); ok {
+			databaseURL = envValue
+		}
+	}
+
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return conn, nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// setCurrentUser sets the user for row-level security in the same manner as the web server does for each request.
+func setCurrentUser(ctx context.Context, db execer, userID int64) error {
+	_, err := db.Exec(ctx, "select set_config('booklog.user_id', $1, false)", strconv.FormatInt(userID, 10))
+	return err
+}
+
+// validationErrorsToError converts a validation error tree into an error listing every validation error.
+func validationErrorsToError(err error) error {
+	var verr *errortree.Node
+	if errors.As(err, &verr) {
+		return fmt.Errorf("invalid backup:\n  %s", strings.Join(view.ValidationErrorMessages(verr), "\n  "))
+	}
+	return err
+}
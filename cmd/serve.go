@@ -9,7 +9,9 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/jackc/booklog/mail"
 	"github.com/jackc/booklog/server"
 	"github.com/jackc/booklog/view"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -127,14 +129,54 @@ var serveCmd = &cobra.Command{
 
 		htr := view.NewHTMLTemplateRenderer(getString("html-template-path", "HTML_TEMPLATE_PATH"), assetMap, reloadHTMLTemplates)
 
+		listenAddress := fmt.Sprintf("%s:%d", getString("bind-address", "BIND_ADDRESS"), getInt("port", "PORT"))
+
+		// Links in mail are never built from request headers because they can be forged to send a password reset link to
+		// another site.
+		baseURL := strings.TrimSuffix(getString("base-url", "BASE_URL"), "/")
+		smtpAddr := getString("smtp-addr", "SMTP_ADDR")
+		if baseURL == "" {
+			if smtpAddr != "" {
+				fmt.Fprintln(os.Stderr, "base-url must be set when smtp-addr is set")
+				os.Exit(1)
+			}
+			if devMode {
+				baseURL = "http://" + listenAddress
+			}
+		}
+
+		var mailer mail.Mailer
+		mailFrom := getString("mail-from", "MAIL_FROM")
+		if smtpAddr != "" {
+			mailer = &mail.SMTPMailer{
+				Addr:     smtpAddr,
+				Username: getString("smtp-username", "SMTP_USERNAME"),
+				Password: getString("smtp-password", "SMTP_PASSWORD"),
+				From:     mailFrom,
+			}
+		} else {
+			mailDir := getString("mail-dir", "MAIL_DIR")
+			if mailDir == "" && devMode {
+				mailDir = filepath.Join("tmp", "mail")
+			}
+			if mailDir == "" {
+				fmt.Fprintln(os.Stderr, "smtp-addr not set. Mail will not be sent.")
+			} else {
+				fmt.Fprintf(os.Stderr, "smtp-addr not set. Writing mail to %s instead of sending it.\n", mailDir)
+			}
+			mailer = &mail.LocalMailer{Dir: mailDir, From: mailFrom}
+		}
+
 		server, err := server.NewAppServer(
-			fmt.Sprintf("%s:%d", getString("bind-address", "BIND_ADDRESS"), getInt("port", "PORT")),
+			listenAddress,
 			csrfKey,
 			secureCookies,
 			cookieHashKey,
 			cookieBlockKey,
 			dbpool,
 			htr,
+			mailer,
+			baseURL,
 			devMode,
 		)
 		if err != nil {
@@ -164,4 +206,10 @@ func init() {
 	serveCmd.Flags().Bool("reload-html-templates", false, "Reload HTML templates (env: RELOAD_HTML_TEMPLATES)")
 	serveCmd.Flags().Bool("dev", false, "Development mode (env: DEV)")
 	serveCmd.Flags().String("frontend-path", "", "Read manifest.json from here (env: FRONTEND_PATH)")
+	serveCmd.Flags().String("base-url", "", "Scheme and host used in links in mail, e.g. https://booklog.example.com. Required with smtp-addr (env: BASE_URL)")
+	serveCmd.Flags().String("smtp-addr", "", "SMTP server host:port. Mail is not sent if empty (env: SMTP_ADDR)")
+	serveCmd.Flags().String("smtp-username", "", "SMTP username (env: SMTP_USERNAME)")
+	serveCmd.Flags().String("smtp-password", "", "SMTP password (env: SMTP_PASSWORD)")
+	serveCmd.Flags().String("mail-from", "booklog@localhost", "From address of mail (env: MAIL_FROM)")
+	serveCmd.Flags().String("mail-dir", "", "Write mail to this directory when smtp-addr is not set. Defaults to tmp/mail in development mode (env: MAIL_DIR)")
 }
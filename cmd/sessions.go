@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/booklog/data"
+	"github.com/spf13/cobra"
+)
+
+var purgeSessionsCmd = &cobra.Command{
+	Use:   "purge-sessions",
+	Short: "Delete expired user sessions",
+	Long: `Delete expired user sessions.
+
+Expired sessions are never used again but their rows are kept until they are
+purged. Run this periodically, for example daily from cron.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		conn, err := connectDB(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+
+		n, err := data.PurgeExpiredUserSessions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Deleted %d expired sessions\n", n)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(purgeSessionsCmd)
+	purgeSessionsCmd.Flags().StringP("database-url", "d", "", "Database URL or DSN (env: DATABASE_URL)")
+}
@@ -0,0 +1,451 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype/zeronull"
+	"github.com/jackc/pgxutil"
+)
+
+// AccountBackupVersion is the version of the AccountBackup document written by ExportAccount. It must be incremented
+// whenever a change would prevent an older version of booklog from restoring the document correctly. RestoreAccount
+// must continue to accept every earlier version.
+//
+// Version 2 added reading goals. Version 3 added private books and user visibility. Version 4 added followed users.
+// Version 5 added display preferences. Version 6 added email. Version 7 added two-factor authentication to operator
+// backups.
+const AccountBackupVersion = 7
+
+const accountBackupDateLayout = "2006-01-02"
+
+// AccountBackup is a JSON document containing all data owned by a user.
+type AccountBackup struct {
+	Version        int                          `json:"version"`
+	ExportTime     time.Time                    `json:"exportTime"`
+	User           AccountBackupUser            `json:"user"`
+	Books          []AccountBackupBook          `json:"books"`
+	ImportProfiles []AccountBackupImportProfile `json:"importProfiles"`
+	ReadingGoals   []AccountBackupReadingGoal   `json:"readingGoals"`
+	Following      []string                     `json:"following"` // Usernames of followed users.
+}
+
+type AccountBackupUser struct {
+	Username string `json:"username"`
+
+	// PasswordDigest, TOTPSecret, and RecoveryCodeDigests are only included in backups made by an operator so the
+	// account can be recreated on another instance. TOTPSecret is base32 encoded. RecoveryCodeDigests are hex encoded.
+	PasswordDigest      string    `json:"passwordDigest,omitempty"`
+	TOTPSecret          string    `json:"totpSecret,omitempty"`
+	RecoveryCodeDigests []string  `json:"recoveryCodeDigests,omitempty"`
+	Email               string    `json:"email,omitempty"`
+	TimeZone            string    `json:"timeZone,omitempty"`
+	Visibility          string    `json:"visibility,omitempty"`
+	DefaultBookSort     string    `json:"defaultBookSort,omitempty"`
+	BooksPerPage        int32     `json:"booksPerPage,omitempty"`
+	InsertTime          time.Time `json:"insertTime"`
+}
+
+type AccountBackupBook struct {
+	Title      string    `json:"title"`
+	Author     string    `json:"author"`
+	Status     string    `json:"status"`
+	StartDate  string    `json:"startDate,omitempty"`
+	FinishDate string    `json:"finishDate,omitempty"`
+	Format     string    `json:"format"`
+	Location   string    `json:"location,omitempty"`
+	Rating     float64   `json:"rating,omitempty"`
+	Review     string    `json:"review,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	ISBN       string    `json:"isbn,omitempty"`
+	PageCount  int32     `json:"pageCount,omitempty"`
+	Private    bool      `json:"private,omitempty"`
+	InsertTime time.Time `json:"insertTime"`
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+type AccountBackupImportProfile struct {
+	Name    string        `json:"name"`
+	Mapping ImportMapping `json:"mapping"`
+}
+
+type AccountBackupReadingGoal struct {
+	Year   int32  `json:"year"`
+	Format string `json:"format,omitempty"`
+	Target int32  `json:"target"`
+}
+
+// ExportAccount returns a backup of all data owned by userID. The password digest and two-factor authentication secrets
+// are only included if includePasswordDigest is true.
+func ExportAccount(ctx context.Context, db dbconn, userID int64, includePasswordDigest bool) (*AccountBackup, error) {
+	backup := &AccountBackup{
+		Version:        AccountBackupVersion,
+		ExportTime:     time.Now().UTC(),
+		Books:          []AccountBackupBook{},
+		ImportProfiles: []AccountBackupImportProfile{},
+		ReadingGoals:   []AccountBackupReadingGoal{},
+		Following:      []string{},
+	}
+
+	err := db.QueryRow(ctx, "select username, password_digest, email, time_zone, visibility, default_book_sort, books_per_page, insert_time from users where id=$1", userID).Scan(
+		&backup.User.Username, &backup.User.PasswordDigest, (*zeronull.Text)(&backup.User.Email), &backup.User.TimeZone, &backup.User.Visibility,
+		&backup.User.DefaultBookSort, &backup.User.BooksPerPage, &backup.User.InsertTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if includePasswordDigest {
+		var totpSecret []byte
+		err = db.QueryRow(ctx, "select totp_secret from users where id=$1", userID).Scan(&totpSecret)
+		if err != nil {
+			return nil, err
+		}
+		if totpSecret != nil {
+			backup.User.TOTPSecret = totp.EncodeSecret(totpSecret)
+		}
+
+		digests, err := pgxutil.Select(
+			ctx,
+			db,
+			"select code_digest from user_recovery_codes where user_id=$1 order by code_digest",
+			[]any{userID},
+			pgx.RowTo[[]byte],
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, digest := range digests {
+			backup.User.RecoveryCodeDigests = append(backup.User.RecoveryCodeDigests, hex.EncodeToString(digest))
+		}
+	} else {
+		backup.User.PasswordDigest = ""
+	}
+
+	err = ForEachBook(ctx, db, userID, func(book *Book) error {
+		backup.Books = append(backup.Books, newAccountBackupBook(book))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := GetImportProfiles(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		backup.ImportProfiles = append(backup.ImportProfiles, AccountBackupImportProfile{Name: p.Name, Mapping: p.Mapping})
+	}
+
+	goals, err := pgxutil.Select(
+		ctx,
+		db,
+		"select year, coalesce(format, ''), target from reading_goals where user_id=$1 order by year, format nulls first",
+		[]any{userID},
+		pgx.RowToStructByPos[AccountBackupReadingGoal],
+	)
+	if err != nil {
+		return nil, err
+	}
+	backup.ReadingGoals = append(backup.ReadingGoals, goals...)
+
+	followedUsers, err := GetFollowedUsers(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range followedUsers {
+		backup.Following = append(backup.Following, u.Username)
+	}
+
+	return backup, nil
+}
+
+func newAccountBackupBook(book *Book) AccountBackupBook {
+	bb := AccountBackupBook{
+		Title:      book.Title,
+		Author:     book.Author,
+		Status:     book.Status,
+		Format:     book.Format,
+		Location:   book.Location,
+		Rating:     book.Rating,
+		Review:     book.Review,
+		Tags:       book.Tags,
+		ISBN:       book.ISBN,
+		PageCount:  book.PageCount,
+		Private:    book.Private,
+		InsertTime: book.InsertTime.UTC(),
+		UpdateTime: book.UpdateTime.UTC(),
+	}
+	if !book.StartDate.IsZero() {
+		bb.StartDate = book.StartDate.Format(accountBackupDateLayout)
+	}
+	if !book.FinishDate.IsZero() {
+		bb.FinishDate = book.FinishDate.Format(accountBackupDateLayout)
+	}
+
+	return bb
+}
+
+// ReadAccountBackup decodes an AccountBackup from r. It returns an error if r does not contain a backup or the backup
+// was made by a newer version of booklog.
+func ReadAccountBackup(r io.Reader) (*AccountBackup, error) {
+	var backup AccountBackup
+	err := json.NewDecoder(r).Decode(&backup)
+	if err != nil {
+		return nil, fmt.Errorf("not a booklog backup: %w", err)
+	}
+
+	if backup.Version < 1 {
+		return nil, errors.New("not a booklog backup: missing version")
+	}
+	if backup.Version > AccountBackupVersion {
+		return nil, fmt.Errorf("backup version %d is newer than the supported version %d", backup.Version, AccountBackupVersion)
+	}
+
+	return &backup, nil
+}
+
+// CreateUserFromAccountBackup creates the user in backup. The backup must include the password digest. Two-factor
+// authentication is enabled if the backup includes a TOTP secret. The recovery codes must be restored separately with
+// RestoreRecoveryCodes.
+func CreateUserFromAccountBackup(ctx context.Context, db dbconn, backup *AccountBackup) (*UserMin, error) {
+	v := validate.New()
+	v.Presence("username", backup.User.Username)
+	v.Presence("passwordDigest", backup.User.PasswordDigest)
+	var totpSecret []byte
+	if backup.User.TOTPSecret != "" {
+		var err error
+		totpSecret, err = totp.DecodeSecret(backup.User.TOTPSecret)
+		if err != nil {
+			v.Add("totpSecret", errors.New("is not a valid secret key"))
+		}
+	}
+	for _, digest := range backup.User.RecoveryCodeDigests {
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			v.Add("recoveryCodeDigests", errors.New("contains an invalid digest"))
+			break
+		}
+	}
+	if backup.User.Email != "" && !IsEmail(backup.User.Email) {
+		v.Add("email", errors.New("is not an email address"))
+	}
+	if backup.User.TimeZone != "" && !IsTimeZone(backup.User.TimeZone) {
+		v.Add("timeZone", errors.New("is not a known time zone"))
+	}
+	if backup.User.Visibility != "" && !slices.Contains(UserVisibilities, backup.User.Visibility) {
+		v.Add("visibility", errors.New(`must be "private", "unlisted", or "public"`))
+	}
+	if backup.User.DefaultBookSort != "" && !slices.Contains(BookSorts, backup.User.DefaultBookSort) {
+		v.Add("defaultBookSort", errors.New("is not a valid sort"))
+	}
+	if backup.User.BooksPerPage != 0 && !slices.Contains(BooksPerPageOptions, backup.User.BooksPerPage) {
+		v.Add("booksPerPage", errors.New("must be 25, 50, 100, or 200"))
+	}
+	if v.Err() != nil {
+		return nil, v.Err()
+	}
+
+	var insertTime *time.Time
+	if !backup.User.InsertTime.IsZero() {
+		insertTime = &backup.User.InsertTime
+	}
+
+	var timeZone *string
+	if backup.User.TimeZone != "" {
+		timeZone = &backup.User.TimeZone
+	}
+
+	var visibility *string
+	if backup.User.Visibility != "" {
+		visibility = &backup.User.Visibility
+	}
+
+	var defaultBookSort *string
+	if backup.User.DefaultBookSort != "" {
+		defaultBookSort = &backup.User.DefaultBookSort
+	}
+
+	var booksPerPage *int32
+	if backup.User.BooksPerPage != 0 {
+		booksPerPage = &backup.User.BooksPerPage
+	}
+
+	user := &UserMin{Username: backup.User.Username}
+	err := db.QueryRow(ctx,
+		`insert into users(username, password_digest, totp_secret, email, time_zone, visibility, default_book_sort, books_per_page, insert_time)
+values($1, $2, $3, $4, coalesce($5, 'UTC'), coalesce($6, 'private'), coalesce($7, 'finish_date'), coalesce($8, 100), coalesce($9, now()))
+returning id, time_zone, visibility`,
+		backup.User.Username, backup.User.PasswordDigest, totpSecret, zeronull.Text(backup.User.Email), timeZone, visibility, defaultBookSort, booksPerPage, insertTime,
+	).Scan(&user.ID, &user.TimeZone, &user.Visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RestoreRecoveryCodes replaces the recovery codes of userID with those in backup. It is only used after
+// CreateUserFromAccountBackup because users cannot restore their own credentials. It must be called with userID as the
+// current user because of row-level security.
+func RestoreRecoveryCodes(ctx context.Context, db dbconn, userID int64, backup *AccountBackup) error {
+	_, err := db.Exec(ctx, "delete from user_recovery_codes where user_id=$1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range backup.User.RecoveryCodeDigests {
+		digest, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(ctx, "insert into user_recovery_codes(user_id, code_digest) values($1, $2)", userID, digest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreAccount replaces all books, import profiles, reading goals, and follows owned by userID with the contents of
+// backup. The user's username, password, email, time zone, visibility, and display preferences are not changed.
+// Followed users that no longer exist or whose books are private are skipped. Nothing is changed if any part of backup is
+// invalid. today is the current date of the user as returned by Today.
+func RestoreAccount(ctx context.Context, db dbconn, userID int64, backup *AccountBackup, today time.Time) error {
+	verr := &errortree.Node{}
+	books := make([]Book, len(backup.Books))
+	for i, bb := range backup.Books {
+		book, err := bb.book(userID)
+		if err == nil {
+			book.Normalize()
+			if bverr := book.Validate(today); bverr != nil {
+				err = bverr
+			}
+		}
+		if err != nil {
+			verr.Add([]any{"books", i}, err)
+		}
+		books[i] = book
+	}
+
+	for i, bp := range backup.ImportProfiles {
+		if strings.TrimSpace(bp.Name) == "" {
+			verr.Add([]any{"importProfiles", i, "name"}, errors.New("cannot be blank"))
+		}
+		if pverr := bp.Mapping.Validate(); pverr != nil {
+			verr.Add([]any{"importProfiles", i, "mapping"}, pverr)
+		}
+	}
+
+	goals := make([]ReadingGoal, len(backup.ReadingGoals))
+	for i, bg := range backup.ReadingGoals {
+		goals[i] = ReadingGoal{UserID: userID, Year: bg.Year, Format: bg.Format, Target: bg.Target}
+		if gverr := goals[i].Validate(); gverr != nil {
+			verr.Add([]any{"readingGoals", i}, gverr)
+		}
+	}
+
+	if len(verr.AllErrors()) > 0 {
+		return verr
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, sql := range []string{
+		"delete from books where user_id=$1",
+		"delete from tags where user_id=$1",
+		"delete from import_profiles where user_id=$1",
+		"delete from reading_goals where user_id=$1",
+		"delete from follows where follower_id=$1",
+	} {
+		_, err := tx.Exec(ctx, sql, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, book := range books {
+		_, err := CreateBook(ctx, tx, book, today)
+		if err != nil {
+			return fmt.Errorf("books[%d]: %w", i, err)
+		}
+	}
+
+	for i, bp := range backup.ImportProfiles {
+		_, err := SaveImportProfile(ctx, tx, userID, bp.Name, bp.Mapping)
+		if err != nil {
+			return fmt.Errorf("importProfiles[%d]: %w", i, err)
+		}
+	}
+
+	for i, goal := range goals {
+		_, err := SaveReadingGoal(ctx, tx, goal)
+		if err != nil {
+			return fmt.Errorf("readingGoals[%d]: %w", i, err)
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`insert into follows(follower_id, followee_id)
+select $1, id from users where username=any($2) and id<>$1 and visibility in ('unlisted', 'public')
+on conflict (follower_id, followee_id) do nothing`,
+		userID, backup.Following,
+	)
+	if err != nil {
+		return fmt.Errorf("following: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (bb AccountBackupBook) book(userID int64) (Book, error) {
+	book := Book{
+		UserID:     userID,
+		Title:      bb.Title,
+		Author:     bb.Author,
+		Status:     bb.Status,
+		Format:     bb.Format,
+		Location:   bb.Location,
+		Rating:     bb.Rating,
+		Review:     bb.Review,
+		Tags:       bb.Tags,
+		ISBN:       bb.ISBN,
+		PageCount:  bb.PageCount,
+		Private:    bb.Private,
+		InsertTime: bb.InsertTime,
+		UpdateTime: bb.UpdateTime,
+	}
+
+	v := validate.New()
+	var err error
+	if bb.StartDate != "" {
+		book.StartDate, err = time.Parse(accountBackupDateLayout, bb.StartDate)
+		if err != nil {
+			v.Add("startDate", errors.New("must be in YYYY-MM-DD format"))
+		}
+	}
+	if bb.FinishDate != "" {
+		book.FinishDate, err = time.Parse(accountBackupDateLayout, bb.FinishDate)
+		if err != nil {
+			v.Add("finishDate", errors.New("must be in YYYY-MM-DD format"))
+		}
+	}
+
+	return book, v.Err()
+}
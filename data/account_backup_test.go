@@ -0,0 +1,173 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAccountBackup(t *testing.T) {
+	t.Parallel()
+
+	backup, err := data.ReadAccountBackup(strings.NewReader(`{"version": 1, "user": {"username": "test"}, "books": [{"title": "Emma"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, "test", backup.User.Username)
+	require.Len(t, backup.Books, 1)
+
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{`title,author`, "not a booklog backup"},
+		{`{"books": []}`, "not a booklog backup: missing version"},
+		{`{"version": 8}`, "backup version 8 is newer than the supported version 7"},
+	} {
+		_, err := data.ReadAccountBackup(strings.NewReader(tt.src))
+		require.ErrorContains(t, err, tt.err)
+	}
+}
+
+func TestExportAndRestoreAccount(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'digest') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	_, err = data.CreateBook(ctx, tx, data.Book{
+		UserID:     userID,
+		Title:      "Napoleon",
+		Author:     "Adam Zamoyski",
+		Status:     data.BookStatusFinished,
+		StartDate:  time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC),
+		FinishDate: time.Date(2019, 6, 17, 0, 0, 0, 0, time.UTC),
+		Format:     "audio",
+		Rating:     4.5,
+		Tags:       []string{"history"},
+		PageCount:  768,
+		Private:    true,
+		InsertTime: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		UpdateTime: time.Date(2019, 6, 18, 12, 0, 0, 0, time.UTC),
+	}, time.Now())
+	require.NoError(t, err)
+
+	mapping := data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author"}, DefaultFormat: "text"}
+	_, err = data.SaveImportProfile(ctx, tx, userID, "Library", mapping)
+	require.NoError(t, err)
+
+	_, err = data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2019, Format: "audio", Target: 12})
+	require.NoError(t, err)
+
+	err = data.SetUserPreferences(ctx, tx, userID, data.UserPreferences{DefaultBookSort: data.BookSortTitle, BooksPerPage: 25})
+	require.NoError(t, err)
+	err = data.SetUserEmail(ctx, tx, userID, "test@example.com")
+	require.NoError(t, err)
+	totpSecret, err := totp.NewSecret()
+	require.NoError(t, err)
+	_, err = data.EnableUserTOTP(ctx, tx, userID, totp.EncodeSecret(totpSecret), totp.Code(totpSecret, time.Now()), time.Now())
+	require.NoError(t, err)
+
+	var friendID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values('friend', 'x', 'public') returning id").Scan(&friendID)
+	require.NoError(t, err)
+	err = data.Follow(ctx, tx, userID, friendID)
+	require.NoError(t, err)
+
+	backup, err := data.ExportAccount(ctx, tx, userID, false)
+	require.NoError(t, err)
+	require.Equal(t, data.AccountBackupVersion, backup.Version)
+	require.Equal(t, "test", backup.User.Username)
+	require.Empty(t, backup.User.PasswordDigest)
+	require.Empty(t, backup.User.TOTPSecret)
+	require.Empty(t, backup.User.RecoveryCodeDigests)
+	require.Equal(t, data.BookSortTitle, backup.User.DefaultBookSort)
+	require.EqualValues(t, 25, backup.User.BooksPerPage)
+	require.Equal(t, "test@example.com", backup.User.Email)
+	require.Equal(t, []data.AccountBackupBook{{
+		Title:      "Napoleon",
+		Author:     "Adam Zamoyski",
+		Status:     data.BookStatusFinished,
+		StartDate:  "2019-06-01",
+		FinishDate: "2019-06-17",
+		Format:     "audio",
+		Rating:     4.5,
+		Tags:       []string{"history"},
+		PageCount:  768,
+		Private:    true,
+		InsertTime: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		UpdateTime: time.Date(2019, 6, 18, 12, 0, 0, 0, time.UTC),
+	}}, backup.Books)
+	require.Equal(t, []data.AccountBackupImportProfile{{Name: "Library", Mapping: mapping}}, backup.ImportProfiles)
+	require.Equal(t, []data.AccountBackupReadingGoal{{Year: 2019, Format: "audio", Target: 12}}, backup.ReadingGoals)
+	require.Equal(t, []string{"friend"}, backup.Following)
+
+	backup, err = data.ExportAccount(ctx, tx, userID, true)
+	require.NoError(t, err)
+	require.Equal(t, "digest", backup.User.PasswordDigest)
+	require.Equal(t, totp.EncodeSecret(totpSecret), backup.User.TOTPSecret)
+	require.Len(t, backup.User.RecoveryCodeDigests, data.RecoveryCodeCount)
+
+	// Restoring into a new user recreates the account.
+	backup.User.Username = "copy"
+	backup.User.Email = "copy@example.com"
+	copyUser, err := data.CreateUserFromAccountBackup(ctx, tx, backup)
+	require.NoError(t, err)
+	err = data.RestoreRecoveryCodes(ctx, tx, copyUser.ID, backup)
+	require.NoError(t, err)
+	err = data.RestoreAccount(ctx, tx, copyUser.ID, backup, time.Now())
+	require.NoError(t, err)
+
+	copied, err := data.ExportAccount(ctx, tx, copyUser.ID, true)
+	require.NoError(t, err)
+	require.Equal(t, backup.User, copied.User)
+	require.Equal(t, backup.Books, copied.Books)
+	require.Equal(t, backup.ImportProfiles, copied.ImportProfiles)
+	require.Equal(t, backup.ReadingGoals, copied.ReadingGoals)
+	require.Equal(t, backup.Following, copied.Following)
+
+	// Invalid backups change nothing.
+	invalid := *backup
+	invalid.Books = append([]data.AccountBackupBook{
+		{Title: "Emma", Author: "Jane Austen", Format: "text", FinishDate: "yesterday"},
+		{Title: "Emma", Format: "text", FinishDate: "2020-01-01"},
+	}, backup.Books...)
+	invalid.ImportProfiles = nil
+	err = data.RestoreAccount(ctx, tx, copyUser.ID, &invalid, time.Now())
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("books", 0, "finishDate"), 1)
+	require.Len(t, verr.Get("books", 1, "author"), 1)
+	require.Len(t, verr.AllErrors(), 2)
+
+	copied, err = data.ExportAccount(ctx, tx, copyUser.ID, true)
+	require.NoError(t, err)
+	require.Len(t, copied.ImportProfiles, 1)
+
+	// Restoring replaces existing data.
+	backup.Books = backup.Books[:0]
+	err = data.RestoreAccount(ctx, tx, copyUser.ID, backup, time.Now())
+	require.NoError(t, err)
+
+	copied, err = data.ExportAccount(ctx, tx, copyUser.ID, true)
+	require.NoError(t, err)
+	require.Empty(t, copied.Books)
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"slices"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,22 +18,221 @@ func BooksPerYear(ctx context.Context, db dbconn, userID int64) ([]BooksPerTimeI
 	return pgxutil.Select(
 		ctx,
 		db,
-		"select date_trunc('year', finish_date), count(*) from books where user_id=$1 group by 1 order by 1 desc",
+		"select date_trunc('year', finish_date::timestamp), count(*) from books where user_id=$1 and status='finished' group by 1 order by 1 desc",
 		[]any{userID},
 		pgx.RowToStructByPos[BooksPerTimeItem],
 	)
 }
 
-func BooksPerMonthForLastYear(ctx context.Context, db dbconn, userID int64) ([]BooksPerTimeItem, error) {
+// BooksPerMonthForLastYear returns the number of books finished by userID in each month from a year before today through
+// the month of today ordered by most recent month. today is the current date of the user as returned by Today.
+func BooksPerMonthForLastYear(ctx context.Context, db dbconn, userID int64, today time.Time) ([]BooksPerTimeItem, error) {
 	return pgxutil.Select(
 		ctx,
 		db,
 		`select months, count(books.id)
-from generate_series(date_trunc('month', now() - '1 year'::interval), date_trunc('month', now()), '1 month') as months
-	left join books on date_trunc('month', finish_date) = months and user_id=$1
+from generate_series(date_trunc('month', $2::date - '1 year'::interval), date_trunc('month', $2::date::timestamp), '1 month') as months
+	left join books on date_trunc('month', finish_date::timestamp) = months and user_id=$1 and status='finished'
 group by 1
 order by 1 desc`,
+		[]any{userID, today},
+		pgx.RowToStructByPos[BooksPerTimeItem],
+	)
+}
+
+type FormatCount struct {
+	Format string
+	Count  int32
+}
+
+// BooksPerFormat returns the number of finished books owned by userID in each format ordered by most books.
+func BooksPerFormat(ctx context.Context, db dbconn, userID int64) ([]FormatCount, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		"select format, count(*) from books where user_id=$1 and status='finished' group by 1 order by 2 desc, 1",
+		[]any{userID},
+		pgx.RowToStructByPos[FormatCount],
+	)
+}
+
+type AuthorCount struct {
+	Author string
+	Count  int32
+}
+
+// TopAuthors returns up to limit authors with the most finished books owned by userID. Authors are matched case
+// insensitively.
+func TopAuthors(ctx context.Context, db dbconn, userID int64, limit int) ([]AuthorCount, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		`select min(author), count(*)
+from books
+where user_id=$1 and status='finished'
+group by lower(author)
+order by 2 desc, 1
+limit $2`,
+		[]any{userID, limit},
+		pgx.RowToStructByPos[AuthorCount],
+	)
+}
+
+// AverageBooksPerMonth returns the average number of books finished per month by userID from the month of the first
+// finished book through the month of today. It returns 0 if no books have been finished.
+func AverageBooksPerMonth(ctx context.Context, db dbconn, userID int64, today time.Time) (float64, error) {
+	var count int32
+	var firstFinishDate *time.Time
+	err := db.QueryRow(ctx,
+		"select count(*), min(finish_date) from books where user_id=$1 and status='finished'",
+		userID,
+	).Scan(&count, &firstFinishDate)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	months := (today.Year()-firstFinishDate.Year())*12 + int(today.Month()-firstFinishDate.Month()) + 1
+	months = max(months, 1)
+
+	return float64(count) / float64(months), nil
+}
+
+// BusiestMonth returns the month in which userID finished the most books. Ties are broken by the most recent month. It
+// returns nil if no books have been finished.
+func BusiestMonth(ctx context.Context, db dbconn, userID int64) (*BooksPerTimeItem, error) {
+	items, err := pgxutil.Select(
+		ctx,
+		db,
+		`select date_trunc('month', finish_date::timestamp), count(*)
+from books
+where user_id=$1 and status='finished'
+group by 1
+order by 2 desc, 1 desc
+limit 1`,
 		[]any{userID},
 		pgx.RowToStructByPos[BooksPerTimeItem],
 	)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	return &items[0], nil
+}
+
+type YearOverYearItem struct {
+	Year          int
+	Count         int32 // Books finished in the year.
+	CountToDate   int32 // Books finished in the year on or before the month and day of today.
+	PreviousCount int32 // Books finished in the previous year.
+}
+
+// Change returns the difference in the number of books finished compared to the previous year.
+func (item YearOverYearItem) Change() int32 {
+	return item.Count - item.PreviousCount
+}
+
+// BooksYearOverYear returns the number of books finished by userID in every year from the year of the first finished
+// book through the year of today ordered by most recent year. CountToDate allows comparing the current year with the same
+// part of earlier years.
+func BooksYearOverYear(ctx context.Context, db dbconn, userID int64, today time.Time) ([]YearOverYearItem, error) {
+	items, err := pgxutil.Select(
+		ctx,
+		db,
+		`select years::int,
+	count(books.id)::int4,
+	(count(books.id) filter (where to_char(books.finish_date, 'MMDD') <= to_char($2::date, 'MMDD')))::int4,
+	0::int4
+from generate_series(
+		(select extract(year from min(finish_date))::int from books where user_id=$1 and status='finished'),
+		extract(year from $2::date)::int
+	) as years
+	left join books on extract(year from books.finish_date) = years and books.user_id=$1 and books.status='finished'
+group by 1
+order by 1 desc`,
+		[]any{userID, today},
+		pgx.RowToStructByPos[YearOverYearItem],
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items[:max(len(items)-1, 0)] {
+		items[i].PreviousCount = items[i+1].Count
+	}
+
+	return items, nil
+}
+
+// GetFinishDates returns the finish dates of all finished books owned by userID in ascending order.
+func GetFinishDates(ctx context.Context, db dbconn, userID int64) ([]time.Time, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		"select finish_date from books where user_id=$1 and status='finished' order by finish_date",
+		[]any{userID},
+		pgx.RowTo[time.Time],
+	)
+}
+
+// ReadingStreak is a run of consecutive months in each of which at least one book was finished.
+type ReadingStreak struct {
+	Start  time.Time // First day of the first month.
+	End    time.Time // First day of the last month.
+	Months int
+	Count  int // Books finished during the streak.
+}
+
+// LongestReadingStreak returns the longest run of consecutive months with at least one finished book. finishDates must
+// be in ascending order. Ties are broken by the most recent streak. It returns the zero value if finishDates is empty.
+func LongestReadingStreak(finishDates []time.Time) ReadingStreak {
+	var longest, current ReadingStreak
+	for _, d := range finishDates {
+		month := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+		switch {
+		case current.Months > 0 && month.Equal(current.End):
+		case current.Months > 0 && month.Equal(current.End.AddDate(0, 1, 0)):
+			current.End = month
+			current.Months++
+		default:
+			current = ReadingStreak{Start: month, End: month, Months: 1}
+		}
+		current.Count++
+
+		if current.Months >= longest.Months {
+			longest = current
+		}
+	}
+
+	return longest
+}
+
+// ReadingDrought is the time between two consecutive finished books.
+type ReadingDrought struct {
+	Start time.Time // Finish date of the book before the drought.
+	End   time.Time // Finish date of the book that ended the drought.
+	Days  int
+}
+
+// LongestReadingDroughts returns up to n of the longest gaps between consecutive finish dates ordered by longest first.
+// finishDates must be in ascending order. Ties are ordered by most recent first.
+func LongestReadingDroughts(finishDates []time.Time, n int) []ReadingDrought {
+	var droughts []ReadingDrought
+	for i := 1; i < len(finishDates); i++ {
+		days := int(finishDates[i].Sub(finishDates[i-1]).Hours()/24 + 0.5)
+		if days > 0 {
+			droughts = append(droughts, ReadingDrought{Start: finishDates[i-1], End: finishDates[i], Days: days})
+		}
+	}
+
+	slices.SortStableFunc(droughts, func(a, b ReadingDrought) int {
+		if a.Days != b.Days {
+			return b.Days - a.Days
+		}
+		return b.End.Compare(a.End)
+	})
+
+	return droughts[:min(n, len(droughts))]
 }
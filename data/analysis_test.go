@@ -0,0 +1,190 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestLongestReadingStreak(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, data.ReadingStreak{}, data.LongestReadingStreak(nil))
+
+	streak := data.LongestReadingStreak([]time.Time{
+		date(2018, 11, 5),
+		date(2018, 12, 1),
+		date(2019, 1, 10),
+		date(2019, 1, 20),
+		date(2019, 3, 1),
+		date(2019, 4, 1),
+	})
+	require.Equal(t, data.ReadingStreak{Start: date(2018, 11, 1), End: date(2019, 1, 1), Months: 3, Count: 4}, streak)
+
+	// Ties are broken by the most recent streak.
+	streak = data.LongestReadingStreak([]time.Time{date(2019, 1, 10), date(2019, 5, 1), date(2019, 5, 2)})
+	require.Equal(t, data.ReadingStreak{Start: date(2019, 5, 1), End: date(2019, 5, 1), Months: 1, Count: 2}, streak)
+}
+
+func TestLongestReadingDroughts(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, data.LongestReadingDroughts(nil, 3))
+	require.Empty(t, data.LongestReadingDroughts([]time.Time{date(2019, 1, 1)}, 3))
+
+	finishDates := []time.Time{
+		date(2019, 1, 1),
+		date(2019, 1, 1),
+		date(2019, 1, 11),
+		date(2019, 3, 1),
+		date(2019, 3, 11),
+		date(2019, 3, 12),
+	}
+
+	require.Equal(t, []data.ReadingDrought{
+		{Start: date(2019, 1, 11), End: date(2019, 3, 1), Days: 49},
+		{Start: date(2019, 3, 1), End: date(2019, 3, 11), Days: 10},
+		{Start: date(2019, 1, 1), End: date(2019, 1, 11), Days: 10},
+	}, data.LongestReadingDroughts(finishDates, 3))
+
+	require.Len(t, data.LongestReadingDroughts(finishDates, 10), 4)
+}
+
+func TestReadingStatistics(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	now := date(2021, 3, 15)
+
+	average, err := data.AverageBooksPerMonth(ctx, tx, userID, now)
+	require.NoError(t, err)
+	require.Zero(t, average)
+
+	busiestMonth, err := data.BusiestMonth(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Nil(t, busiestMonth)
+
+	yearOverYear, err := data.BooksYearOverYear(ctx, tx, userID, now)
+	require.NoError(t, err)
+	require.Empty(t, yearOverYear)
+
+	for _, book := range []data.Book{
+		{Title: "Dune", Author: "Frank Herbert", FinishDate: date(2019, 2, 1), Format: "text"},
+		{Title: "Dune Messiah", Author: "frank herbert", FinishDate: date(2019, 2, 20), Format: "audio"},
+		{Title: "Children of Dune", Author: "Frank Herbert", FinishDate: date(2019, 6, 1), Format: "text"},
+		{Title: "Emma", Author: "Jane Austen", FinishDate: date(2021, 1, 5), Format: "text"},
+		{Title: "Persuasion", Author: "Jane Austen", FinishDate: date(2021, 4, 1), Format: "text"},
+		{Title: "Ulysses", Author: "James Joyce", Status: data.BookStatusReading, StartDate: date(2021, 1, 1), Format: "text"},
+	} {
+		book.UserID = userID
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	booksPerFormat, err := data.BooksPerFormat(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []data.FormatCount{{"text", 4}, {"audio", 1}}, booksPerFormat)
+
+	topAuthors, err := data.TopAuthors(ctx, tx, userID, 10)
+	require.NoError(t, err)
+	require.Equal(t, []data.AuthorCount{{"Frank Herbert", 3}, {"Jane Austen", 2}}, topAuthors)
+
+	topAuthors, err = data.TopAuthors(ctx, tx, userID, 1)
+	require.NoError(t, err)
+	require.Len(t, topAuthors, 1)
+
+	// 5 books from February 2019 through March 2021 is 26 months.
+	average, err = data.AverageBooksPerMonth(ctx, tx, userID, now)
+	require.NoError(t, err)
+	require.InDelta(t, 5.0/26.0, average, 0.0001)
+
+	busiestMonth, err = data.BusiestMonth(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, date(2019, 2, 1), busiestMonth.Time.UTC())
+	require.EqualValues(t, 2, busiestMonth.Count)
+
+	yearOverYear, err = data.BooksYearOverYear(ctx, tx, userID, now)
+	require.NoError(t, err)
+	require.Equal(t, []data.YearOverYearItem{
+		{Year: 2021, Count: 2, CountToDate: 1, PreviousCount: 0},
+		{Year: 2020, Count: 0, CountToDate: 0, PreviousCount: 3},
+		{Year: 2019, Count: 3, CountToDate: 2, PreviousCount: 0},
+	}, yearOverYear)
+	require.EqualValues(t, 2, yearOverYear[0].Change())
+	require.EqualValues(t, -3, yearOverYear[1].Change())
+
+	finishDates, err := data.GetFinishDates(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Len(t, finishDates, 5)
+	require.Equal(t, date(2019, 2, 1), finishDates[0])
+	require.Equal(t, date(2021, 4, 1), finishDates[4])
+}
+
+func TestBooksPerMonthForLastYear(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	// Results must not depend on the time zone of the database session.
+	_, err = tx.Exec(ctx, "set local time zone 'Pacific/Auckland'")
+	require.NoError(t, err)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	for _, finishDate := range []time.Time{date(2020, 2, 29), date(2020, 3, 1), date(2021, 2, 1), date(2021, 3, 31)} {
+		_, err := data.CreateBook(ctx, tx, data.Book{
+			UserID:     userID,
+			Title:      "Paradise Lost",
+			Author:     "John Milton",
+			Status:     data.BookStatusFinished,
+			FinishDate: finishDate,
+			Format:     "text",
+		}, time.Now())
+		require.NoError(t, err)
+	}
+
+	items, err := data.BooksPerMonthForLastYear(ctx, tx, userID, date(2021, 3, 31))
+	require.NoError(t, err)
+	require.Len(t, items, 13)
+	require.Equal(t, data.BooksPerTimeItem{Time: date(2021, 3, 1), Count: 1}, items[0])
+	require.Equal(t, data.BooksPerTimeItem{Time: date(2021, 2, 1), Count: 1}, items[1])
+	require.Equal(t, data.BooksPerTimeItem{Time: date(2020, 3, 1), Count: 1}, items[12])
+
+	booksPerYear, err := data.BooksPerYear(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []data.BooksPerTimeItem{{Time: date(2021, 1, 1), Count: 2}, {Time: date(2020, 1, 1), Count: 2}}, booksPerYear)
+}
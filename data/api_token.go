@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype/zeronull"
+	"github.com/jackc/pgxutil"
+)
+
+// apiTokenPrefix makes API tokens recognizable, e.g. by secret scanners.
+const apiTokenPrefix = "booklog_"
+
+type APIToken struct {
+	ID           int64
+	UserID       int64
+	Name         string
+	LastUsedTime time.Time // Zero if the token has never been used.
+	InsertTime   time.Time
+}
+
+// CreateAPIToken creates an API token named name for userID. It returns the token record and the secret token. Only a
+// digest of the secret is stored so it cannot be retrieved again.
+func CreateAPIToken(ctx context.Context, db dbconn, userID int64, name string) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+
+	v := validate.New()
+	v.Presence("name", name)
+	v.MaxLength("name", name, 100)
+	if v.Err() != nil {
+		return nil, "", v.Err()
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &APIToken{UserID: userID, Name: name}
+	err = db.QueryRow(ctx,
+		"insert into api_tokens(user_id, name, token_digest) values($1, $2, $3) returning id, insert_time",
+		userID, name, apiTokenDigest(secret),
+	).Scan(&token.ID, &token.InsertTime)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, secret, nil
+}
+
+// GetAPITokens returns all API tokens owned by userID ordered by most recently created.
+func GetAPITokens(ctx context.Context, db dbconn, userID int64) ([]*APIToken, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		"select id, user_id, name, last_used_time, insert_time from api_tokens where user_id=$1 order by insert_time desc",
+		[]any{userID},
+		func(row pgx.CollectableRow) (*APIToken, error) {
+			var token APIToken
+			err := row.Scan(&token.ID, &token.UserID, &token.Name, (*zeronull.Timestamptz)(&token.LastUsedTime), &token.InsertTime)
+			return &token, err
+		},
+	)
+}
+
+// DeleteAPIToken revokes the API token specified by tokenID owned by userID. It returns a NotFoundError if the token
+// cannot be found or is owned by another user.
+func DeleteAPIToken(ctx context.Context, db dbconn, userID, tokenID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from api_tokens where id=$1 and user_id=$2", tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("api token id=%d", tokenID)}
+	}
+	return nil
+}
+
+// AuthenticateAPIToken returns the user that owns secret and records that the token was used. It returns a
+// NotFoundError if secret is not a valid token. It uses the authenticate_api_token function because row-level security
+// prevents reading api_tokens before the user is authenticated.
+func AuthenticateAPIToken(ctx context.Context, db dbconn, secret string) (*UserMin, error) {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil, &NotFoundError{target: "api token"}
+	}
+
+	var user UserMin
+	err := db.QueryRow(ctx,
+		"select t.user_id, t.username, users.time_zone from authenticate_api_token($1) t join users on users.id=t.user_id",
+		apiTokenDigest(secret),
+	).Scan(&user.ID, &user.Username, &user.TimeZone)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: "api token"}
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// apiTokenDigest returns the digest of secret that is stored in the database. Tokens are 256 bits of random data so a
+// fast hash is sufficient. A slow password hash like bcrypt is only needed for low entropy secrets.
+func apiTokenDigest(secret string) []byte {
+	digest := sha256.Sum256([]byte(secret))
+	return digest[:]
+}
@@ -0,0 +1,81 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	_, _, err = data.CreateAPIToken(ctx, tx, userID, " ")
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("name"), 1)
+
+	token, secret, err := data.CreateAPIToken(ctx, tx, userID, " script ")
+	require.NoError(t, err)
+	require.Equal(t, "script", token.Name)
+	require.NotEmpty(t, secret)
+
+	var storedDigest []byte
+	err = tx.QueryRow(ctx, "select token_digest from api_tokens where id=$1", token.ID).Scan(&storedDigest)
+	require.NoError(t, err)
+	require.NotContains(t, string(storedDigest), secret)
+
+	tokens, err := data.GetAPITokens(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.True(t, tokens[0].LastUsedTime.IsZero())
+
+	user, err := data.AuthenticateAPIToken(ctx, tx, secret)
+	require.NoError(t, err)
+	require.Equal(t, &data.UserMin{ID: userID, Username: "test", TimeZone: "UTC"}, user)
+
+	tokens, err = data.GetAPITokens(ctx, tx, userID)
+	require.NoError(t, err)
+	require.False(t, tokens[0].LastUsedTime.IsZero())
+
+	for _, s := range []string{"", "x", secret + "x", secret[:len(secret)-1]} {
+		_, err = data.AuthenticateAPIToken(ctx, tx, s)
+		var nfErr *data.NotFoundError
+		require.Truef(t, errors.As(err, &nfErr), "%q", s)
+	}
+
+	err = data.DeleteAPIToken(ctx, tx, otherUserID, token.ID)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+
+	err = data.DeleteAPIToken(ctx, tx, userID, token.ID)
+	require.NoError(t, err)
+
+	_, err = data.AuthenticateAPIToken(ctx, tx, secret)
+	require.ErrorAs(t, err, &nfErr)
+}
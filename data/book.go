@@ -2,10 +2,17 @@ package data
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/jackc/booklog/validate"
 	"github.com/jackc/errortree"
@@ -13,14 +20,32 @@ import (
 	"github.com/jackc/pgx/v5/pgtype/zeronull"
 )
 
+const (
+	BookStatusWantToRead = "want_to_read"
+	BookStatusReading    = "reading"
+	BookStatusFinished   = "finished"
+	BookStatusAbandoned  = "abandoned"
+)
+
+// BookStatuses is all book statuses in the order they should be presented.
+var BookStatuses = []string{BookStatusFinished, BookStatusReading, BookStatusWantToRead, BookStatusAbandoned}
+
 type Book struct {
 	ID         int64
 	UserID     int64
 	Title      string
 	Author     string
-	FinishDate time.Time
+	Status     string
+	StartDate  time.Time // Zero means not started or unknown.
+	FinishDate time.Time // Zero means not finished. For abandoned books it is when reading stopped.
 	Format     string
 	Location   string
+	Rating     float64 // 0.5 to 5 in half star increments. 0 means not rated.
+	Review     string
+	Tags       []string
+	ISBN       string // ISBN-10 or ISBN-13 without hyphens. Empty means unknown.
+	PageCount  int32  // 0 means unknown.
+	Private    bool   // Private books are hidden from visitors even when the owner's reading log is visible.
 	InsertTime time.Time
 	UpdateTime time.Time
 }
@@ -30,9 +55,27 @@ func (book *Book) Normalize() {
 	book.Author = strings.TrimSpace(book.Author)
 	book.Format = strings.TrimSpace(book.Format)
 	book.Location = strings.TrimSpace(book.Location)
+	book.Review = strings.TrimSpace(book.Review)
+	book.Status = strings.TrimSpace(book.Status)
+	if book.Status == "" {
+		book.Status = BookStatusFinished
+	}
+	book.Tags = normalizeTags(book.Tags)
+	book.ISBN = strings.ToUpper(isbnReplacer.Replace(book.ISBN))
+}
+
+var isbnRegexp = regexp.MustCompile(`^([0-9]{9}[0-9X]|[0-9]{13})$`)
+
+var isbnReplacer = strings.NewReplacer("-", "", " ", "")
+
+// IsISBN returns true if s is an ISBN-10 or ISBN-13. Hyphens and spaces are ignored.
+func IsISBN(s string) bool {
+	return isbnRegexp.MatchString(strings.ToUpper(isbnReplacer.Replace(s)))
 }
 
-func (book *Book) Validate() *errortree.Node {
+// Validate returns the validation errors of book. today is the current date of the owner as returned by Today. Dates
+// after today are invalid.
+func (book *Book) Validate(today time.Time) *errortree.Node {
 	v := validate.New()
 	v.Presence("title", book.Title)
 	v.Presence("author", book.Author)
@@ -44,10 +87,47 @@ func (book *Book) Validate() *errortree.Node {
 		v.Add("finishDate", errors.New(`must be "text", "audio", or "video"`))
 	}
 
-	if book.FinishDate.After(time.Now()) {
+	if !slices.Contains(BookStatuses, book.Status) {
+		v.Add("status", errors.New(`must be "want_to_read", "reading", "finished", or "abandoned"`))
+	}
+
+	if book.Status == BookStatusFinished && book.FinishDate.IsZero() {
+		v.Add("finishDate", errors.New("is required for finished books"))
+	}
+
+	if book.StartDate.After(today) {
+		v.Add("startDate", errors.New("cannot be in future"))
+	}
+
+	if book.FinishDate.After(today) {
 		v.Add("finishDate", errors.New("cannot be in future"))
 	}
 
+	if !book.StartDate.IsZero() && !book.FinishDate.IsZero() && book.FinishDate.Before(book.StartDate) {
+		v.Add("finishDate", errors.New("cannot be before start date"))
+	}
+
+	if book.Rating != 0 && (book.Rating < 0.5 || book.Rating > 5 || book.Rating*2 != math.Trunc(book.Rating*2)) {
+		v.Add("rating", errors.New("must be from 0.5 to 5 in half star increments"))
+	}
+
+	v.MaxLength("review", book.Review, 20000)
+
+	if book.ISBN != "" && !isbnRegexp.MatchString(book.ISBN) {
+		v.Add("isbn", errors.New("must be 10 or 13 digits"))
+	}
+
+	if book.PageCount < 0 {
+		v.Add("pageCount", errors.New("cannot be negative"))
+	}
+
+	for _, t := range book.Tags {
+		if strings.ContainsAny(t, ",/") {
+			v.Add("tags", fmt.Errorf("%q cannot contain a comma or slash", t))
+		}
+		v.MaxLength("tags", t, 50)
+	}
+
 	if v.Err() != nil {
 		return v.Err().(*errortree.Node)
 	}
@@ -55,10 +135,11 @@ func (book *Book) Validate() *errortree.Node {
 	return nil
 }
 
-// CreateBook inserts a book into the database. It ignores the ID, InsertTime, and UpdateTime fields.
-func CreateBook(ctx context.Context, db dbconn, book Book) (*Book, error) {
+// CreateBook inserts a book into the database. It ignores the ID field. InsertTime and UpdateTime default to the current
+// time if they are zero. They are only set when restoring previously exported books. today is passed to Book.Validate.
+func CreateBook(ctx context.Context, db dbconn, book Book, today time.Time) (*Book, error) {
 	book.Normalize()
-	if verrs := book.Validate(); verrs != nil {
+	if verrs := book.Validate(today); verrs != nil {
 		return nil, verrs
 	}
 
@@ -67,26 +148,53 @@ func CreateBook(ctx context.Context, db dbconn, book Book) (*Book, error) {
 		location = &book.Location
 	}
 
-	err := db.QueryRow(ctx, "insert into books(user_id, title, author, finish_date, format, location) values($1, $2, $3, $4, $5, $6) returning id, insert_time, update_time",
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, "insert into books(user_id, title, author, status, start_date, finish_date, format, location, rating, review, isbn, page_count, private, insert_time, update_time) values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, coalesce($14, now()), coalesce($15, now())) returning id, insert_time, update_time",
 		book.UserID,
 		book.Title,
 		book.Author,
-		book.FinishDate,
+		book.Status,
+		zeronullDate(book.StartDate),
+		zeronullDate(book.FinishDate),
 		book.Format,
 		location,
+		zeronull.Float8(book.Rating),
+		zeronull.Text(book.Review),
+		zeronull.Text(book.ISBN),
+		zeronull.Int4(book.PageCount),
+		book.Private,
+		zeronull.Timestamptz(book.InsertTime),
+		zeronull.Timestamptz(book.UpdateTime),
 	).Scan(&book.ID, &book.InsertTime, &book.UpdateTime)
 	if err != nil {
 		return nil, err
 	}
 
+	err = setBookTags(ctx, tx, book.UserID, book.ID, book.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return &book, nil
 }
 
-// Update book updates the Title, Author, FinishDate, and Format fields of book in the database. It uses book.ID as the
-// row ID to update.
-func UpdateBook(ctx context.Context, db dbconn, book Book) error {
+// UpdateBook updates the Title, Author, Status, StartDate, FinishDate, Format, Location, Rating, Review, Tags, ISBN,
+// PageCount, and Private fields of book in the database. It uses book.ID as the row ID to update and book.UserID as the
+// owner. It returns a NotFoundError if the book cannot be found or is owned by another user. today is passed to
+// Book.Validate.
+func UpdateBook(ctx context.Context, db dbconn, book Book, today time.Time) error {
 	book.Normalize()
-	if verrs := book.Validate(); verrs != nil {
+	if verrs := book.Validate(today); verrs != nil {
 		return verrs
 	}
 
@@ -95,13 +203,27 @@ func UpdateBook(ctx context.Context, db dbconn, book Book) error {
 		location = &book.Location
 	}
 
-	commandTag, err := db.Exec(ctx, "update books set title=$1, author=$2, finish_date=$3, format=$4, location=$5 where id=$6",
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, "update books set title=$1, author=$2, status=$3, start_date=$4, finish_date=$5, format=$6, location=$7, rating=$8, review=$9, isbn=$10, page_count=$11, private=$12 where id=$13 and user_id=$14",
 		book.Title,
 		book.Author,
-		book.FinishDate,
+		book.Status,
+		zeronullDate(book.StartDate),
+		zeronullDate(book.FinishDate),
 		book.Format,
 		location,
-		book.ID)
+		zeronull.Float8(book.Rating),
+		zeronull.Text(book.Review),
+		zeronull.Text(book.ISBN),
+		zeronull.Int4(book.PageCount),
+		book.Private,
+		book.ID,
+		book.UserID)
 	if err != nil {
 		return err
 	}
@@ -109,13 +231,18 @@ func UpdateBook(ctx context.Context, db dbconn, book Book) error {
 		return &NotFoundError{target: fmt.Sprintf("book id=%d", book.ID)}
 	}
 
-	return nil
+	err = setBookTags(ctx, tx, book.UserID, book.ID, book.Tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-// DeleteBook deletes the book specified by bookID. It returns a NotFoundError if the book
-// cannot be found.
-func DeleteBook(ctx context.Context, db dbconn, bookID int64) error {
-	commandTag, err := db.Exec(ctx, "delete from books where id=$1", bookID)
+// DeleteBook deletes the book specified by bookID owned by userID. It returns a NotFoundError if the book cannot be found
+// or is owned by another user.
+func DeleteBook(ctx context.Context, db dbconn, userID, bookID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from books where id=$1 and user_id=$2", bookID, userID)
 	if err != nil {
 		return err
 	}
@@ -125,8 +252,10 @@ func DeleteBook(ctx context.Context, db dbconn, bookID int64) error {
 	return nil
 }
 
-func GetBook(ctx context.Context, db dbconn, bookID int64) (*Book, error) {
-	rows, _ := db.Query(ctx, "select id, user_id, title, author, finish_date, format, location, insert_time, update_time from books where id=$1", bookID)
+// GetBook returns the book specified by bookID owned by userID. It returns a NotFoundError if the book cannot be found or
+// is owned by another user.
+func GetBook(ctx context.Context, db dbconn, userID, bookID int64) (*Book, error) {
+	rows, _ := db.Query(ctx, "select "+bookColumns+" from books where id=$1 and user_id=$2", bookID, userID)
 	book, err := pgx.CollectOneRow(rows, RowToAddrOfBook)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -137,17 +266,338 @@ func GetBook(ctx context.Context, db dbconn, bookID int64) (*Book, error) {
 	return book, nil
 }
 
+// bookColumns is the select list for RowToAddrOfBook. It must be used in a query where books is not aliased.
+const bookColumns = `id, user_id, title, author, status, start_date, finish_date, format, location, rating, review,
+	array(
+		select tags.name
+		from book_tags
+			join tags on book_tags.tag_id=tags.id
+		where book_tags.book_id=books.id
+		order by lower(tags.name)
+	),
+	isbn, page_count, private, insert_time, update_time`
+
+// bookScanTargets returns the scan targets for bookColumns.
+func bookScanTargets(book *Book) []any {
+	return []any{&book.ID, &book.UserID, &book.Title, &book.Author, &book.Status, (*zeronullDate)(&book.StartDate), (*zeronullDate)(&book.FinishDate), &book.Format, (*zeronull.Text)(&book.Location), (*zeronull.Float8)(&book.Rating), (*zeronull.Text)(&book.Review), &book.Tags, (*zeronull.Text)(&book.ISBN), (*zeronull.Int4)(&book.PageCount), &book.Private, &book.InsertTime, &book.UpdateTime}
+}
+
 func RowToAddrOfBook(row pgx.CollectableRow) (*Book, error) {
 	var book Book
-	err := row.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.FinishDate, &book.Format, (*zeronull.Text)(&book.Location), &book.InsertTime, &book.UpdateTime)
+	err := row.Scan(bookScanTargets(&book)...)
 	return &book, err
 }
 
 func GetAllBooks(ctx context.Context, db dbconn, userID int64) ([]*Book, error) {
-	rows, _ := db.Query(ctx, `select id, user_id, title, author, finish_date, format, location, insert_time, update_time
+	rows, _ := db.Query(ctx, `select `+bookColumns+`
 from books
 where user_id=$1
-order by finish_date desc`,
+order by coalesce(finish_date, start_date) desc nulls last, insert_time desc`,
 		userID)
 	return pgx.CollectRows(rows, RowToAddrOfBook)
 }
+
+// ForEachBook calls fn for each book owned by userID in the same order as GetAllBooks without loading all books into
+// memory. The *Book passed to fn is reused for each row and must not be retained.
+func ForEachBook(ctx context.Context, db dbconn, userID int64, fn func(*Book) error) error {
+	rows, _ := db.Query(ctx, `select `+bookColumns+`
+from books
+where user_id=$1
+order by coalesce(finish_date, start_date) desc nulls last, insert_time desc`,
+		userID)
+
+	var book Book
+	_, err := pgx.ForEachRow(rows, bookScanTargets(&book), func() error {
+		return fn(&book)
+	})
+	return err
+}
+
+// GetBooksByStatus returns the books owned by userID with status. Books are ordered by most recently finished or started.
+func GetBooksByStatus(ctx context.Context, db dbconn, userID int64, status string) ([]*Book, error) {
+	rows, _ := db.Query(ctx, `select `+bookColumns+`
+from books
+where user_id=$1 and status=$2
+order by coalesce(finish_date, start_date) desc nulls last, insert_time desc`,
+		userID, status)
+	return pgx.CollectRows(rows, RowToAddrOfBook)
+}
+
+type BookFilter struct {
+	Status   string // Empty means any status.
+	Format   string
+	Author   string // Case insensitive substring match.
+	Location string // Case insensitive substring match.
+	FromYear int    // Earliest finish year. 0 means no limit.
+	ToYear   int    // Latest finish year. 0 means no limit.
+
+	ExcludePrivate bool // Exclude private books. Used when a visitor is viewing the books.
+}
+
+const (
+	BookSortFinishDate = "finish_date"
+	BookSortTitle      = "title"
+	BookSortAuthor     = "author"
+	BookSortInsertTime = "insert_time"
+)
+
+// BookSorts is all book sort orders in the order they should be presented.
+var BookSorts = []string{BookSortFinishDate, BookSortTitle, BookSortAuthor, BookSortInsertTime}
+
+type bookSort struct {
+	expr     string                // Must never be null so it can be used for keyset pagination.
+	cast     string                // Type to cast the text representation of expr back to.
+	validKey func(key string) bool // Reports whether key can be cast. Cursors come from the URL so they may be forged.
+	desc     bool
+}
+
+// bookSortsByName maps sort names to sorts. Each sort has an index on (user_id, expr, id) in the same direction.
+var bookSortsByName = map[string]bookSort{
+	BookSortFinishDate: {expr: "coalesce(finish_date, '-infinity')", cast: "date", validKey: validDateSortKey, desc: true},
+	BookSortTitle:      {expr: "lower(title)", cast: "text", validKey: utf8.ValidString},
+	BookSortAuthor:     {expr: "lower(author)", cast: "text", validKey: utf8.ValidString},
+	BookSortInsertTime: {expr: "insert_time", cast: "timestamptz", validKey: validTimestamptzSortKey, desc: true},
+}
+
+// validDateSortKey reports whether key is the text representation of a date sort key.
+func validDateSortKey(key string) bool {
+	if key == "-infinity" {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", key)
+	return err == nil
+}
+
+// validTimestamptzSortKey reports whether key is the text representation of a timestamptz in the ISO date style. The
+// time zone offset is formatted with minutes only when it is not a whole number of hours.
+func validTimestamptzSortKey(key string) bool {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999-07", "2006-01-02 15:04:05.999999-07:00"} {
+		if _, err := time.Parse(layout, key); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrInvalidBookCursor = errors.New("invalid book cursor")
+
+type BookPage struct {
+	Books      []*Book
+	NextCursor string // Empty if this is the last page.
+}
+
+// GetBooksPage returns up to limit books owned by userID that match filter ordered by sort. cursor is the NextCursor of
+// the previous page or empty for the first page. Pagination is keyset based so it remains fast and stable for users with
+// many books.
+func GetBooksPage(ctx context.Context, db dbconn, userID int64, filter BookFilter, sort string, cursor string, limit int) (*BookPage, error) {
+	bs, ok := bookSortsByName[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown book sort: %q", sort)
+	}
+
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "select %s, %s::text\nfrom books\nwhere user_id=$1", bookColumns, bs.expr)
+
+	if filter.Status != "" {
+		fmt.Fprintf(sb, " and status=%s", arg(filter.Status))
+	}
+	if filter.Format != "" {
+		fmt.Fprintf(sb, " and format=%s", arg(filter.Format))
+	}
+	if filter.Author != "" {
+		fmt.Fprintf(sb, " and author ilike %s", arg("%"+escapeLike(filter.Author)+"%"))
+	}
+	if filter.Location != "" {
+		fmt.Fprintf(sb, " and location ilike %s", arg("%"+escapeLike(filter.Location)+"%"))
+	}
+	if filter.ExcludePrivate {
+		sb.WriteString(" and not private")
+	}
+	if filter.FromYear != 0 {
+		fmt.Fprintf(sb, " and finish_date >= make_date(%s, 1, 1)", arg(filter.FromYear))
+	}
+	if filter.ToYear != 0 {
+		fmt.Fprintf(sb, " and finish_date < make_date(%s, 1, 1)", arg(filter.ToYear+1))
+	}
+
+	direction, comparison := "asc", ">"
+	if bs.desc {
+		direction, comparison = "desc", "<"
+	}
+
+	if cursor != "" {
+		key, id, err := decodeBookCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if !bs.validKey(key) {
+			return nil, ErrInvalidBookCursor
+		}
+		fmt.Fprintf(sb, " and (%s, id) %s (%s::%s, %s)", bs.expr, comparison, arg(key), bs.cast, arg(id))
+	}
+
+	fmt.Fprintf(sb, "\norder by %s %s, id %s\nlimit %s", bs.expr, direction, direction, arg(limit+1))
+
+	rows, _ := db.Query(ctx, sb.String(), args...)
+	var sortKeys []string
+	books, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Book, error) {
+		var book Book
+		var sortKey string
+		err := row.Scan(append(bookScanTargets(&book), &sortKey)...)
+		sortKeys = append(sortKeys, sortKey)
+		return &book, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &BookPage{Books: books}
+	if len(books) > limit {
+		page.Books = books[:limit]
+		last := page.Books[limit-1]
+		page.NextCursor = encodeBookCursor(sortKeys[limit-1], last.ID)
+	}
+
+	return page, nil
+}
+
+func encodeBookCursor(key string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key + "\x00" + strconv.FormatInt(id, 10)))
+}
+
+func decodeBookCursor(cursor string) (string, int64, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidBookCursor
+	}
+
+	key, idStr, found := strings.Cut(string(buf), "\x00")
+	if !found {
+		return "", 0, ErrInvalidBookCursor
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidBookCursor
+	}
+
+	return key, id, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes the special characters in s for use in a like pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// ErrInvalidBookTransition is returned by StartReadingBook, FinishBook, and AbandonBook when the book cannot change to
+// the new status from its current status or when the date would be before its start date. Changing a finished or
+// abandoned book this way would lose when it was read.
+var ErrInvalidBookTransition = errors.New("book cannot change to that status")
+
+// StartReadingBook changes the status of the book specified by bookID owned by userID to reading and sets its start
+// date. Only books that are wanted or were abandoned can be started. It returns a NotFoundError if the book cannot be
+// found or is owned by another user. It returns ErrInvalidBookTransition if the book cannot be started.
+func StartReadingBook(ctx context.Context, db dbconn, userID, bookID int64, startDate time.Time) error {
+	return transitionBook(ctx, db, userID, bookID, "update books set status='reading', start_date=$3, finish_date=null where id=$1 and user_id=$2 and status in ('want_to_read', 'abandoned')", startDate)
+}
+
+// FinishBook changes the status of the book specified by bookID owned by userID to finished and sets its finish date.
+// Only books that are wanted or being read can be finished. It returns a NotFoundError if the book cannot be found or is
+// owned by another user. It returns ErrInvalidBookTransition if the book cannot be finished on finishDate.
+func FinishBook(ctx context.Context, db dbconn, userID, bookID int64, finishDate time.Time) error {
+	return transitionBook(ctx, db, userID, bookID, "update books set status='finished', finish_date=$3 where id=$1 and user_id=$2 and status in ('want_to_read', 'reading') and (start_date is null or start_date <= $3)", finishDate)
+}
+
+// AbandonBook changes the status of the book specified by bookID owned by userID to abandoned (did not finish) and sets
+// its finish date to when reading stopped. Only books that are wanted or being read can be abandoned. It returns a
+// NotFoundError if the book cannot be found or is owned by another user. It returns ErrInvalidBookTransition if the book
+// cannot be abandoned on stopDate.
+func AbandonBook(ctx context.Context, db dbconn, userID, bookID int64, stopDate time.Time) error {
+	return transitionBook(ctx, db, userID, bookID, "update books set status='abandoned', finish_date=$3 where id=$1 and user_id=$2 and status in ('want_to_read', 'reading') and (start_date is null or start_date <= $3)", stopDate)
+}
+
+// transitionBook executes the update sql for the book specified by bookID owned by userID with date as $3. When no row
+// is updated it distinguishes a missing book from one the conditions in sql rejected.
+func transitionBook(ctx context.Context, db dbconn, userID, bookID int64, sql string, date time.Time) error {
+	commandTag, err := db.Exec(ctx, sql, bookID, userID, zeronullDate(date))
+	if err != nil {
+		return err
+	}
+	if commandTag.String() != "UPDATE 1" {
+		var exists bool
+		err := db.QueryRow(ctx, "select exists(select 1 from books where id=$1 and user_id=$2)", bookID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrInvalidBookTransition
+		}
+		return &NotFoundError{target: fmt.Sprintf("book id=%d", bookID)}
+	}
+	return nil
+}
+
+// HighlightStart and HighlightStop surround matching words in BookSearchResult.Title and BookSearchResult.Snippet. They
+// are control characters that are removed from the searched text so they cannot come from user entered text.
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+type BookSearchResult struct {
+	Book    *Book
+	Rank    float32
+	Title   string // The book title with matches highlighted.
+	Snippet string // An excerpt of the author, location, and review with matches highlighted.
+}
+
+// SearchBooks searches the title, author, location, and review of the books owned by userID. Each word in query matches
+// words that begin with it. Results are ordered by relevance. At most limit results are returned.
+func SearchBooks(ctx context.Context, db dbconn, userID int64, query string, limit int) ([]*BookSearchResult, error) {
+	tsquery := prefixTSQuery(query)
+	if tsquery == "" {
+		return nil, nil
+	}
+
+	titleOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", HighlightStart, HighlightStop)
+	snippetOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2", HighlightStart, HighlightStop)
+
+	rows, _ := db.Query(ctx, `select `+bookColumns+`,
+	ts_rank(search_vector, query),
+	ts_headline('english', translate(title, E'\x02\x03', ''), query, $3),
+	ts_headline('english', translate(concat_ws(' · ', author, location, review), E'\x02\x03', ''), query, $4)
+from books, to_tsquery('english', $2) query
+where user_id=$1
+	and search_vector @@ query
+order by ts_rank(search_vector, query) desc, coalesce(finish_date, start_date) desc nulls last
+limit $5`,
+		userID, tsquery, titleOptions, snippetOptions, limit)
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*BookSearchResult, error) {
+		result := &BookSearchResult{Book: &Book{}}
+		err := row.Scan(append(bookScanTargets(result.Book), &result.Rank, &result.Title, &result.Snippet)...)
+		return result, err
+	})
+}
+
+// prefixTSQuery converts query to a tsquery that matches documents containing words that begin with every word in query.
+// Everything other than letters and digits is treated as a word separator so the result is always a valid tsquery.
+func prefixTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = w + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BookImport is an uploaded CSV file that has not yet been imported.
+type BookImport struct {
+	ID         int64
+	UserID     int64
+	Filename   string
+	Records    [][]string     // Includes the header row.
+	Mapping    *ImportMapping // nil means the format is detected from the header row.
+	InsertTime time.Time
+}
+
+// CreateBookImport stores the records of an uploaded CSV file. Imports older than a day that were never committed or
+// canceled are deleted.
+func CreateBookImport(ctx context.Context, db dbconn, userID int64, filename string, records [][]string) (*BookImport, error) {
+	_, err := db.Exec(ctx, "delete from book_imports where user_id=$1 and insert_time < now() - '1 day'::interval", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bi := &BookImport{UserID: userID, Filename: filename, Records: records}
+	err = db.QueryRow(ctx,
+		"insert into book_imports(user_id, filename, records) values($1, $2, $3) returning id, insert_time",
+		userID, filename, records,
+	).Scan(&bi.ID, &bi.InsertTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return bi, nil
+}
+
+// GetBookImport returns the import specified by importID owned by userID. It returns a NotFoundError if the import cannot
+// be found or is owned by another user.
+func GetBookImport(ctx context.Context, db dbconn, userID, importID int64) (*BookImport, error) {
+	var bi BookImport
+	err := db.QueryRow(ctx,
+		"select id, user_id, filename, records, mapping, insert_time from book_imports where id=$1 and user_id=$2",
+		importID, userID,
+	).Scan(&bi.ID, &bi.UserID, &bi.Filename, &bi.Records, &bi.Mapping, &bi.InsertTime)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: fmt.Sprintf("book import id=%d", importID)}
+		}
+		return nil, err
+	}
+
+	return &bi, nil
+}
+
+// SetBookImportMapping sets the column mapping of the import specified by importID owned by userID. It returns a
+// NotFoundError if the import cannot be found or is owned by another user.
+func SetBookImportMapping(ctx context.Context, db dbconn, userID, importID int64, mapping ImportMapping) error {
+	if verr := mapping.Validate(); verr != nil {
+		return verr
+	}
+
+	commandTag, err := db.Exec(ctx, "update book_imports set mapping=$1 where id=$2 and user_id=$3", mapping, importID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("book import id=%d", importID)}
+	}
+	return nil
+}
+
+// DeleteBookImport deletes the import specified by importID owned by userID. It returns a NotFoundError if the import
+// cannot be found or is owned by another user.
+func DeleteBookImport(ctx context.Context, db dbconn, userID, importID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from book_imports where id=$1 and user_id=$2", importID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("book import id=%d", importID)}
+	}
+	return nil
+}
+
+// BookDuplicateKey returns the key used to detect duplicate books. Books with the same normalized title, author, and
+// finish date are considered duplicates.
+func BookDuplicateKey(title, author string, finishDate time.Time) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+
+	var date string
+	if !finishDate.IsZero() {
+		date = finishDate.Format("2006-01-02")
+	}
+
+	return normalize(title) + "\x00" + normalize(author) + "\x00" + date
+}
+
+// GetBookDuplicateKeys returns a map of BookDuplicateKey to book ID for all books owned by userID.
+func GetBookDuplicateKeys(ctx context.Context, db dbconn, userID int64) (map[string]int64, error) {
+	rows, _ := db.Query(ctx, "select id, title, author, finish_date from books where user_id=$1 order by id", userID)
+	keys := make(map[string]int64)
+	var id int64
+	var title, author string
+	var finishDate time.Time
+	_, err := pgx.ForEachRow(rows, []any{&id, &title, &author, (*zeronullDate)(&finishDate)}, func() error {
+		key := BookDuplicateKey(title, author, finishDate)
+		if _, ok := keys[key]; !ok {
+			keys[key] = id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -2,11 +2,13 @@ package data_test
 
 import (
 	"context"
+	"encoding/base64"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
 	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/require"
 )
@@ -42,7 +44,7 @@ func TestDeleteBookSuccess(t *testing.T) {
 	).Scan(&bookID)
 	require.NoError(t, err)
 
-	err = data.DeleteBook(ctx, tx, bookID)
+	err = data.DeleteBook(ctx, tx, userID, bookID)
 	require.NoError(t, err)
 
 	var bookCount int64
@@ -77,7 +79,7 @@ func TestDeleteBookMissingBookID(t *testing.T) {
 	).Scan(&bookID)
 	require.NoError(t, err)
 
-	err = data.DeleteBook(ctx, tx, -1)
+	err = data.DeleteBook(ctx, tx, userID, -1)
 	require.Error(t, err)
 	require.IsType(t, &data.NotFoundError{}, err)
 
@@ -87,3 +89,688 @@ func TestDeleteBookMissingBookID(t *testing.T) {
 
 	require.EqualValues(t, 1, bookCount)
 }
+
+func TestDeleteBookOtherUser(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		userID, "Paradise Lost", "John Milton", time.Now(), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	err = data.DeleteBook(ctx, tx, otherUserID, bookID)
+	require.Error(t, err)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	var bookCount int64
+	err = tx.QueryRow(ctx, "select count(*) from books where user_id=$1", userID).Scan(&bookCount)
+	require.NoError(t, err)
+
+	require.EqualValues(t, 1, bookCount)
+}
+
+func TestGetBookSuccess(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		userID, "Paradise Lost", "John Milton", time.Now(), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	book, err := data.GetBook(ctx, tx, userID, bookID)
+	require.NoError(t, err)
+	require.Equal(t, bookID, book.ID)
+	require.Equal(t, userID, book.UserID)
+	require.Equal(t, "Paradise Lost", book.Title)
+}
+
+func TestGetBookOtherUser(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		userID, "Paradise Lost", "John Milton", time.Now(), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	book, err := data.GetBook(ctx, tx, otherUserID, bookID)
+	require.Error(t, err)
+	require.IsType(t, &data.NotFoundError{}, err)
+	require.Nil(t, book)
+}
+
+func TestUpdateBookOtherUser(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		userID, "Paradise Lost", "John Milton", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	err = data.UpdateBook(ctx, tx, data.Book{
+		ID:         bookID,
+		UserID:     otherUserID,
+		Title:      "Paradise Regained",
+		Author:     "John Milton",
+		FinishDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Format:     "text",
+	}, time.Now())
+	require.Error(t, err)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	var title string
+	err = tx.QueryRow(ctx, "select title from books where id=$1", bookID).Scan(&title)
+	require.NoError(t, err)
+
+	require.Equal(t, "Paradise Lost", title)
+}
+
+func TestBooksRowLevelSecurity(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		userID, "Paradise Lost", "John Milton", time.Now(), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	// Act as the application role with the other user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", otherUserID)
+	require.NoError(t, err)
+
+	var bookCount int64
+	err = tx.QueryRow(ctx, "select count(*) from books").Scan(&bookCount)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, bookCount)
+
+	_, err = data.GetBook(ctx, tx, userID, bookID)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	err = data.DeleteBook(ctx, tx, userID, bookID)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", userID)
+	require.NoError(t, err)
+
+	book, err := data.GetBook(ctx, tx, userID, bookID)
+	require.NoError(t, err)
+	require.Equal(t, "Paradise Lost", book.Title)
+}
+
+func TestBookValidateRating(t *testing.T) {
+	for _, tt := range []struct {
+		rating float64
+		valid  bool
+	}{
+		{0, true},
+		{0.5, true},
+		{3, true},
+		{4.5, true},
+		{5, true},
+		{0.25, false},
+		{3.7, false},
+		{5.5, false},
+		{-1, false},
+	} {
+		book := data.Book{
+			Title:      "Paradise Lost",
+			Author:     "John Milton",
+			Status:     data.BookStatusFinished,
+			FinishDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			Format:     "text",
+			Rating:     tt.rating,
+		}
+		verr := book.Validate(time.Now())
+		if tt.valid {
+			require.Nil(t, verr, "rating %v", tt.rating)
+		} else {
+			require.NotNil(t, verr, "rating %v", tt.rating)
+			require.NotEmpty(t, verr.Get("rating"), "rating %v", tt.rating)
+		}
+	}
+}
+
+func TestBookValidateStatus(t *testing.T) {
+	book := data.Book{Title: "Paradise Lost", Author: "John Milton", Format: "text", Status: data.BookStatusWantToRead}
+	require.Nil(t, book.Validate(time.Now()))
+
+	book.Status = data.BookStatusFinished
+	verr := book.Validate(time.Now())
+	require.NotNil(t, verr)
+	require.NotEmpty(t, verr.Get("finishDate"))
+
+	book.Status = "shelved"
+	verr = book.Validate(time.Now())
+	require.NotNil(t, verr)
+	require.NotEmpty(t, verr.Get("status"))
+
+	book.Status = data.BookStatusAbandoned
+	book.StartDate = time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)
+	book.FinishDate = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	verr = book.Validate(time.Now())
+	require.NotNil(t, verr)
+	require.NotEmpty(t, verr.Get("finishDate"))
+}
+
+func TestBookValidateFutureDates(t *testing.T) {
+	today := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	book := data.Book{
+		Title:      "Paradise Lost",
+		Author:     "John Milton",
+		Format:     "text",
+		Status:     data.BookStatusFinished,
+		StartDate:  today,
+		FinishDate: today,
+	}
+	require.Nil(t, book.Validate(today))
+
+	book.FinishDate = today.AddDate(0, 0, 1)
+	verr := book.Validate(today)
+	require.NotNil(t, verr)
+	require.NotEmpty(t, verr.Get("finishDate"))
+	require.Empty(t, verr.Get("startDate"))
+
+	book.StartDate = today.AddDate(0, 0, 1)
+	verr = book.Validate(today)
+	require.NotNil(t, verr)
+	require.NotEmpty(t, verr.Get("startDate"))
+}
+
+func TestBookStatusTransitions(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	book, err := data.CreateBook(ctx, tx, data.Book{
+		UserID: userID,
+		Title:  "Paradise Lost",
+		Author: "John Milton",
+		Format: "text",
+		Status: data.BookStatusWantToRead,
+	}, time.Now())
+	require.NoError(t, err)
+
+	books, err := data.GetBooksByStatus(ctx, tx, userID, data.BookStatusWantToRead)
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	require.True(t, books[0].StartDate.IsZero())
+	require.True(t, books[0].FinishDate.IsZero())
+
+	startDate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = data.StartReadingBook(ctx, tx, userID, book.ID, startDate)
+	require.NoError(t, err)
+
+	book, err = data.GetBook(ctx, tx, userID, book.ID)
+	require.NoError(t, err)
+	require.Equal(t, data.BookStatusReading, book.Status)
+	require.Equal(t, startDate, book.StartDate)
+
+	finishDate := time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)
+	err = data.FinishBook(ctx, tx, userID, book.ID, finishDate)
+	require.NoError(t, err)
+
+	book, err = data.GetBook(ctx, tx, userID, book.ID)
+	require.NoError(t, err)
+	require.Equal(t, data.BookStatusFinished, book.Status)
+	require.Equal(t, startDate, book.StartDate)
+	require.Equal(t, finishDate, book.FinishDate)
+
+	booksPerYear, err := data.BooksPerYear(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Len(t, booksPerYear, 1)
+	require.EqualValues(t, 1, booksPerYear[0].Count)
+
+	// Changing a finished book again would erase when it was read.
+	laterDate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = data.StartReadingBook(ctx, tx, userID, book.ID, laterDate)
+	require.ErrorIs(t, err, data.ErrInvalidBookTransition)
+	err = data.FinishBook(ctx, tx, userID, book.ID, laterDate)
+	require.ErrorIs(t, err, data.ErrInvalidBookTransition)
+	err = data.AbandonBook(ctx, tx, userID, book.ID, laterDate)
+	require.ErrorIs(t, err, data.ErrInvalidBookTransition)
+
+	book, err = data.GetBook(ctx, tx, userID, book.ID)
+	require.NoError(t, err)
+	require.Equal(t, data.BookStatusFinished, book.Status)
+	require.Equal(t, startDate, book.StartDate)
+	require.Equal(t, finishDate, book.FinishDate)
+
+	booksPerYear, err = data.BooksPerYear(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Len(t, booksPerYear, 1)
+
+	err = data.StartReadingBook(ctx, tx, userID, -1, startDate)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	err = data.FinishBook(ctx, tx, userID, -1, finishDate)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	book, err = data.CreateBook(ctx, tx, data.Book{
+		UserID:    userID,
+		Title:     "Paradise Regained",
+		Author:    "John Milton",
+		Format:    "text",
+		Status:    data.BookStatusReading,
+		StartDate: startDate,
+	}, time.Now())
+	require.NoError(t, err)
+
+	// A book cannot stop before it was started.
+	err = data.AbandonBook(ctx, tx, userID, book.ID, startDate.AddDate(0, 0, -1))
+	require.ErrorIs(t, err, data.ErrInvalidBookTransition)
+
+	err = data.AbandonBook(ctx, tx, userID, book.ID, finishDate)
+	require.NoError(t, err)
+
+	book, err = data.GetBook(ctx, tx, userID, book.ID)
+	require.NoError(t, err)
+	require.Equal(t, data.BookStatusAbandoned, book.Status)
+	require.Equal(t, finishDate, book.FinishDate)
+
+	err = data.FinishBook(ctx, tx, userID, book.ID, finishDate)
+	require.ErrorIs(t, err, data.ErrInvalidBookTransition)
+
+	// An abandoned book can be started again.
+	err = data.StartReadingBook(ctx, tx, userID, book.ID, laterDate)
+	require.NoError(t, err)
+
+	book, err = data.GetBook(ctx, tx, userID, book.ID)
+	require.NoError(t, err)
+	require.Equal(t, data.BookStatusReading, book.Status)
+	require.Equal(t, laterDate, book.StartDate)
+	require.True(t, book.FinishDate.IsZero())
+}
+
+func TestSearchBooks(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	for _, book := range []data.Book{
+		{UserID: userID, Title: "Paradise Lost", Author: "John Milton", Review: "Better than the sequel."},
+		{UserID: userID, Title: "Paradise Regained", Author: "John Milton", Location: "Library"},
+		{UserID: userID, Title: "Napoleon", Author: "Adam Zamoyski", Review: "A paradise for history fans."},
+		{UserID: otherUserID, Title: "Paradise Lost", Author: "John Milton"},
+	} {
+		book.FinishDate = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+		book.Format = "text"
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	results, err := data.SearchBooks(ctx, tx, userID, "parad", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	// Title matches rank above review matches.
+	require.Equal(t, "Napoleon", results[2].Book.Title)
+	for _, r := range results {
+		require.Equal(t, userID, r.Book.UserID)
+		if r.Book.Title == "Paradise Lost" {
+			require.Equal(t, data.HighlightStart+"Paradise"+data.HighlightStop+" Lost", r.Title)
+		}
+	}
+
+	results, err = data.SearchBooks(ctx, tx, userID, "milton regain", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "Paradise Regained", results[0].Book.Title)
+
+	results, err = data.SearchBooks(ctx, tx, userID, "histor", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Contains(t, results[0].Snippet, data.HighlightStart+"history"+data.HighlightStop)
+
+	results, err = data.SearchBooks(ctx, tx, userID, `'&|!:*()`, 10)
+	require.NoError(t, err)
+	require.Len(t, results, 0)
+}
+
+func TestGetBooksPage(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	for _, book := range []data.Book{
+		{Title: "Emma", Author: "Jane Austen", Format: "text", Location: "Library", FinishDate: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Title: "Persuasion", Author: "Jane Austen", Format: "audio", FinishDate: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Title: "Dracula", Author: "Bram Stoker", Format: "text", FinishDate: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Title: "Beowulf", Author: "Unknown", Format: "text", FinishDate: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{Title: "Ulysses", Author: "James Joyce", Format: "text", Status: data.BookStatusReading},
+	} {
+		book.UserID = userID
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	titles := func(books []*data.Book) []string {
+		var ts []string
+		for _, b := range books {
+			ts = append(ts, b.Title)
+		}
+		return ts
+	}
+
+	finished := data.BookFilter{Status: data.BookStatusFinished}
+
+	page, err := data.GetBooksPage(ctx, tx, userID, finished, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Beowulf", "Dracula", "Emma", "Persuasion"}, titles(page.Books))
+	require.Empty(t, page.NextCursor)
+
+	// Walk every sort two books at a time and ensure pages join up without gaps or duplicates.
+	for _, sort := range data.BookSorts {
+		all, err := data.GetBooksPage(ctx, tx, userID, finished, sort, "", 10)
+		require.NoError(t, err)
+
+		var paged []*data.Book
+		cursor := ""
+		for {
+			page, err := data.GetBooksPage(ctx, tx, userID, finished, sort, cursor, 2)
+			require.NoError(t, err)
+			paged = append(paged, page.Books...)
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		require.Equal(t, titles(all.Books), titles(paged), sort)
+	}
+
+	page, err = data.GetBooksPage(ctx, tx, userID, data.BookFilter{Status: data.BookStatusFinished, Author: "austen"}, data.BookSortFinishDate, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Persuasion", "Emma"}, titles(page.Books))
+
+	page, err = data.GetBooksPage(ctx, tx, userID, data.BookFilter{Status: data.BookStatusFinished, Format: "text", FromYear: 2019, ToYear: 2020}, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Beowulf", "Dracula"}, titles(page.Books))
+
+	page, err = data.GetBooksPage(ctx, tx, userID, data.BookFilter{Status: data.BookStatusFinished, Location: "libr"}, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Emma"}, titles(page.Books))
+
+	page, err = data.GetBooksPage(ctx, tx, userID, data.BookFilter{Status: data.BookStatusFinished, Author: "100%_"}, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Empty(t, page.Books)
+
+	_, err = data.GetBooksPage(ctx, tx, userID, finished, data.BookSortTitle, "not a cursor", 10)
+	require.ErrorIs(t, err, data.ErrInvalidBookCursor)
+
+	// Well framed cursors whose key cannot be cast for the sort.
+	for sort, key := range map[string]string{
+		data.BookSortFinishDate: "abc",
+		data.BookSortInsertTime: "2020-01-02",
+		data.BookSortTitle:      "\xff",
+	} {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(key + "\x00" + "1"))
+		_, err = data.GetBooksPage(ctx, tx, userID, finished, sort, cursor, 10)
+		require.ErrorIs(t, err, data.ErrInvalidBookCursor, sort)
+	}
+}
+
+func TestBookValidateISBN(t *testing.T) {
+	for _, tt := range []struct {
+		isbn     string
+		expected string
+		valid    bool
+	}{
+		{"", "", true},
+		{"0-14-042439-3", "0140424393", true},
+		{"978-0-14-042439-3", "9780140424393", true},
+		{"080442957x", "080442957X", true},
+		{"12345", "12345", false},
+		{"X804429570", "X804429570", false},
+	} {
+		book := data.Book{
+			Title:      "Paradise Lost",
+			Author:     "John Milton",
+			Status:     data.BookStatusFinished,
+			FinishDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			Format:     "text",
+			ISBN:       tt.isbn,
+		}
+		book.Normalize()
+		require.Equal(t, tt.expected, book.ISBN)
+		if tt.isbn != "" {
+			require.Equal(t, tt.valid, data.IsISBN(tt.isbn), "isbn %v", tt.isbn)
+		}
+
+		verr := book.Validate(time.Now())
+		if tt.valid {
+			require.Nil(t, verr, "isbn %v", tt.isbn)
+		} else {
+			require.NotNil(t, verr, "isbn %v", tt.isbn)
+			require.Len(t, verr.Get("isbn"), 1)
+		}
+	}
+}
+
+func TestBooksVisibleRowLevelSecurity(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	publicBook, err := data.CreateBook(ctx, tx, data.Book{
+		UserID: userID, Title: "Paradise Lost", Author: "John Milton", Status: data.BookStatusFinished,
+		FinishDate: date(2019, 1, 1), Format: "text", Tags: []string{"poetry"},
+	}, time.Now())
+	require.NoError(t, err)
+
+	privateBook, err := data.CreateBook(ctx, tx, data.Book{
+		UserID: userID, Title: "Secret Diary", Author: "Anonymous", Status: data.BookStatusFinished,
+		FinishDate: date(2019, 2, 1), Format: "text", Tags: []string{"secret"}, Private: true,
+	}, time.Now())
+	require.NoError(t, err)
+
+	book, err := data.GetBook(ctx, tx, userID, privateBook.ID)
+	require.NoError(t, err)
+	require.True(t, book.Private)
+
+	// Act as the application role with no user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	visibleTitles := func(visibility string) []string {
+		_, err := tx.Exec(ctx, "reset role")
+		require.NoError(t, err)
+		err = data.SetUserVisibility(ctx, tx, userID, visibility)
+		require.NoError(t, err)
+		testutil.SetAppRole(t, ctx, tx)
+
+		page, err := data.GetBooksPage(ctx, tx, userID, data.BookFilter{}, data.BookSortTitle, "", 10)
+		require.NoError(t, err)
+		titles := []string{}
+		for _, book := range page.Books {
+			titles = append(titles, book.Title)
+		}
+		return titles
+	}
+
+	require.Empty(t, visibleTitles(data.UserVisibilityPrivate))
+	require.Equal(t, []string{"Paradise Lost"}, visibleTitles(data.UserVisibilityUnlisted))
+	require.Equal(t, []string{"Paradise Lost"}, visibleTitles(data.UserVisibilityPublic))
+
+	_, err = data.GetBook(ctx, tx, userID, publicBook.ID)
+	require.NoError(t, err)
+	_, err = data.GetBook(ctx, tx, userID, privateBook.ID)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	var tags []string
+	err = tx.QueryRow(ctx, "select coalesce(array_agg(name order by name), '{}') from tags").Scan(&tags)
+	require.NoError(t, err)
+	require.Equal(t, []string{"poetry"}, tags)
+
+	// Visitors can read but not change visible books.
+	err = data.DeleteBook(ctx, tx, userID, publicBook.ID)
+	require.IsType(t, &data.NotFoundError{}, err)
+
+	// The owner sees every book and can exclude private books explicitly.
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", userID)
+	require.NoError(t, err)
+
+	page, err := data.GetBooksPage(ctx, tx, userID, data.BookFilter{}, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.Books, 2)
+
+	page, err = data.GetBooksPage(ctx, tx, userID, data.BookFilter{ExcludePrivate: true}, data.BookSortTitle, "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.Books, 1)
+	require.Equal(t, "Paradise Lost", page.Books[0].Title)
+}
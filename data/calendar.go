@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResetCalendarToken creates a new calendar token for userID. Any existing token is replaced so links using it stop
+// working.
+func ResetCalendarToken(ctx context.Context, db dbconn, userID int64) (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+	err = db.QueryRow(ctx,
+		`insert into calendar_tokens(user_id, token) values($1, $2)
+on conflict (user_id) do update set token=excluded.token, insert_time=excluded.insert_time
+returning token`,
+		userID, base64.RawURLEncoding.EncodeToString(buf),
+	).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetCalendarToken returns the calendar token of userID. It returns a NotFoundError if userID does not have one.
+func GetCalendarToken(ctx context.Context, db dbconn, userID int64) (string, error) {
+	var token string
+	err := db.QueryRow(ctx, "select token from calendar_tokens where user_id=$1", userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", &NotFoundError{target: fmt.Sprintf("calendar token user_id=%d", userID)}
+		}
+		return "", err
+	}
+
+	return token, nil
+}
+
+// DeleteCalendarToken deletes the calendar token of userID. It returns a NotFoundError if userID does not have one.
+func DeleteCalendarToken(ctx context.Context, db dbconn, userID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from calendar_tokens where user_id=$1", userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("calendar token user_id=%d", userID)}
+	}
+	return nil
+}
+
+// IsCalendarToken returns true if token is the calendar token of userID. It uses the is_calendar_token function because
+// row-level security prevents calendar applications from reading tokens.
+func IsCalendarToken(ctx context.Context, db dbconn, userID int64, token string) (bool, error) {
+	var ok bool
+	err := db.QueryRow(ctx, "select is_calendar_token($1, $2)", userID, token).Scan(&ok)
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// GetCalendarBooks returns the finished books of userID for the calendar feed ordered by most recently finished. Private
+// books are never included. If token is empty the books are read subject to row-level security. Otherwise, token must be
+// the calendar token of userID and the books are read with the find_calendar_books function.
+func GetCalendarBooks(ctx context.Context, db dbconn, userID int64, token string) ([]*Book, error) {
+	var rows pgx.Rows
+	if token == "" {
+		rows, _ = db.Query(ctx, `select `+bookColumns+`
+from books
+where user_id=$1 and status='finished' and not private
+order by finish_date desc, insert_time desc, id desc`,
+			userID)
+	} else {
+		rows, _ = db.Query(ctx, `select `+bookColumns+`
+from find_calendar_books($1, $2) as books
+order by finish_date desc, insert_time desc, id desc`,
+			userID, token)
+	}
+	return pgx.CollectRows(rows, RowToAddrOfBook)
+}
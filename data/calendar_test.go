@@ -0,0 +1,97 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarTokens(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID, otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	_, err = data.CreateBook(ctx, tx, data.Book{UserID: userID, Title: "Emma", Author: "Jane Austen", Status: data.BookStatusFinished, FinishDate: date(2020, 3, 1), Format: "text"}, time.Now())
+	require.NoError(t, err)
+	_, err = data.CreateBook(ctx, tx, data.Book{UserID: userID, Title: "Diary", Author: "Anonymous", Status: data.BookStatusFinished, FinishDate: date(2020, 4, 1), Format: "text", Private: true}, time.Now())
+	require.NoError(t, err)
+	_, err = data.CreateBook(ctx, tx, data.Book{UserID: userID, Title: "Ulysses", Author: "James Joyce", Status: data.BookStatusReading, Format: "text"}, time.Now())
+	require.NoError(t, err)
+
+	var nfErr *data.NotFoundError
+	_, err = data.GetCalendarToken(ctx, tx, userID)
+	require.ErrorAs(t, err, &nfErr)
+
+	token, err := data.ResetCalendarToken(ctx, tx, userID)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	storedToken, err := data.GetCalendarToken(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, token, storedToken)
+
+	// Act as the application role with no user authenticated like a calendar application.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	ok, err := data.IsCalendarToken(ctx, tx, userID, token)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = data.IsCalendarToken(ctx, tx, otherUserID, token)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	books, err := data.GetCalendarBooks(ctx, tx, userID, token)
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	require.Equal(t, "Emma", books[0].Title)
+
+	books, err = data.GetCalendarBooks(ctx, tx, userID, "")
+	require.NoError(t, err)
+	require.Empty(t, books, "row-level security hides the books of private users without the token")
+
+	books, err = data.GetCalendarBooks(ctx, tx, userID, "wrong")
+	require.NoError(t, err)
+	require.Empty(t, books)
+
+	// Resetting the token makes the old token stop working.
+	_, err = tx.Exec(ctx, "reset role")
+	require.NoError(t, err)
+	newToken, err := data.ResetCalendarToken(ctx, tx, userID)
+	require.NoError(t, err)
+	require.NotEqual(t, token, newToken)
+
+	ok, err = data.IsCalendarToken(ctx, tx, userID, token)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, data.DeleteCalendarToken(ctx, tx, userID))
+	require.ErrorAs(t, data.DeleteCalendarToken(ctx, tx, userID), &nfErr)
+
+	ok, err = data.IsCalendarToken(ctx, tx, userID, newToken)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -3,9 +3,11 @@ package data
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type dbconn interface {
@@ -19,10 +21,26 @@ type scanner interface {
 	Scan(...interface{}) error
 }
 
-func createUserSession(ctx context.Context, db dbconn, userID int64) ([16]byte, error) {
-	var userSessionID [16]byte
-	err := db.QueryRow(ctx, "insert into user_sessions(user_id) values ($1) returning id", userID).Scan(&userSessionID)
-	return userSessionID, err
+// zeronullDate maps the zero time.Time to and from NULL for date columns in the same manner as the types in
+// github.com/jackc/pgx/v5/pgtype/zeronull.
+type zeronullDate time.Time
+
+func (d *zeronullDate) ScanDate(v pgtype.Date) error {
+	if !v.Valid {
+		*d = zeronullDate{}
+		return nil
+	}
+
+	*d = zeronullDate(v.Time)
+	return nil
+}
+
+func (d zeronullDate) DateValue() (pgtype.Date, error) {
+	if time.Time(d).IsZero() {
+		return pgtype.Date{}, nil
+	}
+
+	return pgtype.Date{Time: time.Time(d), Valid: true}, nil
 }
 
 type NotFoundError struct {
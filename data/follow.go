@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Follow makes followerID follow followeeID. Following a user that is already followed does nothing. It returns a
+// NotFoundError if followeeID does not exist, is followerID, or is private.
+func Follow(ctx context.Context, db dbconn, followerID, followeeID int64) error {
+	commandTag, err := db.Exec(ctx,
+		`insert into follows(follower_id, followee_id)
+select $1, id from users where id=$2 and id<>$1 and visibility in ('unlisted', 'public')
+on conflict (follower_id, followee_id) do nothing`,
+		followerID, followeeID,
+	)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		following, err := IsFollowing(ctx, db, followerID, followeeID)
+		if err != nil {
+			return err
+		}
+		if !following {
+			return &NotFoundError{target: fmt.Sprintf("followable user id=%d", followeeID)}
+		}
+	}
+
+	return nil
+}
+
+// Unfollow makes followerID stop following followeeID. It returns a NotFoundError if followerID is not following
+// followeeID.
+func Unfollow(ctx context.Context, db dbconn, followerID, followeeID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from follows where follower_id=$1 and followee_id=$2", followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("follow follower_id=%d followee_id=%d", followerID, followeeID)}
+	}
+	return nil
+}
+
+// IsFollowing returns true if followerID follows followeeID.
+func IsFollowing(ctx context.Context, db dbconn, followerID, followeeID int64) (bool, error) {
+	var following bool
+	err := db.QueryRow(ctx,
+		"select exists(select 1 from follows where follower_id=$1 and followee_id=$2)",
+		followerID, followeeID,
+	).Scan(&following)
+	return following, err
+}
+
+// GetFollowedUsers returns the users followed by followerID ordered by username. Users who have since made their books
+// private are included so they can be unfollowed.
+func GetFollowedUsers(ctx context.Context, db dbconn, followerID int64) ([]*UserMin, error) {
+	rows, _ := db.Query(ctx, `select users.id, users.username, users.time_zone, users.visibility
+from follows
+	join users on follows.followee_id=users.id
+where follows.follower_id=$1
+order by lower(users.username)`,
+		followerID)
+	return pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[UserMin])
+}
+
+// FeedItem is a book finished by a followed user.
+type FeedItem struct {
+	Username string
+	Book     *Book
+}
+
+type FeedPage struct {
+	Items      []*FeedItem
+	NextCursor string // Empty if this is the last page.
+}
+
+// GetFeedPage returns up to limit books finished by the users followed by followerID ordered by most recently finished.
+// cursor is the NextCursor of the previous page or empty for the first page. Private books and the books of users who
+// are no longer visible are excluded.
+func GetFeedPage(ctx context.Context, db dbconn, followerID int64, cursor string, limit int) (*FeedPage, error) {
+	args := []any{followerID}
+	sb := &strings.Builder{}
+	sb.WriteString(`select (select username from users where users.id=books.user_id), ` + bookColumns + `
+from books
+where user_id in (
+		select followee_id from follows where follower_id=$1
+			and followee_id in (select id from users where visibility in ('unlisted', 'public'))
+	)
+	and status='finished'
+	and not private`)
+
+	if cursor != "" {
+		finishDate, insertTime, id, err := decodeFeedCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, finishDate, insertTime, id)
+		sb.WriteString("\n\tand (finish_date, insert_time, id) < ($2::date, $3::timestamptz, $4)")
+	}
+
+	args = append(args, limit+1)
+	fmt.Fprintf(sb, "\norder by finish_date desc, insert_time desc, id desc\nlimit $%d", len(args))
+
+	rows, _ := db.Query(ctx, sb.String(), args...)
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*FeedItem, error) {
+		item := &FeedItem{Book: &Book{}}
+		err := row.Scan(append([]any{&item.Username}, bookScanTargets(item.Book)...)...)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &FeedPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		last := page.Items[limit-1].Book
+		page.NextCursor = encodeFeedCursor(last.FinishDate, last.InsertTime, last.ID)
+	}
+
+	return page, nil
+}
+
+const feedCursorDateLayout = "2006-01-02"
+
+func encodeFeedCursor(finishDate, insertTime time.Time, id int64) string {
+	key := finishDate.Format(feedCursorDateLayout) + " " + insertTime.UTC().Format(time.RFC3339Nano)
+	return encodeBookCursor(key, id)
+}
+
+func decodeFeedCursor(cursor string) (string, time.Time, int64, error) {
+	key, id, err := decodeBookCursor(cursor)
+	if err != nil {
+		return "", time.Time{}, 0, err
+	}
+
+	finishDate, insertTimeStr, found := strings.Cut(key, " ")
+	if !found {
+		return "", time.Time{}, 0, ErrInvalidBookCursor
+	}
+
+	_, err = time.Parse(feedCursorDateLayout, finishDate)
+	if err != nil {
+		return "", time.Time{}, 0, ErrInvalidBookCursor
+	}
+
+	insertTime, err := time.Parse(time.RFC3339Nano, insertTimeStr)
+	if err != nil {
+		return "", time.Time{}, 0, ErrInvalidBookCursor
+	}
+
+	return finishDate, insertTime, id, nil
+}
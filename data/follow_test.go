@@ -0,0 +1,162 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	userIDs := map[string]int64{}
+	for _, u := range []struct{ username, visibility string }{
+		{"reader", data.UserVisibilityPrivate},
+		{"public", data.UserVisibilityPublic},
+		{"unlisted", data.UserVisibilityUnlisted},
+		{"private", data.UserVisibilityPrivate},
+	} {
+		var id int64
+		err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values($1, 'x', $2) returning id", u.username, u.visibility).Scan(&id)
+		require.NoError(t, err)
+		userIDs[u.username] = id
+	}
+	readerID := userIDs["reader"]
+
+	require.NoError(t, data.Follow(ctx, tx, readerID, userIDs["public"]))
+	require.NoError(t, data.Follow(ctx, tx, readerID, userIDs["public"]), "following again does nothing")
+	require.NoError(t, data.Follow(ctx, tx, readerID, userIDs["unlisted"]))
+
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, data.Follow(ctx, tx, readerID, userIDs["private"]), &nfErr)
+	require.ErrorAs(t, data.Follow(ctx, tx, readerID, readerID), &nfErr)
+	require.ErrorAs(t, data.Follow(ctx, tx, readerID, -1), &nfErr)
+
+	following, err := data.IsFollowing(ctx, tx, readerID, userIDs["public"])
+	require.NoError(t, err)
+	require.True(t, following)
+
+	following, err = data.IsFollowing(ctx, tx, userIDs["public"], readerID)
+	require.NoError(t, err)
+	require.False(t, following)
+
+	// Users who have made their books private are still listed so they can be unfollowed.
+	require.NoError(t, data.SetUserVisibility(ctx, tx, userIDs["unlisted"], data.UserVisibilityPrivate))
+
+	users, err := data.GetFollowedUsers(ctx, tx, readerID)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.Equal(t, "public", users[0].Username)
+	require.Equal(t, "unlisted", users[1].Username)
+	require.False(t, users[1].IsVisible())
+
+	require.NoError(t, data.Unfollow(ctx, tx, readerID, userIDs["unlisted"]))
+	require.ErrorAs(t, data.Unfollow(ctx, tx, readerID, userIDs["unlisted"]), &nfErr)
+}
+
+func TestGetFeedPage(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var readerID, aliceID, bobID, carolID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('reader', 'x') returning id").Scan(&readerID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values('alice', 'x', 'public') returning id").Scan(&aliceID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values('bob', 'x', 'unlisted') returning id").Scan(&bobID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values('carol', 'x', 'public') returning id").Scan(&carolID)
+	require.NoError(t, err)
+
+	insertTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, b := range []struct {
+		userID     int64
+		title      string
+		status     string
+		finishDate time.Time
+		private    bool
+	}{
+		{aliceID, "Emma", data.BookStatusFinished, date(2020, 3, 1), false},
+		{aliceID, "Persuasion", data.BookStatusFinished, date(2020, 3, 1), false},
+		{aliceID, "Diary", data.BookStatusFinished, date(2020, 4, 1), true},
+		{aliceID, "Ulysses", data.BookStatusReading, time.Time{}, false},
+		{bobID, "Dubliners", data.BookStatusFinished, date(2020, 2, 1), false},
+		{bobID, "Hamlet", data.BookStatusFinished, date(2020, 5, 1), false},
+		{carolID, "Walden", data.BookStatusFinished, date(2020, 6, 1), false},
+	} {
+		insertTime = insertTime.Add(time.Hour)
+		_, err = data.CreateBook(ctx, tx, data.Book{
+			UserID: b.userID, Title: b.title, Author: "Author", Status: b.status, FinishDate: b.finishDate,
+			Format: "text", Private: b.private, InsertTime: insertTime, UpdateTime: insertTime,
+		}, time.Now())
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, data.Follow(ctx, tx, readerID, aliceID))
+	require.NoError(t, data.Follow(ctx, tx, readerID, bobID))
+
+	// Act as the application role with the reader authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", readerID)
+	require.NoError(t, err)
+
+	var items []string
+	cursor := ""
+	for {
+		page, err := data.GetFeedPage(ctx, tx, readerID, cursor, 2)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Items), 2)
+		for _, item := range page.Items {
+			items = append(items, item.Username+": "+item.Book.Title)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	// Ties on finish date are broken by the most recently inserted book.
+	require.Equal(t, []string{"bob: Hamlet", "alice: Persuasion", "alice: Emma", "bob: Dubliners"}, items)
+
+	_, err = data.GetFeedPage(ctx, tx, readerID, "not a cursor", 2)
+	require.ErrorIs(t, err, data.ErrInvalidBookCursor)
+
+	// Books of followed users who make their books private disappear from the feed.
+	_, err = tx.Exec(ctx, "reset role")
+	require.NoError(t, err)
+	require.NoError(t, data.SetUserVisibility(ctx, tx, bobID, data.UserVisibilityPrivate))
+	testutil.SetAppRole(t, ctx, tx)
+
+	page, err := data.GetFeedPage(ctx, tx, readerID, "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, "alice", page.Items[0].Username)
+	require.Equal(t, "alice", page.Items[1].Username)
+}
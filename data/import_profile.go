@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgxutil"
+)
+
+// ImportFields are the book fields a CSV column can be mapped to. They are the same names used for validation errors.
+var ImportFields = []string{"title", "author", "status", "startDate", "finishDate", "format", "location", "rating", "review", "tags", "isbn", "pageCount"}
+
+// ImportDateLayouts are the time.Parse layouts that can be chosen for the dates in a CSV file. The empty layout accepts
+// the formats accepted by the book form.
+var ImportDateLayouts = []string{"", "2006-01-02", "1/2/2006", "2/1/2006", "2006/01/02", "02.01.2006", "Jan 2, 2006", "January 2, 2006", "2 Jan 2006"}
+
+// ImportMapping maps the columns of a CSV file to book fields.
+type ImportMapping struct {
+	Columns       map[string]string `json:"columns"` // Header name to field in ImportFields. Unmapped columns are ignored.
+	DateLayout    string            `json:"dateLayout"`
+	DefaultFormat string            `json:"defaultFormat"` // Used when the format column is not mapped or is blank.
+}
+
+func (m *ImportMapping) Validate() *errortree.Node {
+	v := validate.New()
+
+	mappedFields := make(map[string]struct{}, len(m.Columns))
+	for _, field := range m.Columns {
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(ImportFields, field) {
+			v.Add("columns", fmt.Errorf("%q is not a book field", field))
+		} else if _, ok := mappedFields[field]; ok {
+			v.Add("columns", fmt.Errorf("%s is mapped to more than one column", field))
+		}
+		mappedFields[field] = struct{}{}
+	}
+
+	for _, field := range []string{"title", "author"} {
+		if _, ok := mappedFields[field]; !ok {
+			v.Add("columns", fmt.Errorf("%s must be mapped to a column", field))
+		}
+	}
+
+	if !slices.Contains(ImportDateLayouts, m.DateLayout) {
+		v.Add("dateLayout", errors.New("is not a supported date format"))
+	}
+
+	if !slices.Contains([]string{"text", "audio", "video"}, m.DefaultFormat) {
+		v.Add("defaultFormat", errors.New(`must be "text", "audio", or "video"`))
+	}
+
+	if v.Err() != nil {
+		return v.Err().(*errortree.Node)
+	}
+
+	return nil
+}
+
+// Matches returns true if every column mapped by m is in header.
+func (m *ImportMapping) Matches(header []string) bool {
+	for column, field := range m.Columns {
+		if field != "" && !slices.Contains(header, column) {
+			return false
+		}
+	}
+	return true
+}
+
+type ImportProfile struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Mapping    ImportMapping
+	InsertTime time.Time
+	UpdateTime time.Time
+}
+
+// SaveImportProfile creates or replaces the import profile owned by userID named name. Names are case insensitive.
+func SaveImportProfile(ctx context.Context, db dbconn, userID int64, name string, mapping ImportMapping) (*ImportProfile, error) {
+	name = strings.TrimSpace(name)
+
+	v := validate.New()
+	v.Presence("name", name)
+	v.MaxLength("name", name, 100)
+	if verr := mapping.Validate(); verr != nil {
+		v.Add("mapping", verr)
+	}
+	if v.Err() != nil {
+		return nil, v.Err()
+	}
+
+	profile := &ImportProfile{UserID: userID, Name: name, Mapping: mapping}
+	err := db.QueryRow(ctx,
+		`insert into import_profiles(user_id, name, mapping) values($1, $2, $3)
+on conflict (user_id, lower(name)) do update set name=excluded.name, mapping=excluded.mapping
+returning id, insert_time, update_time`,
+		userID, name, mapping,
+	).Scan(&profile.ID, &profile.InsertTime, &profile.UpdateTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// GetImportProfiles returns all import profiles owned by userID ordered by name.
+func GetImportProfiles(ctx context.Context, db dbconn, userID int64) ([]*ImportProfile, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		"select id, user_id, name, mapping, insert_time, update_time from import_profiles where user_id=$1 order by lower(name)",
+		[]any{userID},
+		pgx.RowToAddrOfStructByPos[ImportProfile],
+	)
+}
+
+// DeleteImportProfile deletes the import profile specified by profileID owned by userID. It returns a NotFoundError if
+// the profile cannot be found or is owned by another user.
+func DeleteImportProfile(ctx context.Context, db dbconn, userID, profileID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from import_profiles where id=$1 and user_id=$2", profileID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("import profile id=%d", profileID)}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportMappingValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := data.ImportMapping{
+		Columns:       map[string]string{"Name": "title", "Writer": "author", "Notes": ""},
+		DateLayout:    "1/2/2006",
+		DefaultFormat: "text",
+	}
+	require.Nil(t, valid.Validate())
+
+	for i, tt := range []struct {
+		mapping data.ImportMapping
+		attr    string
+	}{
+		{data.ImportMapping{Columns: map[string]string{"Name": "title"}, DefaultFormat: "text"}, "columns"},
+		{data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author", "By": "author"}, DefaultFormat: "text"}, "columns"},
+		{data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author", "X": "publisher"}, DefaultFormat: "text"}, "columns"},
+		{data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author"}, DateLayout: "2006", DefaultFormat: "text"}, "dateLayout"},
+		{data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author"}}, "defaultFormat"},
+	} {
+		verr := tt.mapping.Validate()
+		require.NotNilf(t, verr, "%d", i)
+		require.Lenf(t, verr.Get(tt.attr), 1, "%d", i)
+	}
+}
+
+func TestImportMappingMatches(t *testing.T) {
+	t.Parallel()
+
+	mapping := data.ImportMapping{Columns: map[string]string{"Name": "title", "Writer": "author", "Notes": ""}}
+	require.True(t, mapping.Matches([]string{"Writer", "Name", "Other"}))
+	require.False(t, mapping.Matches([]string{"Name", "Other"}))
+}
+
+func TestImportProfiles(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	mapping := data.ImportMapping{
+		Columns:       map[string]string{"Name": "title", "Writer": "author"},
+		DateLayout:    "2/1/2006",
+		DefaultFormat: "audio",
+	}
+
+	_, err = data.SaveImportProfile(ctx, tx, userID, " ", mapping)
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("name"), 1)
+
+	profile, err := data.SaveImportProfile(ctx, tx, userID, " Library ", mapping)
+	require.NoError(t, err)
+	require.Equal(t, "Library", profile.Name)
+
+	// Saving with the same name in a different case replaces the profile.
+	mapping.DefaultFormat = "text"
+	replaced, err := data.SaveImportProfile(ctx, tx, userID, "LIBRARY", mapping)
+	require.NoError(t, err)
+	require.Equal(t, profile.ID, replaced.ID)
+
+	_, err = data.SaveImportProfile(ctx, tx, otherUserID, "Library", mapping)
+	require.NoError(t, err)
+
+	profiles, err := data.GetImportProfiles(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Len(t, profiles, 1)
+	require.Equal(t, "LIBRARY", profiles[0].Name)
+	require.Equal(t, mapping, profiles[0].Mapping)
+
+	bookImport, err := data.CreateBookImport(ctx, tx, userID, "books.csv", [][]string{{"Name", "Writer"}, {"Dune", "Frank Herbert"}})
+	require.NoError(t, err)
+	require.Nil(t, bookImport.Mapping)
+
+	err = data.SetBookImportMapping(ctx, tx, userID, bookImport.ID, data.ImportMapping{DefaultFormat: "text"})
+	require.ErrorAs(t, err, &verr)
+
+	err = data.SetBookImportMapping(ctx, tx, otherUserID, bookImport.ID, mapping)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+
+	err = data.SetBookImportMapping(ctx, tx, userID, bookImport.ID, mapping)
+	require.NoError(t, err)
+
+	bookImport, err = data.GetBookImport(ctx, tx, userID, bookImport.ID)
+	require.NoError(t, err)
+	require.Equal(t, &mapping, bookImport.Mapping)
+
+	err = data.DeleteImportProfile(ctx, tx, otherUserID, profile.ID)
+	require.ErrorAs(t, err, &nfErr)
+
+	err = data.DeleteImportProfile(ctx, tx, userID, profile.ID)
+	require.NoError(t, err)
+
+	profiles, err = data.GetImportProfiles(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Empty(t, profiles)
+}
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype/zeronull"
+	"github.com/jackc/pgxutil"
+)
+
+// ReadingGoal is a target number of books to finish in a calendar year.
+type ReadingGoal struct {
+	ID         int64
+	UserID     int64
+	Year       int32
+	Format     string // Empty means books of any format.
+	Target     int32
+	InsertTime time.Time
+	UpdateTime time.Time
+}
+
+func (goal *ReadingGoal) Validate() *errortree.Node {
+	v := validate.New()
+
+	if goal.Year < 1900 || goal.Year > 9999 {
+		v.Add("year", errors.New("must be from 1900 to 9999"))
+	}
+
+	if goal.Format != "" && !slices.Contains([]string{"text", "audio", "video"}, goal.Format) {
+		v.Add("format", errors.New(`must be "text", "audio", or "video"`))
+	}
+
+	if goal.Target < 1 || goal.Target > 10000 {
+		v.Add("target", errors.New("must be from 1 to 10000"))
+	}
+
+	if v.Err() != nil {
+		return v.Err().(*errortree.Node)
+	}
+
+	return nil
+}
+
+// SaveReadingGoal creates the reading goal for goal's user, year, and format or replaces the target of the existing one.
+func SaveReadingGoal(ctx context.Context, db dbconn, goal ReadingGoal) (*ReadingGoal, error) {
+	if verr := goal.Validate(); verr != nil {
+		return nil, verr
+	}
+
+	err := db.QueryRow(ctx,
+		`insert into reading_goals(user_id, year, format, target) values($1, $2, $3, $4)
+on conflict (user_id, year, coalesce(format, '')) do update set target=excluded.target
+returning id, insert_time, update_time`,
+		goal.UserID, goal.Year, zeronull.Text(goal.Format), goal.Target,
+	).Scan(&goal.ID, &goal.InsertTime, &goal.UpdateTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goal, nil
+}
+
+// GetReadingGoals returns the reading goals owned by userID for year. The goal for any format is first followed by
+// goals for specific formats ordered by format.
+func GetReadingGoals(ctx context.Context, db dbconn, userID int64, year int32) ([]*ReadingGoal, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		`select id, user_id, year, coalesce(format, ''), target, insert_time, update_time
+from reading_goals
+where user_id=$1 and year=$2
+order by format nulls first`,
+		[]any{userID, year},
+		pgx.RowToAddrOfStructByPos[ReadingGoal],
+	)
+}
+
+// DeleteReadingGoal deletes the reading goal specified by goalID owned by userID. It returns a NotFoundError if the goal
+// cannot be found or is owned by another user.
+func DeleteReadingGoal(ctx context.Context, db dbconn, userID, goalID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from reading_goals where id=$1 and user_id=$2", goalID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("reading goal id=%d", goalID)}
+	}
+	return nil
+}
+
+// BooksPerFormatInYear returns the number of books owned by userID finished in year in each format ordered by most
+// books.
+func BooksPerFormatInYear(ctx context.Context, db dbconn, userID int64, year int32) ([]FormatCount, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		`select format, count(*)
+from books
+where user_id=$1 and status='finished' and extract(year from finish_date)=$2
+group by 1
+order by 2 desc, 1`,
+		[]any{userID, year},
+		pgx.RowToStructByPos[FormatCount],
+	)
+}
+
+// ReadingGoalProgress is the progress toward a ReadingGoal as of a day.
+type ReadingGoalProgress struct {
+	Goal      *ReadingGoal
+	Completed int32   // Books finished in the year of the goal.
+	Expected  float64 // Books that would be finished by the day at an even pace.
+	Projected int32   // Books that will be finished by the end of the year if the current pace continues.
+}
+
+// NewReadingGoalProgress returns the progress toward goal with completed books as of today. Only the date of today is
+// used. The year of the goal is complete if today is after it and not yet started if today is before it.
+func NewReadingGoalProgress(goal *ReadingGoal, completed int32, today time.Time) ReadingGoalProgress {
+	yearStart := time.Date(int(goal.Year), 1, 1, 0, 0, 0, 0, time.UTC)
+	daysInYear := yearStart.AddDate(1, 0, 0).Sub(yearStart).Hours() / 24
+
+	// Today counts as elapsed so a book finished today is not ahead of pace.
+	todayDate := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	elapsedDays := todayDate.Sub(yearStart).Hours()/24 + 1
+	elapsedDays = min(max(elapsedDays, 0), daysInYear)
+
+	progress := ReadingGoalProgress{
+		Goal:      goal,
+		Completed: completed,
+		Expected:  float64(goal.Target) * elapsedDays / daysInYear,
+		Projected: completed,
+	}
+	if elapsedDays > 0 {
+		progress.Projected = int32(math.Round(float64(completed) * daysInYear / elapsedDays))
+	}
+
+	return progress
+}
+
+// Percent returns the percentage of the goal that is complete. It is at most 100.
+func (p ReadingGoalProgress) Percent() int {
+	return min(int(p.Completed*100/p.Goal.Target), 100)
+}
+
+// PaceDifference returns the number of whole books the completed count is ahead (positive) or behind (negative) of an
+// even pace.
+func (p ReadingGoalProgress) PaceDifference() int {
+	return int(math.Floor(float64(p.Completed) - p.Expected + 0.5))
+}
@@ -0,0 +1,138 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadingGoalValidate(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, (&data.ReadingGoal{Year: 2020, Target: 52}).Validate())
+	require.Nil(t, (&data.ReadingGoal{Year: 2020, Format: "audio", Target: 1}).Validate())
+
+	for i, tt := range []struct {
+		goal data.ReadingGoal
+		attr string
+	}{
+		{data.ReadingGoal{Year: 20, Target: 52}, "year"},
+		{data.ReadingGoal{Year: 2020, Format: "paper", Target: 52}, "format"},
+		{data.ReadingGoal{Year: 2020, Target: 0}, "target"},
+		{data.ReadingGoal{Year: 2020, Target: 10001}, "target"},
+	} {
+		verr := tt.goal.Validate()
+		require.NotNilf(t, verr, "%d", i)
+		require.Lenf(t, verr.Get(tt.attr), 1, "%d", i)
+	}
+}
+
+func TestNewReadingGoalProgress(t *testing.T) {
+	t.Parallel()
+
+	goal := &data.ReadingGoal{Year: 2021, Target: 52}
+
+	progress := data.NewReadingGoalProgress(goal, 10, time.Date(2021, 3, 1, 23, 0, 0, 0, time.UTC))
+	require.InDelta(t, 52.0*60/365, progress.Expected, 0.0001)
+	require.EqualValues(t, 61, progress.Projected)
+	require.Equal(t, 1, progress.PaceDifference())
+	require.Equal(t, 19, progress.Percent())
+
+	progress = data.NewReadingGoalProgress(goal, 5, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, -4, progress.PaceDifference())
+
+	// Before the year starts nothing is expected.
+	progress = data.NewReadingGoalProgress(goal, 0, time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))
+	require.Zero(t, progress.Expected)
+	require.Zero(t, progress.Projected)
+	require.Equal(t, 0, progress.PaceDifference())
+
+	// After the year ends the projection is the final count.
+	progress = data.NewReadingGoalProgress(goal, 60, time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC))
+	require.InDelta(t, 52, progress.Expected, 0.0001)
+	require.EqualValues(t, 60, progress.Projected)
+	require.Equal(t, 8, progress.PaceDifference())
+	require.Equal(t, 100, progress.Percent())
+}
+
+func TestReadingGoals(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	var otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	_, err = data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2020})
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+
+	audioGoal, err := data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2020, Format: "audio", Target: 12})
+	require.NoError(t, err)
+
+	allGoal, err := data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2020, Target: 40})
+	require.NoError(t, err)
+
+	// Saving a goal for the same year and format replaces the target.
+	replaced, err := data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2020, Target: 52})
+	require.NoError(t, err)
+	require.Equal(t, allGoal.ID, replaced.ID)
+
+	_, err = data.SaveReadingGoal(ctx, tx, data.ReadingGoal{UserID: userID, Year: 2021, Target: 10})
+	require.NoError(t, err)
+
+	goals, err := data.GetReadingGoals(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.Len(t, goals, 2)
+	require.Equal(t, allGoal.ID, goals[0].ID)
+	require.Equal(t, "", goals[0].Format)
+	require.EqualValues(t, 52, goals[0].Target)
+	require.Equal(t, audioGoal.ID, goals[1].ID)
+	require.Equal(t, "audio", goals[1].Format)
+
+	for _, book := range []data.Book{
+		{Title: "Dune", Author: "Frank Herbert", FinishDate: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), Format: "text"},
+		{Title: "Emma", Author: "Jane Austen", FinishDate: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Format: "audio"},
+		{Title: "Persuasion", Author: "Jane Austen", FinishDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), Format: "audio"},
+		{Title: "Ulysses", Author: "James Joyce", FinishDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Format: "audio"},
+	} {
+		book.UserID = userID
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	booksPerFormat, err := data.BooksPerFormatInYear(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.Equal(t, []data.FormatCount{{"audio", 2}, {"text", 1}}, booksPerFormat)
+
+	err = data.DeleteReadingGoal(ctx, tx, otherUserID, audioGoal.ID)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+
+	err = data.DeleteReadingGoal(ctx, tx, userID, audioGoal.ID)
+	require.NoError(t, err)
+
+	goals, err = data.GetReadingGoals(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.Len(t, goals, 1)
+}
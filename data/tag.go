@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgxutil"
+)
+
+type TagCount struct {
+	Name  string
+	Count int32
+}
+
+// GetTagCounts returns all tags owned by userID with the number of books tagged with each. Tags are ordered by name.
+func GetTagCounts(ctx context.Context, db dbconn, userID int64) ([]TagCount, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		`select tags.name, count(book_tags.book_id)
+from tags
+	join book_tags on tags.id=book_tags.tag_id
+where tags.user_id=$1
+group by tags.id
+order by lower(tags.name)`,
+		[]any{userID},
+		pgx.RowToStructByPos[TagCount],
+	)
+}
+
+// GetBooksByTag returns the books owned by userID that are tagged with tag. Tags are matched case insensitively. Books
+// are ordered by most recently finished or started.
+func GetBooksByTag(ctx context.Context, db dbconn, userID int64, tag string) ([]*Book, error) {
+	rows, _ := db.Query(ctx, `select `+bookColumns+`
+from books
+where user_id=$1
+	and exists (
+		select 1
+		from book_tags
+			join tags on book_tags.tag_id=tags.id
+		where book_tags.book_id=books.id
+			and lower(tags.name)=lower($2)
+	)
+order by coalesce(finish_date, start_date) desc nulls last, insert_time desc`,
+		userID, tag)
+	return pgx.CollectRows(rows, RowToAddrOfBook)
+}
+
+// ParseTags parses a comma separated list of tags.
+func ParseTags(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// normalizeTags trims whitespace, removes empty tags, and removes case insensitive duplicates.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		key := strings.ToLower(t)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		normalized = append(normalized, t)
+	}
+	return normalized
+}
+
+// setBookTags replaces the tags of the book specified by bookID with tags. Tags that do not exist for userID are created.
+// An existing tag is reused when it matches case insensitively.
+func setBookTags(ctx context.Context, db dbconn, userID, bookID int64, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	_, err := db.Exec(ctx, `insert into tags(user_id, name)
+select $1, name from unnest($2::text[]) name
+on conflict (user_id, lower(name)) do nothing`,
+		userID, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "delete from book_tags where book_id=$1", bookID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `insert into book_tags(book_id, tag_id)
+select $1, id
+from tags
+where user_id=$2
+	and lower(name) in (select lower(name) from unnest($3::text[]) name)`,
+		bookID, userID, tags)
+	return err
+}
@@ -0,0 +1,83 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookNormalizeTags(t *testing.T) {
+	book := data.Book{Tags: data.ParseTags(" history, , History,biography ,")}
+	book.Normalize()
+	require.Equal(t, []string{"history", "biography"}, book.Tags)
+}
+
+func TestBookTags(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	paradiseLost, err := data.CreateBook(ctx, tx, data.Book{
+		UserID:     userID,
+		Title:      "Paradise Lost",
+		Author:     "John Milton",
+		FinishDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Format:     "text",
+		Tags:       []string{"Poetry", "classics"},
+	}, time.Now())
+	require.NoError(t, err)
+
+	_, err = data.CreateBook(ctx, tx, data.Book{
+		UserID:     userID,
+		Title:      "The Odyssey",
+		Author:     "Homer",
+		FinishDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Format:     "audio",
+		Tags:       []string{"poetry"},
+	}, time.Now())
+	require.NoError(t, err)
+
+	book, err := data.GetBook(ctx, tx, userID, paradiseLost.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"classics", "Poetry"}, book.Tags)
+
+	tagCounts, err := data.GetTagCounts(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []data.TagCount{{Name: "classics", Count: 1}, {Name: "Poetry", Count: 2}}, tagCounts)
+
+	books, err := data.GetBooksByTag(ctx, tx, userID, "POETRY")
+	require.NoError(t, err)
+	require.Len(t, books, 2)
+	require.Equal(t, "The Odyssey", books[0].Title)
+	require.Equal(t, "Paradise Lost", books[1].Title)
+
+	book.Tags = []string{"epic"}
+	err = data.UpdateBook(ctx, tx, *book, time.Now())
+	require.NoError(t, err)
+
+	book, err = data.GetBook(ctx, tx, userID, paradiseLost.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"epic"}, book.Tags)
+
+	books, err = data.GetBooksByTag(ctx, tx, userID, "classics")
+	require.NoError(t, err)
+	require.Len(t, books, 0)
+}
@@ -4,18 +4,53 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype/zeronull"
 )
 
+const (
+	UserVisibilityPrivate  = "private"  // Only the user can see their books.
+	UserVisibilityUnlisted = "unlisted" // Anyone with a link can see the user's books that are not private.
+	UserVisibilityPublic   = "public"   // Like unlisted but the user may be listed and indexed by search engines.
+)
+
+// UserVisibilities is all user visibilities in the order they should be presented.
+var UserVisibilities = []string{UserVisibilityPrivate, UserVisibilityUnlisted, UserVisibilityPublic}
+
 type UserMin struct {
-	ID       int64
-	Username string
+	ID         int64
+	Username   string
+	TimeZone   string
+	Visibility string
+}
+
+// IsVisible returns true if the user's books can be seen by visitors.
+func (u *UserMin) IsVisible() bool {
+	return u.Visibility == UserVisibilityUnlisted || u.Visibility == UserVisibilityPublic
+}
+
+// Location returns the time zone of the user. It returns UTC if the time zone is not set or cannot be loaded.
+func (u *UserMin) Location() *time.Location {
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 func GetUserMinByUsername(ctx context.Context, db dbconn, username string) (*UserMin, error) {
 	var user UserMin
-	err := db.QueryRow(ctx, "select id, username from users where username=$1", username).Scan(&user.ID, &user.Username)
+	err := db.QueryRow(ctx, "select id, username, time_zone, visibility from users where username=$1", username).Scan(
+		&user.ID, &user.Username, &user.TimeZone, &user.Visibility,
+	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, &NotFoundError{target: fmt.Sprintf("user username=%s", username)}
@@ -25,3 +60,233 @@ func GetUserMinByUsername(ctx context.Context, db dbconn, username string) (*Use
 
 	return &user, nil
 }
+
+// IsTimeZone returns true if name is an IANA time zone name such as "America/Chicago" or "UTC".
+func IsTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// SetUserTimeZone changes the time zone of the user specified by userID.
+func SetUserTimeZone(ctx context.Context, db dbconn, userID int64, timeZone string) error {
+	timeZone = strings.TrimSpace(timeZone)
+
+	v := validate.New()
+	v.Presence("timeZone", timeZone)
+	if timeZone != "" && !IsTimeZone(timeZone) {
+		v.Add("timeZone", errors.New("is not a known time zone"))
+	}
+	if v.Err() != nil {
+		return v.Err()
+	}
+
+	commandTag, err := db.Exec(ctx, "update users set time_zone=$1 where id=$2", timeZone, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	return nil
+}
+
+// SetUserVisibility changes who can see the books of the user specified by userID.
+func SetUserVisibility(ctx context.Context, db dbconn, userID int64, visibility string) error {
+	if !slices.Contains(UserVisibilities, visibility) {
+		v := validate.New()
+		v.Add("visibility", errors.New(`must be "private", "unlisted", or "public"`))
+		return v.Err()
+	}
+
+	commandTag, err := db.Exec(ctx, "update users set visibility=$1 where id=$2", visibility, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	return nil
+}
+
+// UserPreferences are the display preferences of a user.
+type UserPreferences struct {
+	DefaultBookSort string // Sort order of the book index when none is requested. One of BookSorts.
+	BooksPerPage    int32  // Number of books on each page of the book index. One of BooksPerPageOptions.
+}
+
+// BooksPerPageOptions is all allowed values of UserPreferences.BooksPerPage.
+var BooksPerPageOptions = []int32{25, 50, 100, 200}
+
+func (prefs UserPreferences) Validate() *errortree.Node {
+	v := validate.New()
+	if !slices.Contains(BookSorts, prefs.DefaultBookSort) {
+		v.Add("defaultBookSort", errors.New("is not a valid sort"))
+	}
+	if !slices.Contains(BooksPerPageOptions, prefs.BooksPerPage) {
+		v.Add("booksPerPage", errors.New("must be 25, 50, 100, or 200"))
+	}
+	if v.Err() != nil {
+		return v.Err().(*errortree.Node)
+	}
+	return nil
+}
+
+func GetUserPreferences(ctx context.Context, db dbconn, userID int64) (*UserPreferences, error) {
+	var prefs UserPreferences
+	err := db.QueryRow(ctx, "select default_book_sort, books_per_page from users where id=$1", userID).Scan(
+		&prefs.DefaultBookSort, &prefs.BooksPerPage,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+		}
+		return nil, err
+	}
+
+	return &prefs, nil
+}
+
+// SetUserPreferences changes the display preferences of the user specified by userID.
+func SetUserPreferences(ctx context.Context, db dbconn, userID int64, prefs UserPreferences) error {
+	if verr := prefs.Validate(); verr != nil {
+		return verr
+	}
+
+	commandTag, err := db.Exec(ctx,
+		"update users set default_book_sort=$1, books_per_page=$2 where id=$3",
+		prefs.DefaultBookSort, prefs.BooksPerPage, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	return nil
+}
+
+// usernameRegexp matches usernames that can be used in a path without escaping.
+var usernameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ChangeUsername changes the username of the user specified by userID. The old username redirects to the new one until
+// another user takes it.
+func ChangeUsername(ctx context.Context, db dbconn, userID int64, username string) error {
+	username = strings.TrimSpace(username)
+
+	v := validate.New()
+	v.Presence("username", username)
+	v.MaxLength("username", username, 50)
+	if username != "" && !usernameRegexp.MatchString(username) {
+		v.Add("username", errors.New("may only contain letters, numbers, periods, dashes, and underscores"))
+	}
+	if v.Err() != nil {
+		return v.Err()
+	}
+
+	var taken bool
+	err := db.QueryRow(ctx, "select exists(select 1 from users where username=$1 and id<>$2)", username, userID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		v.Add("username", errors.New("is already taken"))
+		return v.Err()
+	}
+
+	commandTag, err := db.Exec(ctx, "update users set username=$1 where id=$2", username, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	return nil
+}
+
+// FindUsernameRedirect returns the current username of the user who previously used username. It returns a
+// NotFoundError if username was never changed. It uses the find_username_redirect function because row-level security
+// prevents visitors from reading redirects.
+func FindUsernameRedirect(ctx context.Context, db dbconn, username string) (string, error) {
+	var currentUsername string
+	err := db.QueryRow(ctx, "select find_username_redirect($1)", username).Scan((*zeronull.Text)(&currentUsername))
+	if err != nil {
+		return "", err
+	}
+	if currentUsername == "" {
+		return "", &NotFoundError{target: fmt.Sprintf("username redirect username=%s", username)}
+	}
+
+	return currentUsername, nil
+}
+
+// GetUserEmail returns the email address of the user specified by userID. It returns an empty string if the user does
+// not have one.
+func GetUserEmail(ctx context.Context, db dbconn, userID int64) (string, error) {
+	var email string
+	err := db.QueryRow(ctx, "select email from users where id=$1", userID).Scan((*zeronull.Text)(&email))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+		}
+		return "", err
+	}
+
+	return email, nil
+}
+
+// IsEmail returns true if s is a bare email address such as "jack@example.com".
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// SetUserEmail changes the email address of the user specified by userID. An empty email removes the email address. No
+// two users may have the same email address regardless of case.
+func SetUserEmail(ctx context.Context, db dbconn, userID int64, email string) error {
+	email = strings.TrimSpace(email)
+
+	v := validate.New()
+	v.MaxLength("email", email, 254)
+	if email != "" && !IsEmail(email) {
+		v.Add("email", errors.New("is not an email address"))
+	}
+	if v.Err() != nil {
+		return v.Err()
+	}
+
+	if email != "" {
+		var taken bool
+		err := db.QueryRow(ctx, "select exists(select 1 from users where lower(email)=lower($1) and id<>$2)", email, userID).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			v.Add("email", errors.New("is already used by another account"))
+			return v.Err()
+		}
+	}
+
+	commandTag, err := db.Exec(ctx, "update users set email=$1 where id=$2", zeronull.Text(email), userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	return nil
+}
+
+// Today returns the date of now in loc as midnight UTC. This is the same representation as dates read from the
+// database so it can be compared with book dates.
+func Today(now time.Time, loc *time.Location) time.Time {
+	year, month, day := now.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -12,8 +12,11 @@ import (
 type UserLoginArgs struct {
 	Username string
 	Password string
+	Client   SessionClient
 }
 
+// UserLogin verifies the username and password in args and creates a session. If the user has enabled two-factor
+// authentication no session is created and a *TOTPRequiredError is returned instead.
 func UserLogin(ctx context.Context, db dbconn, args UserLoginArgs) ([16]byte, error) {
 	v := validate.New()
 	v.Presence("username", args.Username)
@@ -25,8 +28,12 @@ func UserLogin(ctx context.Context, db dbconn, args UserLoginArgs) ([16]byte, er
 
 	var userID int64
 	var passwordDigest []byte
+	var totpEnabled bool
 
-	err := db.QueryRow(ctx, "select id, password_digest from users where username=$1", args.Username).Scan(&userID, &passwordDigest)
+	err := db.QueryRow(ctx,
+		"select id, password_digest, totp_secret is not null from users where username=$1",
+		args.Username,
+	).Scan(&userID, &passwordDigest, &totpEnabled)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			v.Add("base", errors.New("Invalid username or password."))
@@ -41,5 +48,9 @@ func UserLogin(ctx context.Context, db dbconn, args UserLoginArgs) ([16]byte, er
 		return [16]byte{}, v.Err()
 	}
 
-	return createUserSession(ctx, db, userID)
+	if totpEnabled {
+		return [16]byte{}, &TOTPRequiredError{UserID: userID, Username: args.Username}
+	}
+
+	return createUserSession(ctx, db, userID, args.Client)
 }
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ChangePasswordArgs struct {
+	CurrentPassword         string
+	NewPassword             string
+	NewPasswordConfirmation string
+}
+
+// ChangePassword changes the password of the user specified by userID after verifying the current password. All
+// sessions of the user except keepSessionID are deleted so anyone else who knew the old password is logged out.
+func ChangePassword(ctx context.Context, db dbconn, userID int64, keepSessionID [16]byte, args ChangePasswordArgs) error {
+	v := validate.New()
+	v.Presence("currentPassword", args.CurrentPassword)
+	v.Presence("newPassword", args.NewPassword)
+	v.MinLength("newPassword", args.NewPassword, 8)
+	if args.NewPassword != args.NewPasswordConfirmation {
+		v.Add("newPasswordConfirmation", errors.New("does not match the new password"))
+	}
+	if v.Err() != nil {
+		return v.Err()
+	}
+
+	err := verifyUserPassword(ctx, db, userID, args.CurrentPassword)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			v.Add("currentPassword", errors.New("is incorrect"))
+			return v.Err()
+		}
+		return err
+	}
+
+	newPasswordDigest, err := bcrypt.GenerateFromPassword([]byte(args.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "update users set password_digest=$1 where id=$2", newPasswordDigest, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "delete from user_sessions where user_id=$1 and id<>$2", userID, keepSessionID)
+	return err
+}
+
+// verifyUserPassword returns a validation error on "password" if password is not the password of the user specified by
+// userID.
+func verifyUserPassword(ctx context.Context, db dbconn, userID int64, password string) error {
+	var passwordDigest []byte
+	err := db.QueryRow(ctx, "select password_digest from users where id=$1", userID).Scan(&passwordDigest)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+		}
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(passwordDigest, []byte(password))
+	if err != nil {
+		v := validate.New()
+		v.Add("password", errors.New("is incorrect"))
+		return v.Err()
+	}
+
+	return nil
+}
+
+// PasswordResetTokenLifetime is how long a password reset token can be used after it is created.
+const PasswordResetTokenLifetime = time.Hour
+
+// PasswordReset is a password reset token and the user it was created for.
+type PasswordReset struct {
+	User  UserMin
+	Email string
+	Token string // The secret token. Only a digest is stored so it cannot be retrieved again.
+}
+
+// CreatePasswordResetToken creates a password reset token for the user with email. It returns a NotFoundError if no user
+// has email. It uses the create_password_reset_token function because the user is not authenticated.
+func CreatePasswordResetToken(ctx context.Context, db dbconn, email string, now time.Time) (*PasswordReset, error) {
+	email = strings.TrimSpace(email)
+
+	v := validate.New()
+	v.Presence("email", email)
+	if v.Err() != nil {
+		return nil, v.Err()
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	reset := &PasswordReset{Token: base64.RawURLEncoding.EncodeToString(buf)}
+	err = db.QueryRow(ctx,
+		"select user_id, username, email from create_password_reset_token($1, $2, $3, $4)",
+		email, passwordResetTokenDigest(reset.Token), now.Add(PasswordResetTokenLifetime), now,
+	).Scan(&reset.User.ID, &reset.User.Username, &reset.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: "user with email"}
+		}
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+// FindPasswordResetToken returns the user that token can reset the password of. It returns a NotFoundError if token is
+// not valid, has expired, or has already been used.
+func FindPasswordResetToken(ctx context.Context, db dbconn, token string, now time.Time) (*UserMin, error) {
+	var user UserMin
+	err := db.QueryRow(ctx,
+		"select user_id, username from find_password_reset_token($1, $2)",
+		passwordResetTokenDigest(token), now,
+	).Scan(&user.ID, &user.Username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: "password reset token"}
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+type ResetPasswordArgs struct {
+	Password             string
+	PasswordConfirmation string
+}
+
+// ResetPassword sets the password of the user token was created for. The token cannot be used again and all sessions of
+// the user are deleted. It returns the user whose password was reset or a NotFoundError if token is not valid, has
+// expired, or has already been used.
+func ResetPassword(ctx context.Context, db dbconn, token string, args ResetPasswordArgs, now time.Time) (*UserMin, error) {
+	v := validate.New()
+	v.Presence("password", args.Password)
+	v.MinLength("password", args.Password, 8)
+	if args.Password != args.PasswordConfirmation {
+		v.Add("passwordConfirmation", errors.New("does not match the password"))
+	}
+	if v.Err() != nil {
+		return nil, v.Err()
+	}
+
+	passwordDigest, err := bcrypt.GenerateFromPassword([]byte(args.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	var user UserMin
+	err = db.QueryRow(ctx,
+		"select user_id, username from reset_password($1, $2, $3)",
+		passwordResetTokenDigest(token), passwordDigest, now,
+	).Scan(&user.ID, &user.Username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: "password reset token"}
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// passwordResetTokenDigest returns the digest of token that is stored in the database. Like API tokens, reset tokens are
+// 256 bits of random data so a fast hash is sufficient.
+func passwordResetTokenDigest(token string) []byte {
+	digest := sha256.Sum256([]byte(token))
+	return digest[:]
+}
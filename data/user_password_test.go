@@ -0,0 +1,158 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "old password"})
+	require.NoError(t, err)
+	currentSessionID, err := data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "old password"})
+	require.NoError(t, err)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "select id from users where username='test'").Scan(&userID)
+	require.NoError(t, err)
+
+	err = data.ChangePassword(ctx, tx, userID, currentSessionID, data.ChangePasswordArgs{
+		CurrentPassword:         "wrong password",
+		NewPassword:             "short",
+		NewPasswordConfirmation: "different",
+	})
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("newPassword"), 1)
+	require.Len(t, verr.Get("newPasswordConfirmation"), 1)
+
+	err = data.ChangePassword(ctx, tx, userID, currentSessionID, data.ChangePasswordArgs{
+		CurrentPassword:         "wrong password",
+		NewPassword:             "new password",
+		NewPasswordConfirmation: "new password",
+	})
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("currentPassword"), 1)
+
+	err = data.ChangePassword(ctx, tx, userID, currentSessionID, data.ChangePasswordArgs{
+		CurrentPassword:         "old password",
+		NewPassword:             "new password",
+		NewPasswordConfirmation: "new password",
+	})
+	require.NoError(t, err)
+
+	var passwordDigest []byte
+	err = tx.QueryRow(ctx, "select password_digest from users where id=$1", userID).Scan(&passwordDigest)
+	require.NoError(t, err)
+	require.NoError(t, bcrypt.CompareHashAndPassword(passwordDigest, []byte("new password")))
+
+	// Only the session that changed the password remains.
+	rows, _ := tx.Query(ctx, "select id from user_sessions where user_id=$1", userID)
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[[16]byte])
+	require.NoError(t, err)
+	require.Equal(t, [][16]byte{currentSessionID}, sessionIDs)
+
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "old password"})
+	require.ErrorAs(t, err, &verr)
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "old password"})
+	require.NoError(t, err)
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "old password"})
+	require.NoError(t, err)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "update users set email='Test@Example.com' where username='test' returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	// Act as the application role without an authenticated user.
+	testutil.SetAppRole(t, ctx, tx)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var nfErr *data.NotFoundError
+	_, err = data.CreatePasswordResetToken(ctx, tx, "nobody@example.com", now)
+	require.ErrorAs(t, err, &nfErr)
+
+	expired, err := data.CreatePasswordResetToken(ctx, tx, "test@example.com", now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	_, err = data.FindPasswordResetToken(ctx, tx, expired.Token, now)
+	require.ErrorAs(t, err, &nfErr)
+
+	reset, err := data.CreatePasswordResetToken(ctx, tx, " test@example.com ", now)
+	require.NoError(t, err)
+	require.Equal(t, userID, reset.User.ID)
+	require.Equal(t, "test", reset.User.Username)
+	require.Equal(t, "Test@Example.com", reset.Email)
+
+	user, err := data.FindPasswordResetToken(ctx, tx, reset.Token, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, userID, user.ID)
+
+	_, err = data.ResetPassword(ctx, tx, expired.Token, data.ResetPasswordArgs{Password: "new password", PasswordConfirmation: "new password"}, now)
+	require.ErrorAs(t, err, &nfErr)
+
+	_, err = data.ResetPassword(ctx, tx, reset.Token, data.ResetPasswordArgs{Password: "short", PasswordConfirmation: "different"}, now)
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("password"), 1)
+	require.Len(t, verr.Get("passwordConfirmation"), 1)
+
+	user, err = data.ResetPassword(ctx, tx, reset.Token, data.ResetPasswordArgs{Password: "new password", PasswordConfirmation: "new password"}, now)
+	require.NoError(t, err)
+	require.Equal(t, userID, user.ID)
+
+	// The token can only be used once.
+	_, err = data.FindPasswordResetToken(ctx, tx, reset.Token, now)
+	require.ErrorAs(t, err, &nfErr)
+	_, err = data.ResetPassword(ctx, tx, reset.Token, data.ResetPasswordArgs{Password: "other password", PasswordConfirmation: "other password"}, now)
+	require.ErrorAs(t, err, &nfErr)
+
+	_, err = tx.Exec(ctx, "reset role")
+	require.NoError(t, err)
+
+	var sessionCount int
+	err = tx.QueryRow(ctx, "select count(*) from user_sessions where user_id=$1", userID).Scan(&sessionCount)
+	require.NoError(t, err)
+	require.Equal(t, 0, sessionCount)
+
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "old password"})
+	require.ErrorAs(t, err, &verr)
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "new password"})
+	require.NoError(t, err)
+}
@@ -10,6 +10,7 @@ import (
 type RegisterUserArgs struct {
 	Username string
 	Password string
+	Client   SessionClient
 }
 
 func RegisterUser(ctx context.Context, db dbconn, args RegisterUserArgs) ([16]byte, error) {
@@ -33,5 +34,5 @@ func RegisterUser(ctx context.Context, db dbconn, args RegisterUserArgs) ([16]by
 		return [16]byte{}, err
 	}
 
-	return createUserSession(ctx, db, userID)
+	return createUserSession(ctx, db, userID, args.Client)
 }
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgxutil"
+)
+
+const (
+	// SessionIdleTimeout is how long a session can go unused before it expires. purge_expired_user_sessions uses the same
+	// interval.
+	SessionIdleTimeout = 14 * 24 * time.Hour
+
+	// SessionMaxAge is how long a session lasts after logging in no matter how often it is used. The
+	// purge_expired_user_sessions function uses the same interval.
+	SessionMaxAge = 90 * 24 * time.Hour
+
+	// sessionTouchInterval limits how often the last seen time of a session is updated.
+	sessionTouchInterval = time.Minute
+)
+
+// SessionClient describes the browser a session is used from.
+type SessionClient struct {
+	UserAgent  string
+	RemoteAddr string
+}
+
+type UserSession struct {
+	ID           [16]byte // The secret in the session cookie. Never show it to the user.
+	PublicID     int64
+	UserID       int64
+	Username     string
+	UserAgent    string
+	RemoteAddr   string
+	LoginTime    time.Time
+	LastSeenTime time.Time
+}
+
+// ExpireTime returns when s expires if it is not used again.
+func (s *UserSession) ExpireTime() time.Time {
+	idleExpireTime := s.LastSeenTime.Add(SessionIdleTimeout)
+	maxExpireTime := s.LoginTime.Add(SessionMaxAge)
+	if idleExpireTime.Before(maxExpireTime) {
+		return idleExpireTime
+	}
+	return maxExpireTime
+}
+
+// IsExpired returns true if s has expired at now.
+func (s *UserSession) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpireTime())
+}
+
+// createUserSession creates a session for userID. It uses the create_user_session function because row-level security
+// prevents inserting into user_sessions before the user is authenticated.
+func createUserSession(ctx context.Context, db dbconn, userID int64, client SessionClient) ([16]byte, error) {
+	var userSessionID [16]byte
+	err := db.QueryRow(ctx, "select create_user_session($1, $2, $3)", userID, client.UserAgent, client.RemoteAddr).Scan(&userSessionID)
+	return userSessionID, err
+}
+
+// FindUserSession returns the session with id. It returns a NotFoundError if there is no such session. It does not check
+// whether the session has expired. It uses the find_user_session function because it is called before the user is
+// authenticated.
+func FindUserSession(ctx context.Context, db dbconn, id [16]byte) (*UserSession, error) {
+	var s UserSession
+	err := db.QueryRow(ctx,
+		"select id, public_id, user_id, username, user_agent, remote_addr, login_time, last_seen_time from find_user_session($1)",
+		id,
+	).Scan(&s.ID, &s.PublicID, &s.UserID, &s.Username, &s.UserAgent, &s.RemoteAddr, &s.LoginTime, &s.LastSeenTime)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: "user session"}
+		}
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// TouchUserSession records that s was used at now from remoteAddr. To avoid writing on every request nothing is written
+// if s was last used from remoteAddr less than a minute ago.
+func TouchUserSession(ctx context.Context, db dbconn, s *UserSession, remoteAddr string, now time.Time) error {
+	if s.RemoteAddr == remoteAddr && now.Sub(s.LastSeenTime) < sessionTouchInterval {
+		return nil
+	}
+
+	_, err := db.Exec(ctx, "select touch_user_session($1, $2, $3)", s.ID, remoteAddr, now)
+	if err != nil {
+		return err
+	}
+
+	s.RemoteAddr = remoteAddr
+	s.LastSeenTime = now
+	return nil
+}
+
+// GetUserSessions returns the sessions of userID that have not expired at now ordered by most recently used.
+func GetUserSessions(ctx context.Context, db dbconn, userID int64, now time.Time) ([]*UserSession, error) {
+	return pgxutil.Select(
+		ctx,
+		db,
+		`select id, public_id, user_id, user_agent, remote_addr, login_time, last_seen_time
+from user_sessions
+where user_id=$1
+  and login_time > $2
+  and last_seen_time > $3
+order by last_seen_time desc`,
+		[]any{userID, now.Add(-SessionMaxAge), now.Add(-SessionIdleTimeout)},
+		func(row pgx.CollectableRow) (*UserSession, error) {
+			var s UserSession
+			err := row.Scan(&s.ID, &s.PublicID, &s.UserID, &s.UserAgent, &s.RemoteAddr, &s.LoginTime, &s.LastSeenTime)
+			return &s, err
+		},
+	)
+}
+
+// DeleteUserSession logs out the session of userID specified by publicID. It returns a NotFoundError if the session
+// cannot be found or is owned by another user.
+func DeleteUserSession(ctx context.Context, db dbconn, userID, publicID int64) error {
+	commandTag, err := db.Exec(ctx, "delete from user_sessions where public_id=$1 and user_id=$2", publicID, userID)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("user session public_id=%d", publicID)}
+	}
+
+	return nil
+}
+
+// DeleteAllUserSessions logs out all sessions of userID.
+func DeleteAllUserSessions(ctx context.Context, db dbconn, userID int64) error {
+	_, err := db.Exec(ctx, "delete from user_sessions where user_id=$1", userID)
+	return err
+}
+
+// PurgeExpiredUserSessions deletes the sessions of all users that have expired according to the database clock. Expired
+// sessions cannot be used so this only reclaims space. It returns the number of deleted sessions.
+func PurgeExpiredUserSessions(ctx context.Context, db dbconn) (int64, error) {
+	var n int64
+	err := db.QueryRow(ctx, "select purge_expired_user_sessions()").Scan(&n)
+	return n, err
+}
@@ -0,0 +1,122 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSessions(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	client := data.SessionClient{UserAgent: "Test Browser", RemoteAddr: "192.0.2.1"}
+	firstSessionID, err := data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "password", Client: client})
+	require.NoError(t, err)
+	secondSessionID, err := data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "other", Password: "password"})
+	require.NoError(t, err)
+
+	// Pin the times so expiry does not depend on the clock.
+	loginTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err = tx.Exec(ctx, "update user_sessions set login_time=$1, last_seen_time=$1", loginTime)
+	require.NoError(t, err)
+
+	// Act as the application role with no user authenticated like sessionHandler.
+	testutil.SetAppRole(t, ctx, tx)
+
+	_, err = data.FindUserSession(ctx, tx, [16]byte{1})
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+
+	first, err := data.FindUserSession(ctx, tx, firstSessionID)
+	require.NoError(t, err)
+	require.Equal(t, "test", first.Username)
+	require.Equal(t, "Test Browser", first.UserAgent)
+	require.Equal(t, "192.0.2.1", first.RemoteAddr)
+	require.True(t, loginTime.Equal(first.LastSeenTime))
+
+	require.False(t, first.IsExpired(loginTime.Add(data.SessionIdleTimeout-time.Second)))
+	require.True(t, first.IsExpired(loginTime.Add(data.SessionIdleTimeout)))
+
+	// Touching only writes when the address changed or some time has passed.
+	err = data.TouchUserSession(ctx, tx, first, "192.0.2.1", loginTime.Add(time.Second))
+	require.NoError(t, err)
+	reloaded, err := data.FindUserSession(ctx, tx, firstSessionID)
+	require.NoError(t, err)
+	require.True(t, loginTime.Equal(reloaded.LastSeenTime))
+
+	lastSeenTime := loginTime.Add(data.SessionIdleTimeout - time.Hour)
+	err = data.TouchUserSession(ctx, tx, first, "198.51.100.1", lastSeenTime)
+	require.NoError(t, err)
+	reloaded, err = data.FindUserSession(ctx, tx, firstSessionID)
+	require.NoError(t, err)
+	require.True(t, lastSeenTime.Equal(reloaded.LastSeenTime))
+	require.Equal(t, "198.51.100.1", reloaded.RemoteAddr)
+
+	// Using a session does not extend it past the maximum age.
+	require.False(t, reloaded.IsExpired(loginTime.Add(data.SessionIdleTimeout)))
+	require.True(t, reloaded.IsExpired(loginTime.Add(data.SessionMaxAge)))
+
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", first.UserID)
+	require.NoError(t, err)
+
+	sessions, err := data.GetUserSessions(ctx, tx, first.UserID, loginTime.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, first.PublicID, sessions[0].PublicID)
+
+	// The second session has expired from disuse.
+	sessions, err = data.GetUserSessions(ctx, tx, first.UserID, loginTime.Add(data.SessionIdleTimeout))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, first.PublicID, sessions[0].PublicID)
+
+	second, err := data.FindUserSession(ctx, tx, secondSessionID)
+	require.NoError(t, err)
+
+	err = data.DeleteUserSession(ctx, tx, first.UserID, second.PublicID)
+	require.NoError(t, err)
+	err = data.DeleteUserSession(ctx, tx, first.UserID, second.PublicID)
+	require.ErrorAs(t, err, &nfErr)
+	_, err = data.FindUserSession(ctx, tx, secondSessionID)
+	require.ErrorAs(t, err, &nfErr)
+
+	err = data.DeleteAllUserSessions(ctx, tx, first.UserID)
+	require.NoError(t, err)
+	_, err = data.FindUserSession(ctx, tx, firstSessionID)
+	require.ErrorAs(t, err, &nfErr)
+
+	// Purging does not require an authenticated user and removes expired sessions of all users. It uses the database
+	// clock so the pinned session of the other user has expired but a new one has not.
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "other", Password: "password"})
+	require.NoError(t, err)
+
+	n, err := data.PurgeExpiredUserSessions(ctx, tx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	n, err = data.PurgeExpiredUserSessions(ctx, tx)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, n)
+}
@@ -0,0 +1,265 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToday(t *testing.T) {
+	t.Parallel()
+
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	require.NoError(t, err)
+	chicago, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	now := time.Date(2021, 3, 1, 20, 0, 0, 0, time.UTC)
+	require.Equal(t, date(2021, 3, 1), data.Today(now, time.UTC))
+	require.Equal(t, date(2021, 3, 2), data.Today(now, auckland))
+
+	now = time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC)
+	require.Equal(t, date(2020, 12, 31), data.Today(now, chicago))
+}
+
+func TestIsTimeZone(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"UTC", "America/Chicago", "Europe/London"} {
+		require.Truef(t, data.IsTimeZone(s), "%q", s)
+	}
+	for _, s := range []string{"", "Local", "Mars/Olympus_Mons", "../etc"} {
+		require.Falsef(t, data.IsTimeZone(s), "%q", s)
+	}
+}
+
+func TestSetUserTimeZone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	user, err := data.GetUserMinByUsername(ctx, tx, "test")
+	require.NoError(t, err)
+	require.Equal(t, "UTC", user.TimeZone)
+	require.Equal(t, time.UTC, user.Location())
+
+	err = data.SetUserTimeZone(ctx, tx, userID, "Mars/Olympus_Mons")
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("timeZone"), 1)
+
+	err = data.SetUserTimeZone(ctx, tx, userID, " America/Chicago ")
+	require.NoError(t, err)
+
+	user, err = data.GetUserMinByUsername(ctx, tx, "test")
+	require.NoError(t, err)
+	require.Equal(t, "America/Chicago", user.TimeZone)
+	require.Equal(t, "America/Chicago", user.Location().String())
+
+	err = data.SetUserTimeZone(ctx, tx, -1, "UTC")
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+}
+
+func TestSetUserVisibility(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	user, err := data.GetUserMinByUsername(ctx, tx, "test")
+	require.NoError(t, err)
+	require.Equal(t, data.UserVisibilityPrivate, user.Visibility)
+	require.False(t, user.IsVisible())
+
+	err = data.SetUserVisibility(ctx, tx, userID, "friends")
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("visibility"), 1)
+
+	for _, visibility := range []string{data.UserVisibilityUnlisted, data.UserVisibilityPublic} {
+		err = data.SetUserVisibility(ctx, tx, userID, visibility)
+		require.NoError(t, err)
+
+		user, err = data.GetUserMinByUsername(ctx, tx, "test")
+		require.NoError(t, err)
+		require.Equal(t, visibility, user.Visibility)
+		require.True(t, user.IsVisible())
+	}
+
+	err = data.SetUserVisibility(ctx, tx, -1, data.UserVisibilityPrivate)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+}
+
+func TestSetUserPreferences(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	prefs, err := data.GetUserPreferences(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, &data.UserPreferences{DefaultBookSort: data.BookSortFinishDate, BooksPerPage: 100}, prefs)
+
+	err = data.SetUserPreferences(ctx, tx, userID, data.UserPreferences{DefaultBookSort: "rating", BooksPerPage: 7})
+	var verr *errortree.Node
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("defaultBookSort"), 1)
+	require.Len(t, verr.Get("booksPerPage"), 1)
+
+	err = data.SetUserPreferences(ctx, tx, userID, data.UserPreferences{DefaultBookSort: data.BookSortAuthor, BooksPerPage: 25})
+	require.NoError(t, err)
+
+	prefs, err = data.GetUserPreferences(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, &data.UserPreferences{DefaultBookSort: data.BookSortAuthor, BooksPerPage: 25}, prefs)
+}
+
+func TestChangeUsername(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID, otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('other', 'x') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	// Act as the application role with the user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", userID)
+	require.NoError(t, err)
+
+	for _, username := range []string{"", "other", "has space", "a/b"} {
+		err = data.ChangeUsername(ctx, tx, userID, username)
+		var verr *errortree.Node
+		require.ErrorAsf(t, err, &verr, "%q", username)
+		require.Lenf(t, verr.Get("username"), 1, "%q", username)
+	}
+
+	var nfErr *data.NotFoundError
+	_, err = data.FindUsernameRedirect(ctx, tx, "test")
+	require.ErrorAs(t, err, &nfErr)
+
+	require.NoError(t, data.ChangeUsername(ctx, tx, userID, " renamed "))
+	user, err := data.GetUserMinByUsername(ctx, tx, "renamed")
+	require.NoError(t, err)
+	require.Equal(t, userID, user.ID)
+
+	require.NoError(t, data.ChangeUsername(ctx, tx, userID, "renamed.again"))
+
+	// Every old username redirects to the current one.
+	for _, username := range []string{"test", "renamed"} {
+		currentUsername, err := data.FindUsernameRedirect(ctx, tx, username)
+		require.NoError(t, err)
+		require.Equal(t, "renamed.again", currentUsername)
+	}
+
+	// A redirect is removed when another user takes the username.
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", otherUserID)
+	require.NoError(t, err)
+	require.NoError(t, data.ChangeUsername(ctx, tx, otherUserID, "test"))
+	_, err = data.FindUsernameRedirect(ctx, tx, "test")
+	require.ErrorAs(t, err, &nfErr)
+
+	currentUsername, err := data.FindUsernameRedirect(ctx, tx, "other")
+	require.NoError(t, err)
+	require.Equal(t, "test", currentUsername)
+}
+
+func TestSetUserEmail(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID, otherUserID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, email) values('other', 'x', 'other@example.com') returning id").Scan(&otherUserID)
+	require.NoError(t, err)
+
+	email, err := data.GetUserEmail(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "", email)
+
+	for _, email := range []string{"not an email", "Jack <jack@example.com>", "OTHER@example.com"} {
+		err = data.SetUserEmail(ctx, tx, userID, email)
+		var verr *errortree.Node
+		require.ErrorAsf(t, err, &verr, "%q", email)
+		require.Lenf(t, verr.Get("email"), 1, "%q", email)
+	}
+
+	require.NoError(t, data.SetUserEmail(ctx, tx, userID, " test@example.com "))
+	email, err = data.GetUserEmail(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "test@example.com", email)
+
+	require.NoError(t, data.SetUserEmail(ctx, tx, userID, ""))
+	email, err = data.GetUserEmail(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "", email)
+}
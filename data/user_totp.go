@@ -0,0 +1,296 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype/zeronull"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes created when two-factor authentication is enabled.
+	RecoveryCodeCount = 10
+
+	// TOTPMaxFailedAttempts is the number of consecutive incorrect codes after which logging in is locked for
+	// TOTPLockDuration.
+	TOTPMaxFailedAttempts = 5
+	TOTPLockDuration      = 15 * time.Minute
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TOTPRequiredError is returned by UserLogin when the password is correct but the user has enabled two-factor
+// authentication. No session has been created. The login must be completed with UserLoginTOTP.
+type TOTPRequiredError struct {
+	UserID   int64
+	Username string
+}
+
+func (e *TOTPRequiredError) Error() string {
+	return "two-factor authentication code required"
+}
+
+// UserTOTPStatus describes the two-factor authentication of a user.
+type UserTOTPStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int
+}
+
+// GetUserTOTPStatus returns the two-factor authentication status of the user specified by userID.
+func GetUserTOTPStatus(ctx context.Context, db dbconn, userID int64) (*UserTOTPStatus, error) {
+	var status UserTOTPStatus
+	err := db.QueryRow(ctx,
+		"select totp_secret is not null, (select count(*) from user_recovery_codes where user_id=users.id) from users where id=$1",
+		userID,
+	).Scan(&status.Enabled, &status.RecoveryCodesRemaining)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+		}
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// EnableUserTOTP enables two-factor authentication for the user specified by userID with secret, the base32 encoded
+// secret key that was shown to the user. code must be a current code for secret to prove that the user's authenticator
+// was set up correctly. It returns new recovery codes. They are not stored and cannot be retrieved again.
+func EnableUserTOTP(ctx context.Context, db dbconn, userID int64, secret string, code string, now time.Time) ([]string, error) {
+	v := validate.New()
+	v.Presence("code", code)
+	if v.Err() != nil {
+		return nil, v.Err()
+	}
+
+	secretKey, err := totp.DecodeSecret(secret)
+	if err != nil || len(secretKey) == 0 {
+		v.Add("secret", errors.New("is not a valid secret key"))
+		return nil, v.Err()
+	}
+
+	step, ok := totp.Validate(secretKey, code, now, 0)
+	if !ok {
+		v.Add("code", errors.New("is incorrect"))
+		return nil, v.Err()
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx,
+		"update users set totp_secret=$1, totp_last_step=$2, totp_failed_attempts=0, totp_locked_until=null where id=$3",
+		secretKey, step, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return nil, &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableUserTOTP disables two-factor authentication for the user specified by userID after verifying password. Their
+// recovery codes are deleted.
+func DisableUserTOTP(ctx context.Context, db dbconn, userID int64, password string) error {
+	err := verifyUserPassword(ctx, db, userID, password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"update users set totp_secret=null, totp_last_step=null, totp_failed_attempts=0, totp_locked_until=null where id=$1",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "delete from user_recovery_codes where user_id=$1", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user specified by userID after verifying password. It
+// returns the new recovery codes.
+func RegenerateRecoveryCodes(ctx context.Context, db dbconn, userID int64, password string) ([]string, error) {
+	err := verifyUserPassword(ctx, db, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := GetUserTOTPStatus(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Enabled {
+		v := validate.New()
+		v.Add("base", errors.New("Two-factor authentication is not enabled."))
+		return nil, v.Err()
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	recoveryCodes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// UserLoginTOTP completes a login that UserLogin interrupted with a TOTPRequiredError. code is either a current code from
+// the user's authenticator or one of their recovery codes. A code can only be used once. After TOTPMaxFailedAttempts
+// consecutive incorrect codes all codes are rejected for TOTPLockDuration. The session is created for client.
+func UserLoginTOTP(ctx context.Context, db dbconn, userID int64, code string, client SessionClient, now time.Time) ([16]byte, error) {
+	code = strings.TrimSpace(code)
+
+	v := validate.New()
+	v.Presence("code", code)
+	if v.Err() != nil {
+		return [16]byte{}, v.Err()
+	}
+
+	var secret []byte
+	var lastStep int64
+	var lockedUntil time.Time
+	err := db.QueryRow(ctx,
+		"select totp_secret, coalesce(totp_last_step, 0), totp_locked_until from users where id=$1",
+		userID,
+	).Scan(&secret, &lastStep, (*zeronull.Timestamptz)(&lockedUntil))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return [16]byte{}, &NotFoundError{target: fmt.Sprintf("user id=%d", userID)}
+		}
+		return [16]byte{}, err
+	}
+
+	if now.Before(lockedUntil) {
+		v.Add("base", errors.New("Too many incorrect codes. Try again later."))
+		return [16]byte{}, v.Err()
+	}
+
+	var ok bool
+	if secret != nil {
+		if step, valid := totp.Validate(secret, code, now, lastStep); valid {
+			// The condition on totp_last_step prevents concurrent logins from using the same code.
+			commandTag, err := db.Exec(ctx,
+				"update users set totp_last_step=$1 where id=$2 and (totp_last_step is null or totp_last_step < $1)",
+				step, userID,
+			)
+			if err != nil {
+				return [16]byte{}, err
+			}
+			ok = commandTag.RowsAffected() == 1
+		} else {
+			err = db.QueryRow(ctx, "select use_user_recovery_code($1, $2)", userID, recoveryCodeDigest(code)).Scan(&ok)
+			if err != nil {
+				return [16]byte{}, err
+			}
+		}
+	}
+
+	if !ok {
+		_, err = db.Exec(ctx,
+			`update users set
+  totp_failed_attempts = case when totp_failed_attempts+1 >= $2 then 0 else totp_failed_attempts+1 end,
+  totp_locked_until = case when totp_failed_attempts+1 >= $2 then $3 else totp_locked_until end
+where id=$1`,
+			userID, TOTPMaxFailedAttempts, now.Add(TOTPLockDuration),
+		)
+		if err != nil {
+			return [16]byte{}, err
+		}
+
+		v.Add("code", errors.New("is incorrect"))
+		return [16]byte{}, v.Err()
+	}
+
+	_, err = db.Exec(ctx, "update users set totp_failed_attempts=0, totp_locked_until=null where id=$1", userID)
+	if err != nil {
+		return [16]byte{}, err
+	}
+
+	return createUserSession(ctx, db, userID, client)
+}
+
+// replaceRecoveryCodes deletes the recovery codes of userID and creates RecoveryCodeCount new ones.
+func replaceRecoveryCodes(ctx context.Context, db dbconn, userID int64) ([]string, error) {
+	_, err := db.Exec(ctx, "delete from user_recovery_codes where user_id=$1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, RecoveryCodeCount)
+	for i := range recoveryCodes {
+		buf := make([]byte, 10)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		s := recoveryCodeEncoding.EncodeToString(buf)
+		recoveryCodes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+
+		_, err = db.Exec(ctx,
+			"insert into user_recovery_codes(user_id, code_digest) values($1, $2)",
+			userID, recoveryCodeDigest(recoveryCodes[i]),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return recoveryCodes, nil
+}
+
+// recoveryCodeDigest returns the digest of code that is stored in the database. Case, spaces, and dashes are ignored so
+// the code can be typed however it was written down. Recovery codes are 80 bits of random data so a fast hash is
+// sufficient.
+func recoveryCodeDigest(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	digest := sha256.Sum256([]byte(code))
+	return digest[:]
+}
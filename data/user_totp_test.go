@@ -0,0 +1,123 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTOTP(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "select id from users where username='test'").Scan(&userID)
+	require.NoError(t, err)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+
+	var verr *errortree.Node
+	_, err = data.EnableUserTOTP(ctx, tx, userID, totp.EncodeSecret(secret), "000000", now.Add(-time.Hour))
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("code"), 1)
+
+	recoveryCodes, err := data.EnableUserTOTP(ctx, tx, userID, totp.EncodeSecret(secret), totp.Code(secret, now), now)
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, data.RecoveryCodeCount)
+
+	status, err := data.GetUserTOTPStatus(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, &data.UserTOTPStatus{Enabled: true, RecoveryCodesRemaining: data.RecoveryCodeCount}, status)
+
+	// The password alone does not create a session.
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "password"})
+	var totpErr *data.TOTPRequiredError
+	require.ErrorAs(t, err, &totpErr)
+	require.Equal(t, userID, totpErr.UserID)
+
+	var sessionCount int
+	err = tx.QueryRow(ctx, "select count(*) from user_sessions where user_id=$1", userID).Scan(&sessionCount)
+	require.NoError(t, err)
+	require.Equal(t, 0, sessionCount)
+
+	// The code used to enable two-factor authentication cannot be used to log in.
+	_, err = data.UserLoginTOTP(ctx, tx, userID, totp.Code(secret, now), data.SessionClient{}, now)
+	require.ErrorAs(t, err, &verr)
+
+	later := now.Add(totp.Period)
+	_, err = data.UserLoginTOTP(ctx, tx, userID, totp.Code(secret, later), data.SessionClient{}, later)
+	require.NoError(t, err)
+
+	// A code cannot be used twice.
+	_, err = data.UserLoginTOTP(ctx, tx, userID, totp.Code(secret, later), data.SessionClient{}, later)
+	require.ErrorAs(t, err, &verr)
+
+	// A recovery code can be used once regardless of case and dashes.
+	_, err = data.UserLoginTOTP(ctx, tx, userID, " "+recoveryCodes[0]+" ", data.SessionClient{}, later)
+	require.NoError(t, err)
+	_, err = data.UserLoginTOTP(ctx, tx, userID, recoveryCodes[0], data.SessionClient{}, later)
+	require.ErrorAs(t, err, &verr)
+
+	// Too many incorrect codes lock logging in even with a correct code. The reused recovery code above was the first.
+	for range data.TOTPMaxFailedAttempts - 1 {
+		_, err = data.UserLoginTOTP(ctx, tx, userID, "000000", data.SessionClient{}, later)
+		require.ErrorAs(t, err, &verr)
+	}
+	_, err = data.UserLoginTOTP(ctx, tx, userID, recoveryCodes[1], data.SessionClient{}, later)
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("base"), 1)
+
+	unlocked := later.Add(data.TOTPLockDuration)
+	_, err = data.UserLoginTOTP(ctx, tx, userID, recoveryCodes[1], data.SessionClient{}, unlocked)
+	require.NoError(t, err)
+
+	status, err = data.GetUserTOTPStatus(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, data.RecoveryCodeCount-2, status.RecoveryCodesRemaining)
+
+	_, err = data.RegenerateRecoveryCodes(ctx, tx, userID, "wrong password")
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("password"), 1)
+
+	newRecoveryCodes, err := data.RegenerateRecoveryCodes(ctx, tx, userID, "password")
+	require.NoError(t, err)
+	require.Len(t, newRecoveryCodes, data.RecoveryCodeCount)
+	_, err = data.UserLoginTOTP(ctx, tx, userID, recoveryCodes[2], data.SessionClient{}, unlocked)
+	require.ErrorAs(t, err, &verr)
+
+	err = data.DisableUserTOTP(ctx, tx, userID, "wrong password")
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Get("password"), 1)
+
+	err = data.DisableUserTOTP(ctx, tx, userID, "password")
+	require.NoError(t, err)
+
+	status, err = data.GetUserTOTPStatus(ctx, tx, userID)
+	require.NoError(t, err)
+	require.Equal(t, &data.UserTOTPStatus{}, status)
+
+	_, err = data.UserLogin(ctx, tx, data.UserLoginArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+}
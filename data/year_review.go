@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// YearReview summarizes the books a user finished in a single year.
+type YearReview struct {
+	Year              int32
+	Books             []*Book // Ordered by finish date.
+	BooksPerFormat    []FormatCount
+	BusiestMonth      *BooksPerTimeItem // nil if no books were finished.
+	NewAuthorCount    int32             // Authors first read in the year.
+	RepeatAuthorCount int32             // Authors also read in earlier years.
+}
+
+// FirstBook returns the first book finished in the year or nil if no books were finished.
+func (yr *YearReview) FirstBook() *Book {
+	if len(yr.Books) == 0 {
+		return nil
+	}
+	return yr.Books[0]
+}
+
+// LastBook returns the last book finished in the year or nil if no books were finished.
+func (yr *YearReview) LastBook() *Book {
+	if len(yr.Books) == 0 {
+		return nil
+	}
+	return yr.Books[len(yr.Books)-1]
+}
+
+// NewYearReview builds a YearReview for year from books finished in that year ordered by finish date. repeatAuthorCount
+// is the number of authors of books that were also read in earlier years. Authors are matched case insensitively.
+func NewYearReview(year int32, books []*Book, repeatAuthorCount int32) *YearReview {
+	yr := &YearReview{Year: year, Books: books}
+
+	formatCounts := make(map[string]int32)
+	monthCounts := make(map[time.Month]int32)
+	authors := make(map[string]struct{})
+	for _, book := range books {
+		formatCounts[book.Format]++
+		monthCounts[book.FinishDate.Month()]++
+
+		authors[strings.ToLower(book.Author)] = struct{}{}
+	}
+
+	yr.RepeatAuthorCount = min(repeatAuthorCount, int32(len(authors)))
+	yr.NewAuthorCount = int32(len(authors)) - yr.RepeatAuthorCount
+
+	for _, format := range []string{"text", "audio", "video"} {
+		if formatCounts[format] > 0 {
+			yr.BooksPerFormat = append(yr.BooksPerFormat, FormatCount{Format: format, Count: formatCounts[format]})
+		}
+	}
+
+	// Ties are broken by the most recent month to match BusiestMonth.
+	for month := time.December; month >= time.January; month-- {
+		if monthCounts[month] > 0 && (yr.BusiestMonth == nil || monthCounts[month] > yr.BusiestMonth.Count) {
+			yr.BusiestMonth = &BooksPerTimeItem{Time: time.Date(int(year), month, 1, 0, 0, 0, 0, time.UTC), Count: monthCounts[month]}
+		}
+	}
+
+	return yr
+}
+
+// GetYearReview returns the review of the books finished by userID in year. Private books are only included if
+// includePrivate is true. Earlier years are counted with the count_year_review_repeat_authors function because row-level
+// security hides them from visitors of a shared year.
+func GetYearReview(ctx context.Context, db dbconn, userID int64, year int32, includePrivate bool) (*YearReview, error) {
+	rows, _ := db.Query(ctx, `select `+bookColumns+`
+from books
+where user_id=$1 and status='finished' and finish_date >= make_date($2, 1, 1) and finish_date < make_date($2 + 1, 1, 1)
+	and (not private or $3)
+order by finish_date, insert_time`,
+		userID, year, includePrivate)
+	books, err := pgx.CollectRows(rows, RowToAddrOfBook)
+	if err != nil {
+		return nil, err
+	}
+
+	var repeatAuthorCount int32
+	err = db.QueryRow(ctx, "select count_year_review_repeat_authors($1, $2)", userID, year).Scan(&repeatAuthorCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewYearReview(year, books, repeatAuthorCount), nil
+}
+
+// YearReviewShare makes the year in review of a user readable by anyone who knows Token.
+type YearReviewShare struct {
+	ID         int64
+	UserID     int64
+	Year       int32
+	Token      string
+	InsertTime time.Time
+}
+
+// ShareYearReview shares the year in review of userID for year. It returns the existing share if the year is already
+// shared.
+func ShareYearReview(ctx context.Context, db dbconn, userID int64, year int32) (*YearReviewShare, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	share := &YearReviewShare{UserID: userID, Year: year}
+	err = db.QueryRow(ctx,
+		`insert into year_review_shares(user_id, year, token) values($1, $2, $3)
+on conflict (user_id, year) do update set token=year_review_shares.token
+returning id, token, insert_time`,
+		userID, year, base64.RawURLEncoding.EncodeToString(buf),
+	).Scan(&share.ID, &share.Token, &share.InsertTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// GetYearReviewShare returns the share of the year in review of userID for year. It returns a NotFoundError if the year
+// is not shared.
+func GetYearReviewShare(ctx context.Context, db dbconn, userID int64, year int32) (*YearReviewShare, error) {
+	var share YearReviewShare
+	err := db.QueryRow(ctx,
+		"select id, user_id, year, token, insert_time from year_review_shares where user_id=$1 and year=$2",
+		userID, year,
+	).Scan(&share.ID, &share.UserID, &share.Year, &share.Token, &share.InsertTime)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundError{target: fmt.Sprintf("year review share user_id=%d year=%d", userID, year)}
+		}
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// UnshareYearReview stops sharing the year in review of userID for year. The old link will no longer work if the year is
+// shared again. It returns a NotFoundError if the year is not shared.
+func UnshareYearReview(ctx context.Context, db dbconn, userID int64, year int32) error {
+	commandTag, err := db.Exec(ctx, "delete from year_review_shares where user_id=$1 and year=$2", userID, year)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		return &NotFoundError{target: fmt.Sprintf("year review share user_id=%d year=%d", userID, year)}
+	}
+	return nil
+}
+
+// FindYearReviewShare returns the user and year of the share with token. It returns a NotFoundError if token is not a
+// share. It uses the find_year_review_share function because row-level security prevents visitors from reading shares.
+func FindYearReviewShare(ctx context.Context, db dbconn, token string) (*UserMin, int32, error) {
+	var user UserMin
+	var year int32
+	err := db.QueryRow(ctx, "select user_id, username, time_zone, year from find_year_review_share($1)", token).Scan(
+		&user.ID, &user.Username, &user.TimeZone, &year,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, &NotFoundError{target: "year review share"}
+		}
+		return nil, 0, err
+	}
+
+	return &user, year, nil
+}
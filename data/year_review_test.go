@@ -0,0 +1,130 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewYearReview(t *testing.T) {
+	t.Parallel()
+
+	review := data.NewYearReview(2020, nil, 0)
+	require.Nil(t, review.FirstBook())
+	require.Nil(t, review.LastBook())
+	require.Nil(t, review.BusiestMonth)
+
+	books := []*data.Book{
+		{Title: "Emma", Author: "Jane Austen", FinishDate: date(2020, 1, 5), Format: "audio"},
+		{Title: "Dune", Author: "Frank Herbert", FinishDate: date(2020, 3, 1), Format: "text"},
+		{Title: "Persuasion", Author: "jane austen", FinishDate: date(2020, 3, 20), Format: "text"},
+		{Title: "Ulysses", Author: "James Joyce", FinishDate: date(2020, 6, 1), Format: "text"},
+		{Title: "Dubliners", Author: "James Joyce", FinishDate: date(2020, 6, 2), Format: "text"},
+	}
+	review = data.NewYearReview(2020, books, 1)
+	require.Equal(t, "Emma", review.FirstBook().Title)
+	require.Equal(t, "Dubliners", review.LastBook().Title)
+	require.Equal(t, []data.FormatCount{{"text", 4}, {"audio", 1}}, review.BooksPerFormat)
+	require.Equal(t, &data.BooksPerTimeItem{Time: date(2020, 6, 1), Count: 2}, review.BusiestMonth)
+	require.EqualValues(t, 2, review.NewAuthorCount)
+	require.EqualValues(t, 1, review.RepeatAuthorCount)
+}
+
+func TestYearReviewShares(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	for _, book := range []data.Book{
+		{Title: "Emma", Author: "Jane Austen", FinishDate: date(2019, 5, 1), Format: "text"},
+		{Title: "Persuasion", Author: "Jane Austen", FinishDate: date(2020, 2, 1), Format: "text"},
+		{Title: "Dune", Author: "Frank Herbert", FinishDate: date(2020, 3, 1), Format: "audio"},
+		{Title: "Ulysses", Author: "James Joyce", FinishDate: date(2021, 1, 1), Format: "text"},
+	} {
+		book.UserID = userID
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	_, err = data.GetYearReviewShare(ctx, tx, userID, 2020)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+
+	share, err := data.ShareYearReview(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.NotEmpty(t, share.Token)
+
+	// Sharing again keeps the existing link.
+	again, err := data.ShareYearReview(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.Equal(t, share.Token, again.Token)
+
+	found, err := data.GetYearReviewShare(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+	require.Equal(t, share.ID, found.ID)
+
+	// Act as the application role with no user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	owner, year, err := data.FindYearReviewShare(ctx, tx, share.Token)
+	require.NoError(t, err)
+	require.Equal(t, userID, owner.ID)
+	require.Equal(t, "test", owner.Username)
+	require.EqualValues(t, 2020, year)
+
+	_, _, err = data.FindYearReviewShare(ctx, tx, share.Token+"x")
+	require.ErrorAs(t, err, &nfErr)
+
+	review, err := data.GetYearReview(ctx, tx, userID, 2020, true)
+	require.NoError(t, err)
+	require.Len(t, review.Books, 2)
+	require.Equal(t, "Persuasion", review.FirstBook().Title)
+	require.EqualValues(t, 1, review.RepeatAuthorCount)
+	require.EqualValues(t, 1, review.NewAuthorCount)
+
+	// Other years remain private.
+	review, err = data.GetYearReview(ctx, tx, userID, 2021, true)
+	require.NoError(t, err)
+	require.Empty(t, review.Books)
+
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', $1::text, true)", userID)
+	require.NoError(t, err)
+
+	err = data.UnshareYearReview(ctx, tx, userID, 2020)
+	require.NoError(t, err)
+
+	err = data.UnshareYearReview(ctx, tx, userID, 2020)
+	require.ErrorAs(t, err, &nfErr)
+
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	_, _, err = data.FindYearReviewShare(ctx, tx, share.Token)
+	require.ErrorAs(t, err, &nfErr)
+
+	review, err = data.GetYearReview(ctx, tx, userID, 2020, true)
+	require.NoError(t, err)
+	require.Empty(t, review.Books)
+	require.Zero(t, review.RepeatAuthorCount)
+}
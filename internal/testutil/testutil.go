@@ -0,0 +1,21 @@
+// Package testutil contains helpers shared by the tests of several packages.
+package testutil
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// SetAppRole switches tx to the application role so row-level security applies as it does in the web server. The role
+// is read from BOOKLOG_TEST_APP_USER. It must be the app_user the migrations were run with.
+func SetAppRole(t testing.TB, ctx context.Context, tx pgx.Tx) {
+	t.Helper()
+	appUser := os.Getenv("BOOKLOG_TEST_APP_USER")
+	require.NotEmpty(t, appUser, "BOOKLOG_TEST_APP_USER must be set")
+	_, err := tx.Exec(ctx, "set local role "+pgx.Identifier{appUser}.Sanitize())
+	require.NoError(t, err)
+}
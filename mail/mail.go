@@ -0,0 +1,127 @@
+// Package mail sends plain text email.
+//
+// Handlers depend on the Mailer interface. SMTPMailer delivers mail to a real SMTP server. LocalMailer keeps mail in
+// memory and optionally writes it to files so tests and development mode do not need an SMTP server.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Bytes returns msg as an RFC 5322 message from from. It returns an error if a header would contain a line break.
+func (msg *Message) Bytes(from string, date time.Time) ([]byte, error) {
+	for _, s := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(s, "\r\n") {
+			return nil, errors.New("mail header contains a line break")
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return buf.Bytes(), nil
+}
+
+// SMTPMailer sends mail through an SMTP server. STARTTLS is used when the server supports it.
+type SMTPMailer struct {
+	Addr     string // host:port of the SMTP server.
+	Username string // Authentication is skipped if Username is empty.
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	b, err := msg.Bytes(m.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, b)
+}
+
+// LocalMailer keeps sent mail in memory instead of delivering it. If Dir is set each message is also written to a file
+// in Dir so it can be read during development.
+type LocalMailer struct {
+	Dir  string
+	From string
+
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (m *LocalMailer) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	b, err := msg.Bytes(m.From, now)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	if m.Dir != "" {
+		err := os.MkdirAll(m.Dir, 0o755)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405.000000000Z"), len(m.messages))
+		err = os.WriteFile(filepath.Join(m.Dir, name), b, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Messages returns all messages sent so far in the order they were sent.
+func (m *LocalMailer) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]*Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/mail"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes(t *testing.T) {
+	t.Parallel()
+
+	msg := &mail.Message{To: "jack@example.com", Subject: "Réinitialiser", Body: "Line 1\nLine 2\n"}
+	b, err := msg.Bytes("booklog@example.com", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, "From: booklog@example.com\r\n"+
+		"To: jack@example.com\r\n"+
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n"+
+		"Date: Thu, 02 Jan 2020 03:04:05 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: 8bit\r\n"+
+		"\r\n"+
+		"Line 1\r\nLine 2\r\n", string(b))
+
+	// Line breaks in headers would allow injecting headers.
+	msg = &mail.Message{To: "jack@example.com\r\nBcc: eve@example.com", Subject: "Hi", Body: "Hi"}
+	_, err = msg.Bytes("booklog@example.com", time.Now())
+	require.Error(t, err)
+}
+
+func TestLocalMailer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mailer := &mail.LocalMailer{Dir: dir, From: "booklog@example.com"}
+
+	require.NoError(t, mailer.Send(context.Background(), &mail.Message{To: "a@example.com", Subject: "First", Body: "1"}))
+	require.NoError(t, mailer.Send(context.Background(), &mail.Message{To: "b@example.com", Subject: "Second", Body: "2"}))
+
+	messages := mailer.Messages()
+	require.Len(t, messages, 2)
+	require.Equal(t, "First", messages[0].Subject)
+	require.Equal(t, "Second", messages[1].Subject)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), "From: booklog@example.com\r\nTo: a@example.com\r\n"))
+}
@@ -1,6 +1,11 @@
 package main
 
-import "github.com/jackc/booklog/cmd"
+import (
+	// Embed the time zone database so user time zones work on hosts without one.
+	_ "time/tzdata"
+
+	"github.com/jackc/booklog/cmd"
+)
 
 func main() {
 	cmd.Execute()
@@ -0,0 +1,58 @@
+-- The application sets booklog.user_id to the authenticated user's ID whenever it acquires a connection for a request and
+-- resets it when the connection is released. Rows owned by other users are invisible and cannot be written.
+create function current_booklog_user_id() returns bigint
+language sql
+stable
+as $$
+  select nullif(current_setting('booklog.user_id', true), '')::bigint;
+$$;
+
+alter table books enable row level security;
+
+create policy books_owner on books
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+alter table user_sessions enable row level security;
+
+create policy user_sessions_owner on user_sessions
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- Sessions must be created and looked up before the user is known. These functions are the only way to do so.
+create function create_user_session(_user_id bigint) returns uuid
+language sql
+security definer
+set search_path = public
+as $$
+  insert into user_sessions(user_id) values (_user_id) returning id;
+$$;
+
+create function find_user_session(_id uuid) returns table(id uuid, user_id bigint, username text)
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select user_sessions.id, users.id, users.username
+  from user_sessions
+    join users on user_sessions.user_id=users.id
+  where user_sessions.id=_id;
+$$;
+
+grant execute on function current_booklog_user_id() to {{.app_user}};
+grant execute on function create_user_session(bigint) to {{.app_user}};
+grant execute on function find_user_session(uuid) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function find_user_session(uuid);
+drop function create_user_session(bigint);
+
+drop policy user_sessions_owner on user_sessions;
+alter table user_sessions disable row level security;
+
+drop policy books_owner on books;
+alter table books disable row level security;
+
+drop function current_booklog_user_id();
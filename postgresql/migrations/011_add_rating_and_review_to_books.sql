@@ -0,0 +1,9 @@
+alter table books
+  add column rating numeric(2,1) check (rating between 0.5 and 5 and rating * 2 = trunc(rating * 2)),
+  add column review text;
+
+---- create above / drop below ----
+
+alter table books
+  drop column review,
+  drop column rating;
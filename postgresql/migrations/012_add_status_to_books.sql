@@ -0,0 +1,19 @@
+alter table books
+  add column status text not null default 'finished' check (status in ('want_to_read', 'reading', 'finished', 'abandoned')),
+  add column start_date date,
+  alter column finish_date drop not null,
+  add constraint books_finished_has_finish_date check (status <> 'finished' or finish_date is not null);
+
+create index on books (user_id, status);
+
+---- create above / drop below ----
+
+delete from books where finish_date is null;
+
+drop index books_user_id_status_idx;
+
+alter table books
+  drop constraint books_finished_has_finish_date,
+  alter column finish_date set not null,
+  drop column start_date,
+  drop column status;
@@ -0,0 +1,47 @@
+create table tags (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  name text not null,
+  insert_time timestamptz not null default now(),
+  update_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('tags', 'id', 'tag_id_seq');
+
+create unique index on tags (user_id, lower(name));
+
+create trigger on_tag_update
+before update on tags
+for each row execute procedure timestamp_update();
+
+create table book_tags (
+  book_id bigint not null references books on delete cascade,
+  tag_id bigint not null references tags on delete cascade,
+  primary key (book_id, tag_id)
+);
+
+create index on book_tags (tag_id);
+
+alter table tags enable row level security;
+
+create policy tags_owner on tags
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+alter table book_tags enable row level security;
+
+create policy book_tags_owner on book_tags
+  using (book_id in (select id from books where user_id = current_booklog_user_id()))
+  with check (
+    book_id in (select id from books where user_id = current_booklog_user_id())
+    and tag_id in (select id from tags where user_id = current_booklog_user_id())
+  );
+
+grant select, insert, update, delete on table tags to {{.app_user}};
+grant usage on sequence tag_id_seq to {{.app_user}};
+grant select, insert, update, delete on table book_tags to {{.app_user}};
+
+---- create above / drop below ----
+
+drop table book_tags;
+drop table tags;
+drop sequence tag_id_seq;
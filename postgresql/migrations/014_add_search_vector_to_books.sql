@@ -0,0 +1,12 @@
+alter table books add column search_vector tsvector generated always as (
+  setweight(to_tsvector('english', title), 'A') ||
+  setweight(to_tsvector('english', author), 'B') ||
+  setweight(to_tsvector('english', coalesce(location, '')), 'C') ||
+  setweight(to_tsvector('english', coalesce(review, '')), 'D')
+) stored;
+
+create index on books using gin (search_vector);
+
+---- create above / drop below ----
+
+alter table books drop column search_vector;
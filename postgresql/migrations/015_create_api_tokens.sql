@@ -0,0 +1,43 @@
+-- API tokens authenticate requests to the JSON API. Only a SHA-256 digest of the token is stored. The token itself is
+-- shown to the user once when it is created.
+create table api_tokens (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  name text not null,
+  token_digest bytea not null unique,
+  last_used_time timestamptz,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('api_tokens', 'id', 'api_token_id_seq');
+
+create index on api_tokens (user_id);
+
+alter table api_tokens enable row level security;
+
+create policy api_tokens_owner on api_tokens
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- API tokens must be looked up before the user is known. This function is the only way to do so.
+create function authenticate_api_token(_token_digest bytea) returns table(user_id bigint, username text)
+language sql
+security definer
+set search_path = public
+as $$
+  update api_tokens
+  set last_used_time = now()
+  from users
+  where api_tokens.user_id=users.id
+    and api_tokens.token_digest=_token_digest
+  returning users.id, users.username;
+$$;
+
+grant select, insert, update, delete on table api_tokens to {{.app_user}};
+grant usage on sequence api_token_id_seq to {{.app_user}};
+grant execute on function authenticate_api_token(bytea) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function authenticate_api_token(bytea);
+drop table api_tokens;
+drop sequence api_token_id_seq;
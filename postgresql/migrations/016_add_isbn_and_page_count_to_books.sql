@@ -0,0 +1,9 @@
+alter table books
+  add column isbn text check (isbn ~ '^([0-9]{9}[0-9X]|[0-9]{13})$'),
+  add column page_count integer check (page_count > 0);
+
+---- create above / drop below ----
+
+alter table books
+  drop column page_count,
+  drop column isbn;
@@ -0,0 +1,25 @@
+-- An uploaded CSV file is stored until the user reviews and commits or cancels the import.
+create table book_imports (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  filename text not null,
+  records jsonb not null,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('book_imports', 'id', 'book_import_id_seq');
+
+create index on book_imports (user_id);
+
+alter table book_imports enable row level security;
+
+create policy book_imports_owner on book_imports
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+grant select, insert, update, delete on table book_imports to {{.app_user}};
+grant usage on sequence book_import_id_seq to {{.app_user}};
+
+---- create above / drop below ----
+
+drop table book_imports;
+drop sequence book_import_id_seq;
@@ -0,0 +1,35 @@
+-- An import profile is a named, reusable mapping from CSV columns to book fields.
+create table import_profiles (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  name text not null,
+  mapping jsonb not null,
+  insert_time timestamptz not null default now(),
+  update_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('import_profiles', 'id', 'import_profile_id_seq');
+
+create unique index on import_profiles (user_id, lower(name));
+
+create trigger on_import_profile_update
+before update on import_profiles
+for each row execute procedure timestamp_update();
+
+alter table import_profiles enable row level security;
+
+create policy import_profiles_owner on import_profiles
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+grant select, insert, update, delete on table import_profiles to {{.app_user}};
+grant usage on sequence import_profile_id_seq to {{.app_user}};
+
+-- The mapping chosen for an import. Null means the format is detected from the header row.
+alter table book_imports add column mapping jsonb;
+
+---- create above / drop below ----
+
+alter table book_imports drop column mapping;
+
+drop table import_profiles;
+drop sequence import_profile_id_seq;
@@ -0,0 +1,31 @@
+-- A reading goal is a target number of books to finish in a calendar year. A null format means books of any format.
+create table reading_goals (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  year integer not null,
+  format text check (format in ('text', 'audio', 'video')),
+  target integer not null check (target > 0),
+  insert_time timestamptz not null default now(),
+  update_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('reading_goals', 'id', 'reading_goal_id_seq');
+
+create unique index on reading_goals (user_id, year, coalesce(format, ''));
+
+create trigger on_reading_goal_update
+before update on reading_goals
+for each row execute procedure timestamp_update();
+
+alter table reading_goals enable row level security;
+
+create policy reading_goals_owner on reading_goals
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+grant select, insert, update, delete on table reading_goals to {{.app_user}};
+grant usage on sequence reading_goal_id_seq to {{.app_user}};
+
+---- create above / drop below ----
+
+drop table reading_goals;
+drop sequence reading_goal_id_seq;
@@ -0,0 +1,9 @@
+-- time_zone is an IANA time zone name. It determines the current date of the user for validation and analysis. It is
+-- validated by the application because PostgreSQL and Go may not have identical time zone databases.
+alter table users
+  add column time_zone text not null default 'UTC';
+
+---- create above / drop below ----
+
+alter table users
+  drop column time_zone;
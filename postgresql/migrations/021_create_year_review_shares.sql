@@ -0,0 +1,80 @@
+-- A year review share makes the year in review of a user readable by anyone with the link. The token is the only way to
+-- find the share so it must be unguessable.
+create table year_review_shares (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  year integer not null,
+  token text not null unique,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('year_review_shares', 'id', 'year_review_share_id_seq');
+
+create unique index on year_review_shares (user_id, year);
+
+alter table year_review_shares enable row level security;
+
+create policy year_review_shares_owner on year_review_shares
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- Shares must be looked up by visitors who are not the owner. This function is the only way to do so.
+create function find_year_review_share(_token text) returns table(user_id bigint, username text, time_zone text, year integer)
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select users.id, users.username, users.time_zone, year_review_shares.year
+  from year_review_shares
+    join users on year_review_shares.user_id=users.id
+  where year_review_shares.token=_token;
+$$;
+
+create function is_year_review_shared(_user_id bigint, _year integer) returns boolean
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select exists(select 1 from year_review_shares where user_id=_user_id and year=_year);
+$$;
+
+-- The year in review counts authors who were also read in earlier years. Visitors cannot read those books so the count
+-- is only available through this function. It returns 0 unless the year is shared or belongs to the current user.
+create function count_year_review_repeat_authors(_user_id bigint, _year integer) returns integer
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select count(distinct lower(author))::integer
+  from books
+  where user_id=_user_id
+    and status='finished'
+    and finish_date >= make_date(_year, 1, 1)
+    and finish_date < make_date(_year + 1, 1, 1)
+    and lower(author) in (
+      select lower(author) from books where user_id=_user_id and status='finished' and finish_date < make_date(_year, 1, 1)
+    )
+    and (_user_id = current_booklog_user_id() or is_year_review_shared(_user_id, _year));
+$$;
+
+-- Finished books in a shared year are readable by anyone.
+create policy books_shared_year_review on books
+  for select
+  using (status = 'finished' and is_year_review_shared(user_id, extract(year from finish_date)::integer));
+
+grant select, insert, update, delete on table year_review_shares to {{.app_user}};
+grant usage on sequence year_review_share_id_seq to {{.app_user}};
+grant execute on function find_year_review_share(text) to {{.app_user}};
+grant execute on function is_year_review_shared(bigint, integer) to {{.app_user}};
+grant execute on function count_year_review_repeat_authors(bigint, integer) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop policy books_shared_year_review on books;
+drop function count_year_review_repeat_authors(bigint, integer);
+drop function is_year_review_shared(bigint, integer);
+drop function find_year_review_share(text);
+drop table year_review_shares;
+drop sequence year_review_share_id_seq;
@@ -0,0 +1,96 @@
+-- A private user's books are only visible to that user. The non-private books of unlisted and public users are visible
+-- to anyone. Unlisted users are not listed or indexed by search engines.
+alter table users
+  add column visibility text not null default 'private' check (visibility in ('private', 'unlisted', 'public'));
+
+-- A private book is only visible to its owner regardless of the visibility of the owner.
+alter table books
+  add column private boolean not null default false;
+
+create policy books_visible on books
+  for select
+  using (
+    not private
+    and exists (select 1 from users where users.id=books.user_id and users.visibility in ('unlisted', 'public'))
+  );
+
+-- The subqueries are subject to the policies of books and book_tags so only tags of visible books are visible.
+create policy book_tags_visible on book_tags
+  for select
+  using (book_id in (select id from books));
+
+create policy tags_visible on tags
+  for select
+  using (id in (select tag_id from book_tags));
+
+-- Private books are excluded from shared years in review.
+drop policy books_shared_year_review on books;
+
+create policy books_shared_year_review on books
+  for select
+  using (
+    status = 'finished'
+    and not private
+    and is_year_review_shared(user_id, extract(year from finish_date)::integer)
+  );
+
+-- Authors of private books are only counted for the owner.
+create or replace function count_year_review_repeat_authors(_user_id bigint, _year integer) returns integer
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select count(distinct lower(author))::integer
+  from books
+  where user_id=_user_id
+    and status='finished'
+    and finish_date >= make_date(_year, 1, 1)
+    and finish_date < make_date(_year + 1, 1, 1)
+    and (not private or _user_id = current_booklog_user_id())
+    and lower(author) in (
+      select lower(author)
+      from books
+      where user_id=_user_id
+        and status='finished'
+        and finish_date < make_date(_year, 1, 1)
+        and (not private or _user_id = current_booklog_user_id())
+    )
+    and (_user_id = current_booklog_user_id() or is_year_review_shared(_user_id, _year));
+$$;
+
+---- create above / drop below ----
+
+create or replace function count_year_review_repeat_authors(_user_id bigint, _year integer) returns integer
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select count(distinct lower(author))::integer
+  from books
+  where user_id=_user_id
+    and status='finished'
+    and finish_date >= make_date(_year, 1, 1)
+    and finish_date < make_date(_year + 1, 1, 1)
+    and lower(author) in (
+      select lower(author) from books where user_id=_user_id and status='finished' and finish_date < make_date(_year, 1, 1)
+    )
+    and (_user_id = current_booklog_user_id() or is_year_review_shared(_user_id, _year));
+$$;
+
+drop policy books_shared_year_review on books;
+
+create policy books_shared_year_review on books
+  for select
+  using (status = 'finished' and is_year_review_shared(user_id, extract(year from finish_date)::integer));
+
+drop policy tags_visible on tags;
+drop policy book_tags_visible on book_tags;
+drop policy books_visible on books;
+
+alter table books
+  drop column private;
+
+alter table users
+  drop column visibility;
@@ -0,0 +1,31 @@
+-- A follow makes the finished books of the followee appear in the feed of the follower. Only the follower can see or
+-- change their follows.
+create table follows (
+  id bigint primary key,
+  follower_id bigint not null references users on delete cascade,
+  followee_id bigint not null references users on delete cascade,
+  insert_time timestamptz not null default now(),
+  check (follower_id <> followee_id)
+);
+select set_default_to_next_duid_block('follows', 'id', 'follow_id_seq');
+
+create unique index on follows (follower_id, followee_id);
+create index on follows (followee_id);
+
+-- The feed is ordered by finish date across all followed users.
+create index on books (user_id, finish_date desc, insert_time desc, id desc) where status = 'finished' and not private;
+
+alter table follows enable row level security;
+
+create policy follows_follower on follows
+  using (follower_id = current_booklog_user_id())
+  with check (follower_id = current_booklog_user_id());
+
+grant select, insert, update, delete on table follows to {{.app_user}};
+grant usage on sequence follow_id_seq to {{.app_user}};
+
+---- create above / drop below ----
+
+drop index books_user_id_finish_date_insert_time_id_idx;
+drop table follows;
+drop sequence follow_id_seq;
@@ -0,0 +1,53 @@
+-- A calendar token lets calendar applications, which cannot log in, subscribe to the calendar of a user whose books are
+-- private. The token is shown to the user as part of the subscription link so it is stored as is. Each user has at most
+-- one token and resetting it makes old links stop working.
+create table calendar_tokens (
+  id bigint primary key,
+  user_id bigint not null unique references users on delete cascade,
+  token text not null unique,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('calendar_tokens', 'id', 'calendar_token_id_seq');
+
+alter table calendar_tokens enable row level security;
+
+create policy calendar_tokens_owner on calendar_tokens
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+create function is_calendar_token(_user_id bigint, _token text) returns boolean
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select exists(select 1 from calendar_tokens where user_id=_user_id and token=_token);
+$$;
+
+-- Calendar applications are not authenticated so row-level security would hide the books of private users. This function
+-- is the only way to read them with a calendar token. Private books are never included.
+create function find_calendar_books(_user_id bigint, _token text) returns setof books
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select books.*
+  from books
+  where books.user_id=_user_id
+    and books.status='finished'
+    and not books.private
+    and is_calendar_token(_user_id, _token);
+$$;
+
+grant select, insert, update, delete on table calendar_tokens to {{.app_user}};
+grant usage on sequence calendar_token_id_seq to {{.app_user}};
+grant execute on function is_calendar_token(bigint, text) to {{.app_user}};
+grant execute on function find_calendar_books(bigint, text) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function find_calendar_books(bigint, text);
+drop function is_calendar_token(bigint, text);
+drop table calendar_tokens;
+drop sequence calendar_token_id_seq;
@@ -0,0 +1,70 @@
+-- Display preferences. They are validated by the application like time_zone.
+alter table users
+  add column default_book_sort text not null default 'finish_date',
+  add column books_per_page integer not null default 100;
+
+-- When a user changes their username the old username redirects to the new one so existing links keep working. A
+-- username that is taken by a user never has a redirect. This is maintained by the username_redirects_update trigger.
+create table username_redirects (
+  id bigint primary key,
+  username text not null unique,
+  user_id bigint not null references users on delete cascade,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('username_redirects', 'id', 'username_redirect_id_seq');
+
+create index on username_redirects (user_id);
+
+alter table username_redirects enable row level security;
+
+create policy username_redirects_owner on username_redirects
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- A redirect may belong to a user other than the one taking the username so the trigger must bypass row-level security.
+create function username_redirects_update() returns trigger
+language plpgsql
+security definer
+set search_path = public
+as $$
+  begin
+    delete from username_redirects where username=new.username;
+    if tg_op = 'UPDATE' and new.username <> old.username then
+      insert into username_redirects(username, user_id) values (old.username, new.id);
+    end if;
+    return null;
+  end;
+$$;
+
+create trigger on_user_username_change
+after insert or update of username on users
+for each row execute procedure username_redirects_update();
+
+-- Redirects must be followed by visitors who are not the owner. This function is the only way to do so.
+create function find_username_redirect(_username text) returns text
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select users.username
+  from username_redirects
+    join users on username_redirects.user_id=users.id
+  where username_redirects.username=_username;
+$$;
+
+grant select, insert, update, delete on table username_redirects to {{.app_user}};
+grant usage on sequence username_redirect_id_seq to {{.app_user}};
+grant execute on function find_username_redirect(text) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function find_username_redirect(text);
+drop trigger on_user_username_change on users;
+drop function username_redirects_update();
+drop table username_redirects;
+drop sequence username_redirect_id_seq;
+
+alter table users
+  drop column books_per_page,
+  drop column default_book_sort;
@@ -0,0 +1,109 @@
+-- email is optional. It is only used to reset a forgotten password so it must identify a single user.
+alter table users
+  add column email text;
+
+create unique index users_lower_email_idx on users (lower(email));
+
+-- A password reset token lets a user who forgot their password set a new one. The token is emailed to the user and only
+-- a SHA-256 digest is stored. A token can be used once and only until expire_time.
+create table password_reset_tokens (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  token_digest bytea not null unique,
+  expire_time timestamptz not null,
+  insert_time timestamptz not null default now()
+);
+select set_default_to_next_duid_block('password_reset_tokens', 'id', 'password_reset_token_id_seq');
+
+create index on password_reset_tokens (user_id);
+
+alter table password_reset_tokens enable row level security;
+
+create policy password_reset_tokens_owner on password_reset_tokens
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- Password reset tokens are created and used before the user is known. These functions are the only way to do so.
+
+-- create_password_reset_token creates a token for the user with _email. Expired tokens of the user are deleted. It
+-- returns no rows if no user has _email.
+create function create_password_reset_token(_email text, _token_digest bytea, _expire_time timestamptz, _now timestamptz)
+returns table(user_id bigint, username text, email text)
+language plpgsql
+security definer
+set search_path = public
+as $$
+  declare
+    _user_id bigint;
+  begin
+    select users.id into _user_id from users where lower(users.email)=lower(_email);
+    if _user_id is null then
+      return;
+    end if;
+
+    delete from password_reset_tokens where password_reset_tokens.user_id=_user_id and expire_time <= _now;
+    insert into password_reset_tokens(user_id, token_digest, expire_time) values (_user_id, _token_digest, _expire_time);
+
+    return query select users.id, users.username, users.email from users where users.id=_user_id;
+  end;
+$$;
+
+create function find_password_reset_token(_token_digest bytea, _now timestamptz) returns table(user_id bigint, username text)
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select users.id, users.username
+  from password_reset_tokens
+    join users on password_reset_tokens.user_id=users.id
+  where password_reset_tokens.token_digest=_token_digest
+    and password_reset_tokens.expire_time > _now;
+$$;
+
+-- reset_password sets the password digest of the user with the unexpired token _token_digest. All reset tokens and
+-- sessions of the user are deleted so the token cannot be used again and anyone who knew the old password is logged out.
+-- It returns no rows if the token is not valid.
+create function reset_password(_token_digest bytea, _password_digest text, _now timestamptz)
+returns table(user_id bigint, username text)
+language plpgsql
+security definer
+set search_path = public
+as $$
+  declare
+    _user_id bigint;
+    _expired boolean;
+  begin
+    -- The token is deleted even if it has expired.
+    delete from password_reset_tokens
+    where token_digest=_token_digest
+    returning password_reset_tokens.user_id, expire_time <= _now into _user_id, _expired;
+
+    if _user_id is null or _expired then
+      return;
+    end if;
+
+    update users set password_digest=_password_digest where users.id=_user_id;
+    delete from password_reset_tokens where password_reset_tokens.user_id=_user_id;
+    delete from user_sessions where user_sessions.user_id=_user_id;
+
+    return query select users.id, users.username from users where users.id=_user_id;
+  end;
+$$;
+
+grant select, insert, update, delete on table password_reset_tokens to {{.app_user}};
+grant usage on sequence password_reset_token_id_seq to {{.app_user}};
+grant execute on function create_password_reset_token(text, bytea, timestamptz, timestamptz) to {{.app_user}};
+grant execute on function find_password_reset_token(bytea, timestamptz) to {{.app_user}};
+grant execute on function reset_password(bytea, text, timestamptz) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function reset_password(bytea, text, timestamptz);
+drop function find_password_reset_token(bytea, timestamptz);
+drop function create_password_reset_token(text, bytea, timestamptz, timestamptz);
+drop table password_reset_tokens;
+drop sequence password_reset_token_id_seq;
+
+alter table users
+  drop column email;
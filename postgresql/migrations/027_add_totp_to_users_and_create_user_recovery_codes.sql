@@ -0,0 +1,56 @@
+-- totp_secret is the RFC 6238 secret key of a user who enabled two-factor authentication. It is null otherwise.
+-- totp_last_step is the time step of the last code used to log in so the same code cannot be used twice.
+-- totp_failed_attempts and totp_locked_until limit guessing codes.
+alter table users
+  add column totp_secret bytea,
+  add column totp_last_step bigint,
+  add column totp_failed_attempts int not null default 0,
+  add column totp_locked_until timestamptz;
+
+-- Recovery codes let a user who lost their authenticator log in. Each can be used once. Only a SHA-256 digest is stored.
+create table user_recovery_codes (
+  id bigint primary key,
+  user_id bigint not null references users on delete cascade,
+  code_digest bytea not null,
+  insert_time timestamptz not null default now(),
+  unique (user_id, code_digest)
+);
+select set_default_to_next_duid_block('user_recovery_codes', 'id', 'user_recovery_code_id_seq');
+
+alter table user_recovery_codes enable row level security;
+
+create policy user_recovery_codes_owner on user_recovery_codes
+  using (user_id = current_booklog_user_id())
+  with check (user_id = current_booklog_user_id());
+
+-- Recovery codes are used to log in before the user is authenticated. This function is the only way to do so. It returns
+-- true if _code_digest was a recovery code of _user_id. The code is deleted so it cannot be used again.
+create function use_user_recovery_code(_user_id bigint, _code_digest bytea) returns boolean
+language sql
+security definer
+set search_path = public
+as $$
+  with deleted as (
+    delete from user_recovery_codes
+    where user_id=_user_id
+      and code_digest=_code_digest
+    returning 1
+  )
+  select exists(select 1 from deleted);
+$$;
+
+grant select, insert, update, delete on table user_recovery_codes to {{.app_user}};
+grant usage on sequence user_recovery_code_id_seq to {{.app_user}};
+grant execute on function use_user_recovery_code(bigint, bytea) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function use_user_recovery_code(bigint, bytea);
+drop table user_recovery_codes;
+drop sequence user_recovery_code_id_seq;
+
+alter table users
+  drop column totp_locked_until,
+  drop column totp_failed_attempts,
+  drop column totp_last_step,
+  drop column totp_secret;
@@ -0,0 +1,111 @@
+-- public_id identifies a session on the sessions page. The id is the secret in the session cookie so it is never shown.
+-- last_seen_time is when the session was last used. It is used for the idle timeout. user_agent and remote_addr describe
+-- the browser that created the session and where it was last used from.
+alter table user_sessions
+  add column public_id bigint,
+  add column last_seen_time timestamptz not null default now(),
+  add column user_agent text not null default '',
+  add column remote_addr text not null default '';
+
+select set_default_to_next_duid_block('user_sessions', 'public_id', 'user_session_public_id_seq');
+update user_sessions set public_id=nextval('user_session_public_id_seq'), last_seen_time=login_time;
+
+alter table user_sessions
+  alter column public_id set not null,
+  add unique (public_id);
+
+grant usage on sequence user_session_public_id_seq to {{.app_user}};
+
+drop function create_user_session(bigint);
+drop function find_user_session(uuid);
+
+create function create_user_session(_user_id bigint, _user_agent text, _remote_addr text) returns uuid
+language sql
+security definer
+set search_path = public
+as $$
+  insert into user_sessions(user_id, user_agent, remote_addr) values (_user_id, _user_agent, _remote_addr) returning id;
+$$;
+
+create function find_user_session(_id uuid)
+returns table(id uuid, public_id bigint, user_id bigint, username text, user_agent text, remote_addr text, login_time timestamptz, last_seen_time timestamptz)
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select user_sessions.id, user_sessions.public_id, users.id, users.username, user_sessions.user_agent,
+    user_sessions.remote_addr, user_sessions.login_time, user_sessions.last_seen_time
+  from user_sessions
+    join users on user_sessions.user_id=users.id
+  where user_sessions.id=_id;
+$$;
+
+-- touch_user_session records that the session _id was used at _now from _remote_addr. It is called before the user is
+-- authenticated.
+create function touch_user_session(_id uuid, _remote_addr text, _now timestamptz) returns void
+language sql
+security definer
+set search_path = public
+as $$
+  update user_sessions set last_seen_time=_now, remote_addr=_remote_addr where id=_id;
+$$;
+
+-- purge_expired_user_sessions deletes the sessions of all users that were created at or before _login_time_before or last
+-- used at or before _last_seen_time_before. It returns the number of deleted sessions.
+create function purge_expired_user_sessions(_login_time_before timestamptz, _last_seen_time_before timestamptz) returns bigint
+language sql
+security definer
+set search_path = public
+as $$
+  with deleted as (
+    delete from user_sessions
+    where login_time <= _login_time_before
+      or last_seen_time <= _last_seen_time_before
+    returning 1
+  )
+  select count(*) from deleted;
+$$;
+
+grant execute on function create_user_session(bigint, text, text) to {{.app_user}};
+grant execute on function find_user_session(uuid) to {{.app_user}};
+grant execute on function touch_user_session(uuid, text, timestamptz) to {{.app_user}};
+grant execute on function purge_expired_user_sessions(timestamptz, timestamptz) to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function purge_expired_user_sessions(timestamptz, timestamptz);
+drop function touch_user_session(uuid, text, timestamptz);
+drop function find_user_session(uuid);
+drop function create_user_session(bigint, text, text);
+
+create function create_user_session(_user_id bigint) returns uuid
+language sql
+security definer
+set search_path = public
+as $$
+  insert into user_sessions(user_id) values (_user_id) returning id;
+$$;
+
+create function find_user_session(_id uuid) returns table(id uuid, user_id bigint, username text)
+language sql
+stable
+security definer
+set search_path = public
+as $$
+  select user_sessions.id, users.id, users.username
+  from user_sessions
+    join users on user_sessions.user_id=users.id
+  where user_sessions.id=_id;
+$$;
+
+grant execute on function create_user_session(bigint) to {{.app_user}};
+grant execute on function find_user_session(uuid) to {{.app_user}};
+
+alter table user_sessions
+  drop column remote_addr,
+  drop column user_agent,
+  drop column last_seen_time,
+  drop column public_id;
+
+drop sequence user_session_public_id_seq;
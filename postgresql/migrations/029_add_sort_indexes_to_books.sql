@@ -0,0 +1,13 @@
+-- The book index is paginated by keyset on the sort expression and id. These indexes match the order by of each sort so
+-- a page only reads the rows it returns.
+create index books_user_id_finish_date_sort_idx on books (user_id, coalesce(finish_date, '-infinity') desc, id desc);
+create index books_user_id_title_sort_idx on books (user_id, lower(title), id);
+create index books_user_id_author_sort_idx on books (user_id, lower(author), id);
+create index books_user_id_insert_time_sort_idx on books (user_id, insert_time desc, id desc);
+
+---- create above / drop below ----
+
+drop index books_user_id_insert_time_sort_idx;
+drop index books_user_id_author_sort_idx;
+drop index books_user_id_title_sort_idx;
+drop index books_user_id_finish_date_sort_idx;
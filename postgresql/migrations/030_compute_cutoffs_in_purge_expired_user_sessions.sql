@@ -0,0 +1,40 @@
+drop function purge_expired_user_sessions(timestamptz, timestamptz);
+
+-- purge_expired_user_sessions deletes the sessions of all users that have expired. It is granted to the app role so it
+-- computes the cutoffs itself instead of trusting its caller. The intervals must match data.SessionMaxAge and
+-- data.SessionIdleTimeout. It returns the number of deleted sessions.
+create function purge_expired_user_sessions() returns bigint
+language sql
+security definer
+set search_path = public
+as $$
+  with deleted as (
+    delete from user_sessions
+    where login_time <= now() - interval '90 days'
+      or last_seen_time <= now() - interval '14 days'
+    returning 1
+  )
+  select count(*) from deleted;
+$$;
+
+grant execute on function purge_expired_user_sessions() to {{.app_user}};
+
+---- create above / drop below ----
+
+drop function purge_expired_user_sessions();
+
+create function purge_expired_user_sessions(_login_time_before timestamptz, _last_seen_time_before timestamptz) returns bigint
+language sql
+security definer
+set search_path = public
+as $$
+  with deleted as (
+    delete from user_sessions
+    where login_time <= _login_time_before
+      or last_seen_time <= _last_seen_time_before
+    returning 1
+  )
+  select count(*) from deleted;
+$$;
+
+grant execute on function purge_expired_user_sessions(timestamptz, timestamptz) to {{.app_user}};
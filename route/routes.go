@@ -2,6 +2,7 @@ package route
 
 import (
 	"fmt"
+	"net/url"
 )
 
 func UserHomePath(username string) string {
@@ -12,6 +13,18 @@ func BooksPath(username string) string {
 	return fmt.Sprintf("/users/%s/books", username)
 }
 
+// BookShelfPath returns the path to the list of books with status. Finished books are at BooksPath.
+func BookShelfPath(username string, status string) string {
+	if status == "finished" {
+		return BooksPath(username)
+	}
+	return fmt.Sprintf("/users/%s/books/shelves/%s", username, status)
+}
+
+func BookSearchPath(username string) string {
+	return fmt.Sprintf("/users/%s/books/search", username)
+}
+
 func BookPath(username string, id int64) string {
 	return fmt.Sprintf("/users/%s/books/%d", username, id)
 }
@@ -24,6 +37,18 @@ func EditBookPath(username string, id int64) string {
 	return fmt.Sprintf("/users/%s/books/%d/edit", username, id)
 }
 
+func StartReadingBookPath(username string, id int64) string {
+	return fmt.Sprintf("/users/%s/books/%d/start_reading", username, id)
+}
+
+func FinishBookPath(username string, id int64) string {
+	return fmt.Sprintf("/users/%s/books/%d/finish", username, id)
+}
+
+func AbandonBookPath(username string, id int64) string {
+	return fmt.Sprintf("/users/%s/books/%d/abandon", username, id)
+}
+
 func NewBookPath(username string) string {
 	return fmt.Sprintf("/users/%s/books/new", username)
 }
@@ -40,6 +65,14 @@ func ExportBookCSVPath(username string) string {
 	return fmt.Sprintf("/users/%s/books.csv", username)
 }
 
+func TagsPath(username string) string {
+	return fmt.Sprintf("/users/%s/tags", username)
+}
+
+func TagPath(username string, tag string) string {
+	return fmt.Sprintf("/users/%s/tags/%s", username, url.PathEscape(tag))
+}
+
 func NewUserRegistrationPath() string {
 	return "/user_registration/new"
 }
@@ -56,6 +89,142 @@ func LoginPath() string {
 	return "/login/handle"
 }
 
+func LoginTwoFactorPath() string {
+	return "/login/two_factor"
+}
+
+func NewPasswordResetPath() string {
+	return "/password_reset/new"
+}
+
+func PasswordResetPath() string {
+	return "/password_reset"
+}
+
+func PasswordResetTokenPath(token string) string {
+	return fmt.Sprintf("/password_reset/%s", token)
+}
+
 func LogoutPath() string {
 	return "/logout"
 }
+
+func APITokensPath(username string) string {
+	return fmt.Sprintf("/users/%s/api_tokens", username)
+}
+
+func APITokenPath(username string, tokenID int64) string {
+	return fmt.Sprintf("/users/%s/api_tokens/%d", username, tokenID)
+}
+
+func APIBooksPath(username string) string {
+	return fmt.Sprintf("/api/v1/users/%s/books", username)
+}
+
+func BookImportPath(username string, importID int64) string {
+	return fmt.Sprintf("/users/%s/books/imports/%d", username, importID)
+}
+
+func BookImportCommitPath(username string, importID int64) string {
+	return fmt.Sprintf("/users/%s/books/imports/%d/commit", username, importID)
+}
+
+func BookImportMappingPath(username string, importID int64) string {
+	return fmt.Sprintf("/users/%s/books/imports/%d/mapping", username, importID)
+}
+
+func ImportProfilePath(username string, profileID int64) string {
+	return fmt.Sprintf("/users/%s/import_profiles/%d", username, profileID)
+}
+
+func AccountBackupPath(username string) string {
+	return fmt.Sprintf("/users/%s/backup", username)
+}
+
+func AccountExportJSONPath(username string) string {
+	return fmt.Sprintf("/users/%s/export.json", username)
+}
+
+func AccountRestorePath(username string) string {
+	return fmt.Sprintf("/users/%s/restore", username)
+}
+
+func UserStatsPath(username string) string {
+	return fmt.Sprintf("/users/%s/stats", username)
+}
+
+func YearReviewPath(username string, year int) string {
+	return fmt.Sprintf("/users/%s/years/%d", username, year)
+}
+
+func YearReviewSharePath(username string, year int) string {
+	return fmt.Sprintf("/users/%s/years/%d/share", username, year)
+}
+
+func SharedYearReviewPath(token string) string {
+	return fmt.Sprintf("/shared/years/%s", token)
+}
+
+func UserSettingsPath(username string) string {
+	return fmt.Sprintf("/users/%s/settings", username)
+}
+
+func UserPasswordPath(username string) string {
+	return fmt.Sprintf("/users/%s/settings/password", username)
+}
+
+func UserUsernamePath(username string) string {
+	return fmt.Sprintf("/users/%s/settings/username", username)
+}
+
+func UserEmailPath(username string) string {
+	return fmt.Sprintf("/users/%s/settings/email", username)
+}
+
+func UserTwoFactorPath(username string) string {
+	return fmt.Sprintf("/users/%s/two_factor", username)
+}
+
+func UserRecoveryCodesPath(username string) string {
+	return fmt.Sprintf("/users/%s/two_factor/recovery_codes", username)
+}
+
+func UserSessionsPath(username string) string {
+	return fmt.Sprintf("/users/%s/sessions", username)
+}
+
+func UserSessionPath(username string, publicID int64) string {
+	return fmt.Sprintf("/users/%s/sessions/%d", username, publicID)
+}
+
+func ReadingGoalsPath(username string) string {
+	return fmt.Sprintf("/users/%s/goals", username)
+}
+
+func ReadingGoalPath(username string, goalID int64) string {
+	return fmt.Sprintf("/users/%s/goals/%d", username, goalID)
+}
+
+func FollowPath(username string) string {
+	return fmt.Sprintf("/users/%s/follow", username)
+}
+
+func FeedPath() string {
+	return "/feed"
+}
+
+func BooksAtomPath(username string) string {
+	return fmt.Sprintf("/users/%s/books.atom", username)
+}
+
+func BooksRSSPath(username string) string {
+	return fmt.Sprintf("/users/%s/books.rss", username)
+}
+
+func BooksCalendarPath(username string) string {
+	return fmt.Sprintf("/users/%s/books.ics", username)
+}
+
+func CalendarTokenPath(username string) string {
+	return fmt.Sprintf("/users/%s/calendar_token", username)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+)
+
+// AccountBackup renders the page to download a backup of the account or restore one.
+func AccountBackup(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return renderAccountBackup(ctx, w, r, nil)
+}
+
+// AccountExportJSON downloads a backup of all data owned by the path user. The password digest is not included. Only
+// operators can make backups that include it with the export-user command.
+func AccountExportJSON(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	backup, err := data.ExportAccount(ctx, db, pathUser.ID, false)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=booklog-%s.json", pathUser.Username))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(backup)
+}
+
+// AccountRestore replaces all data owned by the path user with the uploaded backup.
+func AccountRestore(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	r.ParseMultipartForm(32 << 20)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return renderAccountBackup(ctx, w, r, []string{"Choose a backup file to restore"})
+	}
+	defer file.Close()
+
+	backup, err := data.ReadAccountBackup(file)
+	if err != nil {
+		return renderAccountBackup(ctx, w, r, []string{err.Error()})
+	}
+
+	err = data.RestoreAccount(ctx, db, pathUser.ID, backup, pathUserToday(ctx))
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderAccountBackup(ctx, w, r, view.ValidationErrorMessages(verr))
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.BooksPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+func renderAccountBackup(ctx context.Context, w http.ResponseWriter, r *http.Request, restoreErrors []string) error {
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "account_backup.html", map[string]any{
+		"bva":           baseViewArgsFromRequest(r),
+		"restoreErrors": restoreErrors,
+	})
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/bee"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/structify"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	apiDefaultPageSize = 100
+	apiMaxPageSize     = 500
+	apiMaxBodySize     = 1 << 20
+)
+
+// apiRequestError is returned by API handlers when the request cannot be understood. It is rendered as a JSON error
+// response with statusCode.
+type apiRequestError struct {
+	statusCode int
+	message    string
+}
+
+func (e *apiRequestError) Error() string {
+	return e.message
+}
+
+// newAPIHandlerBuilder returns a bee.HandlerBuilder for JSON API handlers. Errors returned by handlers are rendered as
+// JSON error responses. Request bodies are not parsed into params. Handlers decode them with decodeAPIJSONBody so
+// malformed bodies get JSON errors and query parameters cannot stand in for body fields.
+func newAPIHandlerBuilder() *bee.HandlerBuilder {
+	return &bee.HandlerBuilder{
+		SkipBodyParams: true,
+		ErrorHandlers: []bee.ErrorHandler{
+			func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
+				var reqErr *apiRequestError
+				if errors.As(err, &reqErr) {
+					writeAPIError(w, reqErr.statusCode, reqErr.message)
+					return true, nil
+				}
+				return false, nil
+			},
+			func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
+				var nfErr *data.NotFoundError
+				if errors.As(err, &nfErr) {
+					writeAPIError(w, http.StatusNotFound, "Not found")
+					return true, nil
+				}
+				return false, nil
+			},
+			func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
+				var verr *errortree.Node
+				if errors.As(err, &verr) {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+						"error":  "Validation failed",
+						"errors": view.ValidationErrorsJSON(verr),
+					})
+					return true, nil
+				}
+				return false, nil
+			},
+			func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
+				hlog.FromRequest(r).Error().Err(err).Msg("internal server error")
+				writeAPIError(w, http.StatusInternalServerError, "Internal server error")
+				return true, nil
+			},
+		},
+	}
+}
+
+// decodeAPIJSONBody decodes the JSON object in the body of r into v. The Content-Type must be application/json with
+// optional parameters such as charset.
+func decodeAPIJSONBody(r *http.Request, v any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &apiRequestError{statusCode: http.StatusUnsupportedMediaType, message: "Content-Type must be application/json"}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, apiMaxBodySize))
+	err = decoder.Decode(v)
+	if err != nil {
+		return &apiRequestError{statusCode: http.StatusBadRequest, message: "Invalid JSON: " + err.Error()}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return &apiRequestError{statusCode: http.StatusBadRequest, message: "Invalid JSON: unexpected data after object"}
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]any{"error": message})
+}
+
+// apiTokenHandler puts a *Session in the request context authenticated by the bearer token in the Authorization header.
+// Cookie sessions are deliberately not accepted because API routes are not protected from CSRF. Like sessionHandler it
+// queries dbpool directly because the per-request connection cannot be acquired until the user is known.
+func apiTokenHandler(dbpool *pgxpool.Pool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			session := &Session{}
+			ctx = context.WithValue(ctx, RequestSessionKey, session)
+
+			scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			user, err := data.AuthenticateAPIToken(ctx, dbpool, strings.TrimSpace(token))
+			if err != nil {
+				var nfErr *data.NotFoundError
+				if errors.As(err, &nfErr) {
+					next.ServeHTTP(w, r.WithContext(ctx))
+				} else {
+					hlog.FromRequest(r).Error().Err(err).Msg("internal server error")
+					writeAPIError(w, http.StatusInternalServerError, "Internal server error")
+				}
+				return
+			}
+			session.User = *user
+			session.IsAuthenticated = true
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// requireAPIPathUserHandler ensures the request is authenticated as the user in the path and puts that user in the
+// request context as the path user.
+func requireAPIPathUserHandler() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			session := ctx.Value(RequestSessionKey).(*Session)
+
+			if !session.IsAuthenticated {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="booklog"`)
+				writeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if session.User.Username != chi.URLParam(r, "username") {
+				writeAPIError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			ctx = context.WithValue(ctx, RequestPathUserKey, &session.User)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func APIBookIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	var indexParams view.BookIndexParams
+	_ = structify.Parse(params, &indexParams)
+	filter, sort, verr := indexParams.Parse()
+	if verr == nil {
+		verr = &errortree.Node{}
+	}
+
+	if status, ok := params["status"].(string); ok && status != "" {
+		if !slices.Contains(data.BookStatuses, status) {
+			verr.Add([]any{"status"}, errors.New("is not a valid status"))
+		}
+		filter.Status = status
+	}
+
+	limit := apiDefaultPageSize
+	if s, ok := params["limit"].(string); ok && s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > apiMaxPageSize {
+			verr.Add([]any{"limit"}, errors.New("must be from 1 to "+strconv.Itoa(apiMaxPageSize)))
+		}
+		limit = n
+	}
+
+	if len(verr.AllErrors()) > 0 {
+		return verr
+	}
+
+	page, err := data.GetBooksPage(ctx, db, pathUser.ID, filter, sort, indexParams.After, limit)
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidBookCursor) {
+			return writeJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid cursor"})
+		}
+		return err
+	}
+
+	books := make([]*view.BookJSON, len(page.Books))
+	for i, book := range page.Books {
+		books[i] = view.NewBookJSON(book)
+	}
+
+	var nextCursor *string
+	if page.NextCursor != "" {
+		nextCursor = &page.NextCursor
+	}
+
+	return writeJSON(w, http.StatusOK, map[string]any{
+		"books":      books,
+		"nextCursor": nextCursor,
+	})
+}
+
+func APIBookShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	bookID := int64URLParam(r, "id")
+
+	book, err := data.GetBook(ctx, db, pathUser.ID, bookID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, view.NewBookJSON(book))
+}
+
+func APIBookCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	var input view.BookJSONInput
+	err := decodeAPIJSONBody(r, &input)
+	if err != nil {
+		return err
+	}
+
+	book := data.Book{UserID: pathUser.ID}
+	if verr := input.Apply(&book); verr != nil {
+		return verr
+	}
+
+	created, err := data.CreateBook(ctx, db, book, pathUserToday(ctx))
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusCreated, view.NewBookJSON(created))
+}
+
+func APIBookUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	bookID := int64URLParam(r, "id")
+
+	var input view.BookJSONInput
+	err := decodeAPIJSONBody(r, &input)
+	if err != nil {
+		return err
+	}
+
+	book, err := data.GetBook(ctx, db, pathUser.ID, bookID)
+	if err != nil {
+		return err
+	}
+
+	if verr := input.Apply(book); verr != nil {
+		return verr
+	}
+
+	err = data.UpdateBook(ctx, db, *book, pathUserToday(ctx))
+	if err != nil {
+		return err
+	}
+
+	book, err = data.GetBook(ctx, db, pathUser.ID, bookID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, view.NewBookJSON(book))
+}
+
+func APIBookDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	bookID := int64URLParam(r, "id")
+
+	err := data.DeleteBook(ctx, db, pathUser.ID, bookID)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireAPIPathUserHandler(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	r.With(requireAPIPathUserHandler()).Get("/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Context().Value(RequestPathUserKey).(*data.UserMin).Username))
+	})
+
+	for _, tt := range []struct {
+		name     string
+		session  *Session
+		path     string
+		expected int
+	}{
+		{"unauthenticated", &Session{}, "/users/test", http.StatusUnauthorized},
+		{"other user", &Session{User: data.UserMin{ID: 2, Username: "other"}, IsAuthenticated: true}, "/users/test", http.StatusForbidden},
+		{"same user", &Session{User: data.UserMin{ID: 1, Username: "test"}, IsAuthenticated: true}, "/users/test", http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), RequestSessionKey, tt.session))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusOK {
+				require.Equal(t, "test", w.Body.String())
+			} else {
+				require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestAPIBookHandlers(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	user := &data.UserMin{Username: "test"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", user.Username).Scan(&user.ID)
+	require.NoError(t, err)
+
+	apiHB := newAPIHandlerBuilder()
+	type apiHandler func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error
+	serve := func(handler apiHandler, method string, bookID int64, params map[string]any, contentType string, requestBody string) (int, map[string]any) {
+		r := newBookRequest(ctx, tx, user, method, bookID)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+			r.Body = io.NopCloser(strings.NewReader(requestBody))
+		}
+		w := httptest.NewRecorder()
+		apiHB.New(func(ctx context.Context, w http.ResponseWriter, r *http.Request, _ map[string]any) error {
+			return handler(ctx, w, r, params)
+		}).ServeHTTP(w, r)
+
+		var body map[string]any
+		if w.Code != http.StatusNoContent {
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		}
+		return w.Code, body
+	}
+	call := func(handler apiHandler, method string, bookID int64, params map[string]any) (int, map[string]any) {
+		return serve(handler, method, bookID, params, "", "")
+	}
+	callJSON := func(handler apiHandler, method string, bookID int64, fields map[string]any) (int, map[string]any) {
+		buf, err := json.Marshal(fields)
+		require.NoError(t, err)
+		return serve(handler, method, bookID, map[string]any{}, "application/json; charset=utf-8", string(buf))
+	}
+
+	code, body := callJSON(APIBookCreate, http.MethodPost, 0, map[string]any{"author": "John Milton", "format": "text"})
+	require.Equal(t, http.StatusUnprocessableEntity, code)
+	require.Contains(t, body["errors"], "title")
+	require.Contains(t, body["errors"], "finishDate")
+
+	// Query parameters are not book fields.
+	code, body = serve(APIBookCreate, http.MethodPost, 0, map[string]any{"title": "Paradise Lost"}, "application/json", `{"author": "John Milton", "format": "text"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, code)
+	require.Contains(t, body["errors"], "title")
+
+	code, body = serve(APIBookCreate, http.MethodPost, 0, map[string]any{}, "application/json", `{"title": `)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, body["error"], "Invalid JSON")
+
+	code, body = serve(APIBookCreate, http.MethodPost, 0, map[string]any{}, "application/json", `{"rating": "high"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, body["error"], "Invalid JSON")
+
+	code, body = serve(APIBookCreate, http.MethodPost, 0, map[string]any{}, "application/x-www-form-urlencoded", "title=Paradise+Lost")
+	require.Equal(t, http.StatusUnsupportedMediaType, code)
+	require.Equal(t, "Content-Type must be application/json", body["error"])
+
+	code, body = callJSON(APIBookCreate, http.MethodPost, 0, map[string]any{
+		"title":      "Paradise Lost",
+		"author":     "John Milton",
+		"finishDate": "2019-01-01",
+		"format":     "text",
+		"tags":       []any{"poetry"},
+	})
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "Paradise Lost", body["title"])
+	require.Equal(t, []any{"poetry"}, body["tags"])
+	bookID, err := json.Number(body["id"].(string)).Int64()
+	require.NoError(t, err)
+
+	code, body = callJSON(APIBookUpdate, http.MethodPatch, bookID, map[string]any{"title": "Paradise Regained"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "Paradise Regained", body["title"])
+	require.Equal(t, "2019-01-01", body["finishDate"])
+
+	code, body = call(APIBookShow, http.MethodGet, bookID, map[string]any{})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "Paradise Regained", body["title"])
+
+	code, body = call(APIBookIndex, http.MethodGet, 0, map[string]any{"status": "finished"})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["books"], 1)
+	require.Nil(t, body["nextCursor"])
+
+	code, body = call(APIBookIndex, http.MethodGet, 0, map[string]any{"status": "bogus", "limit": "0"})
+	require.Equal(t, http.StatusUnprocessableEntity, code)
+	require.Contains(t, body["errors"], "status")
+	require.Contains(t, body["errors"], "limit")
+
+	code, _ = call(APIBookDelete, http.MethodDelete, bookID, map[string]any{})
+	require.Equal(t, http.StatusNoContent, code)
+
+	code, _ = call(APIBookShow, http.MethodGet, bookID, map[string]any{})
+	require.Equal(t, http.StatusNotFound, code)
+}
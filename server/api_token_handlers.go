@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+)
+
+func APITokenIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return renderAPITokenIndex(ctx, w, r, map[string]any{})
+}
+
+func APITokenCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	name, _ := params["name"].(string)
+	token, secret, err := data.CreateAPIToken(ctx, db, pathUser.ID, name)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderAPITokenIndex(ctx, w, r, map[string]any{"name": name, "verr": verr})
+		}
+		return err
+	}
+
+	// The secret is only available now. Render it directly instead of redirecting so it is never stored anywhere.
+	return renderAPITokenIndex(ctx, w, r, map[string]any{"newToken": token, "secret": secret})
+}
+
+func APITokenDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	tokenID := int64URLParam(r, "id")
+
+	err := data.DeleteAPIToken(ctx, db, pathUser.ID, tokenID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, route.APITokensPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+func renderAPITokenIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, args map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	tokens, err := data.GetAPITokens(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	args["bva"] = baseViewArgsFromRequest(r)
+	args["tokens"] = tokens
+	args["booksAPIPath"] = route.APIBooksPath(pathUser.Username)
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "api_token_index.html", args)
+}
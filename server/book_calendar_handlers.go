@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+)
+
+// BookCalendar renders an iCalendar feed with an all-day event on the finish date of each book finished by the path
+// user. Private books are excluded as in getBookFeedBooks.
+func BookCalendar(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	token, _ := params["token"].(string)
+	books, err := data.GetCalendarBooks(ctx, db, pathUser.ID, token)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	return view.WriteBookCalendar(w, pathUser, books, requestBaseURL(r))
+}
+
+// requireCalendarReadAccessHandler allows anyone with the calendar token of the path user in the token query parameter
+// to read the calendar. Calendar applications cannot log in so this is the only way to subscribe to the calendar of a
+// user whose books are private. Without a token the requirePathUserReadAccessHandler rules apply.
+func requireCalendarReadAccessHandler() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		readAccessHandler := requirePathUserReadAccessHandler()(next)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				readAccessHandler.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			db := ctx.Value(RequestDBKey).(dbconn)
+			pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+			ok, err := data.IsCalendarToken(ctx, db, pathUser.ID, token)
+			if err != nil {
+				InternalServerErrorHandler(w, r, err)
+				return
+			}
+			if !ok {
+				NotFoundHandler(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func CalendarTokenReset(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	_, err := data.ResetCalendarToken(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+func CalendarTokenDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	err := data.DeleteCalendarToken(ctx, db, pathUser.ID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,436 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+)
+
+// csvImporter converts the records of a CSV file exported by some application into books.
+type csvImporter interface {
+	// parseRecord converts record into a book form. It returns false if the record should be skipped.
+	parseRecord(record []string) (view.BookEditForm, bool)
+}
+
+// detectCSVImporter selects the csvImporter for a CSV file exported by a known application based on its header row. It
+// returns nil if the format is not recognized.
+func detectCSVImporter(header []string) csvImporter {
+	columns := newCSVColumns(header)
+
+	switch {
+	case columns.has("Book Id", "Title", "Author", "Exclusive Shelf"):
+		return goodreadsCSVImporter{columns: columns}
+	case columns.has("Title", "Authors", "Read Status", "Star Rating"):
+		return storyGraphCSVImporter{columns: columns}
+	case columns.has(booklogCSVHeader[:booklogCSVRequiredColumnCount]...):
+		return booklogCSVImporter{columns: columns}
+	default:
+		return nil
+	}
+}
+
+// newCSVImporter returns the csvImporter for a CSV file with header. If mapping is nil the importer is detected from
+// header. If the format is not recognized the mapping is guessed from header.
+func newCSVImporter(header []string, mapping *data.ImportMapping) csvImporter {
+	if mapping != nil {
+		return newMappedCSVImporter(header, *mapping)
+	}
+
+	if importer := detectCSVImporter(header); importer != nil {
+		return importer
+	}
+
+	return newMappedCSVImporter(header, guessImportMapping(header))
+}
+
+// csvRecordErrorer is implemented by csvImporters that can find errors in a record that BookEditForm.Parse cannot.
+type csvRecordErrorer interface {
+	// recordErrors returns the error messages for record. The fields with errors are left empty by parseRecord.
+	recordErrors(record []string) []string
+}
+
+// csvTimestampImporter is implemented by csvImporters for files that include the insert and update times of books.
+type csvTimestampImporter interface {
+	// parseTimestamps returns the insert and update time of record. A zero time means the current time should be used.
+	parseTimestamps(record []string) (insertTime, updateTime time.Time, err error)
+}
+
+// csvColumns maps the names in a CSV header row to column indexes.
+type csvColumns map[string]int
+
+func newCSVColumns(header []string) csvColumns {
+	columns := make(csvColumns, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\uFEFF") // Byte order mark
+		}
+		columns[strings.TrimSpace(name)] = i
+	}
+	return columns
+}
+
+func (c csvColumns) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := c[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the trimmed value of the column name in record. It returns an empty string if the column does not exist.
+func (c csvColumns) get(record []string, name string) string {
+	i, ok := c[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// mappedCSVImporter imports a CSV file with columns mapped to book fields by the user.
+type mappedCSVImporter struct {
+	fields  []string // Book field of each column. Empty if the column is ignored.
+	mapping data.ImportMapping
+}
+
+func newMappedCSVImporter(header []string, mapping data.ImportMapping) mappedCSVImporter {
+	fields := make([]string, len(header))
+	for i, name := range header {
+		fields[i] = mapping.Columns[name]
+	}
+	return mappedCSVImporter{fields: fields, mapping: mapping}
+}
+
+func (imp mappedCSVImporter) parseRecord(record []string) (view.BookEditForm, bool) {
+	var form view.BookEditForm
+	for i, value := range record {
+		if i >= len(imp.fields) {
+			break
+		}
+
+		switch imp.fields[i] {
+		case "title":
+			form.Title = value
+		case "author":
+			form.Author = value
+		case "status":
+			form.Status = value
+		case "startDate":
+			form.StartDate = imp.convertDate(value)
+		case "finishDate":
+			form.FinishDate = imp.convertDate(value)
+		case "format":
+			form.Format = value
+		case "location":
+			form.Location = value
+		case "rating":
+			form.Rating = value
+		case "review":
+			form.Review = value
+		case "tags":
+			form.Tags = value
+		case "isbn":
+			form.ISBN = value
+		case "pageCount":
+			form.PageCount = value
+		}
+	}
+
+	if strings.TrimSpace(form.Format) == "" {
+		form.Format = imp.mapping.DefaultFormat
+	}
+
+	return form, true
+}
+
+// convertDate converts s in the date layout of the mapping to the format understood by BookEditForm. If s cannot be
+// parsed an empty string is returned so BookEditForm cannot misread it in another layout. recordErrors reports it.
+func (imp mappedCSVImporter) convertDate(s string) string {
+	if imp.mapping.DateLayout == "" {
+		return s
+	}
+	t, err := imp.parseDate(s)
+	if err != nil {
+		return ""
+	}
+	return view.FormatDate(t)
+}
+
+func (imp mappedCSVImporter) parseDate(s string) (time.Time, error) {
+	return time.Parse(imp.mapping.DateLayout, strings.TrimSpace(s))
+}
+
+func (imp mappedCSVImporter) recordErrors(record []string) []string {
+	if imp.mapping.DateLayout == "" {
+		return nil
+	}
+
+	var errs []string
+	for i, value := range record {
+		if i >= len(imp.fields) {
+			break
+		}
+
+		field := imp.fields[i]
+		if (field == "startDate" || field == "finishDate") && strings.TrimSpace(value) != "" {
+			if _, err := imp.parseDate(value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not a date like %s", field, value, view.ImportDateLayoutLabel(imp.mapping.DateLayout)))
+			}
+		}
+	}
+	return errs
+}
+
+// booklogCSVHeader is the header of the booklog CSV export. Columns must only be added to the end so files exported by
+// older versions can still be imported.
+var booklogCSVHeader = []string{"title", "author", "finish_date", "format", "location", "rating", "review", "status", "start_date", "tags", "isbn", "page_count", "insert_time", "update_time", "private"}
+
+// booklogCSVRequiredColumnCount is the number of leading booklogCSVHeader columns used to detect the booklog CSV export.
+// Later columns are optional.
+const booklogCSVRequiredColumnCount = 14
+
+// booklogCSVImporter imports the booklog CSV export.
+type booklogCSVImporter struct {
+	columns csvColumns
+}
+
+func (imp booklogCSVImporter) parseRecord(record []string) (view.BookEditForm, bool) {
+	get := func(name string) string { return imp.columns.get(record, name) }
+
+	form := view.BookEditForm{
+		Title:      get("title"),
+		Author:     get("author"),
+		Status:     get("status"),
+		StartDate:  get("start_date"),
+		FinishDate: get("finish_date"),
+		Format:     get("format"),
+		Location:   get("location"),
+		Rating:     get("rating"),
+		Review:     get("review"),
+		Tags:       get("tags"),
+		ISBN:       get("isbn"),
+		PageCount:  get("page_count"),
+	}
+	if private, _ := strconv.ParseBool(get("private")); private {
+		form.Private = "true"
+	}
+
+	return form, true
+}
+
+func (imp booklogCSVImporter) parseTimestamps(record []string) (time.Time, time.Time, error) {
+	var times [2]time.Time
+	for i, name := range []string{"insert_time", "update_time"} {
+		if s := imp.columns.get(record, name); s != "" {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("%s is not a valid time", name)
+			}
+			times[i] = t
+		}
+	}
+
+	return times[0], times[1], nil
+}
+
+// booklogCSVColumns are the book fields of the columns of the booklog CSV export in order.
+var booklogCSVColumns = []string{"title", "author", "finishDate", "format", "location", "rating", "review", "status", "startDate", "tags", "isbn", "pageCount"}
+
+// importFieldAliases maps normalized CSV header names to the book fields they are likely to contain.
+var importFieldAliases = map[string]string{
+	"title":         "title",
+	"booktitle":     "title",
+	"author":        "author",
+	"authors":       "author",
+	"status":        "status",
+	"readstatus":    "status",
+	"startdate":     "startDate",
+	"datestarted":   "startDate",
+	"started":       "startDate",
+	"finishdate":    "finishDate",
+	"datefinished":  "finishDate",
+	"finished":      "finishDate",
+	"dateread":      "finishDate",
+	"format":        "format",
+	"media":         "format",
+	"location":      "location",
+	"rating":        "rating",
+	"myrating":      "rating",
+	"starrating":    "rating",
+	"review":        "review",
+	"myreview":      "review",
+	"tags":          "tags",
+	"isbn":          "isbn",
+	"isbn13":        "isbn",
+	"pagecount":     "pageCount",
+	"pages":         "pageCount",
+	"numberofpages": "pageCount",
+}
+
+// guessImportMapping guesses the mapping of a CSV file from the names in header. If the title and author columns cannot
+// be found by name the columns are assumed to be in the order of the booklog CSV export.
+func guessImportMapping(header []string) data.ImportMapping {
+	mapping := data.ImportMapping{Columns: make(map[string]string), DefaultFormat: "text"}
+
+	mapped := make(map[string]bool)
+	for _, name := range header {
+		normalized := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, name)
+
+		if field, ok := importFieldAliases[normalized]; ok && !mapped[field] {
+			mapping.Columns[name] = field
+			mapped[field] = true
+		}
+	}
+
+	if !mapped["title"] || !mapped["author"] {
+		clear(mapping.Columns)
+		for i, name := range header {
+			if i < len(booklogCSVColumns) {
+				mapping.Columns[name] = booklogCSVColumns[i]
+			}
+		}
+	}
+
+	return mapping
+}
+
+// goodreadsCSVImporter imports the Goodreads library export. Only books on the read shelf are imported.
+type goodreadsCSVImporter struct {
+	columns csvColumns
+}
+
+// goodreadsExclusiveShelves are the built-in Goodreads shelves. They are not imported as tags.
+var goodreadsExclusiveShelves = []string{"read", "currently-reading", "to-read"}
+
+var goodreadsReviewReplacer = strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n")
+
+func (imp goodreadsCSVImporter) parseRecord(record []string) (view.BookEditForm, bool) {
+	get := func(name string) string { return imp.columns.get(record, name) }
+
+	exclusiveShelf := get("Exclusive Shelf")
+	if exclusiveShelf != "read" {
+		return view.BookEditForm{}, false
+	}
+
+	form := view.BookEditForm{
+		Title:      get("Title"),
+		Author:     get("Author"),
+		Status:     data.BookStatusFinished,
+		FinishDate: convertCSVDate(get("Date Read"), "2006/01/02"),
+		Format:     formatFromBinding(get("Binding")),
+		Review:     goodreadsReviewReplacer.Replace(get("My Review")),
+		ISBN:       goodreadsISBN(get("ISBN13")),
+		PageCount:  get("Number of Pages"),
+	}
+
+	// Goodreads does not require a read date. The finish date is left empty rather than guessed so the row is reported
+	// as invalid in the import preview.
+	if form.ISBN == "" {
+		form.ISBN = goodreadsISBN(get("ISBN"))
+	}
+
+	if rating := get("My Rating"); rating != "0" {
+		form.Rating = rating
+	}
+
+	var tags []string
+	for _, shelf := range strings.Split(get("Bookshelves"), ",") {
+		shelf = strings.TrimSpace(shelf)
+		if shelf != "" && shelf != exclusiveShelf && !slices.Contains(goodreadsExclusiveShelves, shelf) {
+			tags = append(tags, shelf)
+		}
+	}
+	form.Tags = strings.Join(tags, ", ")
+
+	return form, true
+}
+
+// goodreadsISBN extracts an ISBN from the Goodreads export. Goodreads wraps ISBNs in a formula like ="0345391802" to
+// prevent spreadsheets from treating them as numbers.
+func goodreadsISBN(s string) string {
+	return strings.Trim(s, `="`)
+}
+
+// storyGraphCSVImporter imports the StoryGraph export. Only books with the read status are imported.
+type storyGraphCSVImporter struct {
+	columns csvColumns
+}
+
+func (imp storyGraphCSVImporter) parseRecord(record []string) (view.BookEditForm, bool) {
+	get := func(name string) string { return imp.columns.get(record, name) }
+
+	if get("Read Status") != "read" {
+		return view.BookEditForm{}, false
+	}
+
+	form := view.BookEditForm{
+		Title:      get("Title"),
+		Author:     get("Authors"),
+		Status:     data.BookStatusFinished,
+		FinishDate: convertCSVDate(get("Last Date Read"), "2006/01/02"),
+		Format:     formatFromBinding(get("Format")),
+		Review:     get("Review"),
+		Tags:       get("Tags"),
+	}
+
+	// Dates Read is a comma separated list of start-finish date ranges. The last range is the most recent read.
+	if datesRead := get("Dates Read"); datesRead != "" {
+		ranges := strings.Split(datesRead, ",")
+		start, finish, found := strings.Cut(strings.TrimSpace(ranges[len(ranges)-1]), "-")
+		if found {
+			form.StartDate = convertCSVDate(start, "2006/01/02")
+			if form.FinishDate == "" {
+				form.FinishDate = convertCSVDate(finish, "2006/01/02")
+			}
+		} else if form.FinishDate == "" {
+			form.FinishDate = convertCSVDate(start, "2006/01/02")
+		}
+	}
+
+	if isbn := get("ISBN/UID"); data.IsISBN(isbn) {
+		form.ISBN = isbn
+	}
+
+	// StoryGraph allows quarter star ratings. Round them to the nearest half star.
+	if rating := get("Star Rating"); rating != "" {
+		if n, err := strconv.ParseFloat(rating, 64); err == nil {
+			form.Rating = view.FormatRating(math.Round(n*2) / 2)
+		} else {
+			form.Rating = rating
+		}
+	}
+
+	return form, true
+}
+
+// formatFromBinding returns the booklog format for a binding or format description such as "Audible Audio",
+// "Kindle Edition", or "hardcover".
+func formatFromBinding(binding string) string {
+	binding = strings.ToLower(binding)
+	if strings.Contains(binding, "audio") || strings.Contains(binding, "mp3") {
+		return "audio"
+	}
+	return "text"
+}
+
+// convertCSVDate converts the date s in layout to the YYYY-MM-DD format understood by BookEditForm. If s cannot be
+// parsed it is returned unchanged so the error is reported when the form is parsed.
+func convertCSVDate(s, layout string) string {
+	t, err := time.Parse(layout, strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+	return view.FormatDate(t)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func parseCSVWithDetectedImporter(t *testing.T, src string) []view.BookEditForm {
+	records, err := csv.NewReader(strings.NewReader(src)).ReadAll()
+	require.NoError(t, err)
+
+	importer := newCSVImporter(records[0], nil)
+
+	var forms []view.BookEditForm
+	for _, record := range records[1:] {
+		if form, ok := importer.parseRecord(record); ok {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
+
+func TestGoodreadsCSVImporter(t *testing.T) {
+	src := "\uFEFF" + `Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies
+1,Paradise Lost,John Milton,"Milton, John",,"=""0140424393""","=""9780140424393""",5,3.81,Penguin,Paperback,453,2003,1667,2019/03/15,2019/01/02,"poetry, favorites","poetry (#1), favorites (#2)",read,Epic.<br/>Really.,,,1,0
+2,Dracula,Bram Stoker,"Stoker, Bram",,"=""""","=""""",0,4.01,Audible,Audible Audio,,2010,1897,,2020/10/31,,,read,,,,1,0
+3,Emma,Jane Austen,"Austen, Jane",,,,0,4.01,Penguin,Kindle Edition,474,2003,1815,,2021/01/01,to-read,to-read (#1),to-read,,,,0,0
+4,Ulysses,James Joyce,"Joyce, James",,,,0,3.74,Vintage,Paperback,783,1990,1922,,2021/01/01,currently-reading,currently-reading (#1),currently-reading,,,,0,0
+`
+	forms := parseCSVWithDetectedImporter(t, src)
+	require.Equal(t, []view.BookEditForm{
+		{
+			Title:      "Paradise Lost",
+			Author:     "John Milton",
+			Status:     "finished",
+			FinishDate: "2019-03-15",
+			Format:     "text",
+			Rating:     "5",
+			Review:     "Epic.\nReally.",
+			Tags:       "poetry, favorites",
+			ISBN:       "9780140424393",
+			PageCount:  "453",
+		},
+		{
+			Title:  "Dracula",
+			Author: "Bram Stoker",
+			Status: "finished",
+			Format: "audio",
+		},
+	}, forms)
+
+	today := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	book, verr := forms[0].Parse()
+	require.Nil(t, verr)
+	require.Nil(t, book.Validate(today))
+
+	// The date added is not a substitute for a missing read date. The row is reported as invalid in the preview.
+	book, verr = forms[1].Parse()
+	require.Nil(t, verr)
+	verr = book.Validate(today)
+	require.NotNil(t, verr)
+	require.Len(t, verr.Get("finishDate"), 1)
+}
+
+func TestStoryGraphCSVImporter(t *testing.T) {
+	src := `Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?
+Piranesi,Susanna Clarke,,9781635575637,hardcover,read,2021/01/01,2021/02/10,"2020/05/01-2020/05/09, 2021/02/01-2021/02/10",2,mysterious,medium,Plot,No,Yes,No,Yes,4.75,Lovely.,,,"fantasy, favorites",Yes
+Dune,Frank Herbert,,abc123,audio,read,2022/01/01,,2022/03/01-2022/03/20,1,,,,,,,,3.25,,,,,No
+Emma,Jane Austen,,,digital,to-read,2022/01/01,,,0,,,,,,,,,,,,,No
+Middlemarch,George Eliot,,,paperback,did-not-finish,2022/01/01,,,0,,,,,,,,,,,,,No
+`
+	forms := parseCSVWithDetectedImporter(t, src)
+	require.Equal(t, []view.BookEditForm{
+		{
+			Title:      "Piranesi",
+			Author:     "Susanna Clarke",
+			Status:     "finished",
+			StartDate:  "2021-02-01",
+			FinishDate: "2021-02-10",
+			Format:     "text",
+			Rating:     "5",
+			Review:     "Lovely.",
+			Tags:       "fantasy, favorites",
+			ISBN:       "9781635575637",
+		},
+		{
+			Title:      "Dune",
+			Author:     "Frank Herbert",
+			Status:     "finished",
+			StartDate:  "2022-03-01",
+			FinishDate: "2022-03-20",
+			Format:     "audio",
+			Rating:     "3.5",
+		},
+	}, forms)
+
+	for _, form := range forms {
+		_, verr := form.Parse()
+		require.Nil(t, verr)
+	}
+}
+
+func TestBooklogCSVImporter(t *testing.T) {
+	src := `title,author,finish_date,format,location,rating,review,status,start_date,tags,isbn,page_count,insert_time,update_time
+Napoleon,Adam Zamoyski,2019-06-17,audio,"Home, office",4.5,"Long,
+review",finished,2019-06-01,"biography, history",9780465055937,768,2019-06-01T12:30:15.123456Z,2019-06-18T08:00:00Z
+Emma,Jane Austen,,text,,,,want_to_read,,,,,,
+Ulysses,James Joyce,,text,,,,want_to_read,,,,,yesterday,
+`
+	records, err := csv.NewReader(strings.NewReader(src)).ReadAll()
+	require.NoError(t, err)
+
+	importer := newCSVImporter(records[0], nil)
+	require.IsType(t, booklogCSVImporter{}, importer)
+
+	form, ok := importer.parseRecord(records[1])
+	require.True(t, ok)
+	require.Equal(t, view.BookEditForm{
+		Title:      "Napoleon",
+		Author:     "Adam Zamoyski",
+		Status:     "finished",
+		StartDate:  "2019-06-01",
+		FinishDate: "2019-06-17",
+		Format:     "audio",
+		Location:   "Home, office",
+		Rating:     "4.5",
+		Review:     "Long,\nreview",
+		Tags:       "biography, history",
+		ISBN:       "9780465055937",
+		PageCount:  "768",
+	}, form)
+
+	tsImporter := importer.(csvTimestampImporter)
+	insertTime, updateTime, err := tsImporter.parseTimestamps(records[1])
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2019, 6, 1, 12, 30, 15, 123456000, time.UTC), insertTime)
+	require.Equal(t, time.Date(2019, 6, 18, 8, 0, 0, 0, time.UTC), updateTime)
+
+	insertTime, updateTime, err = tsImporter.parseTimestamps(records[2])
+	require.NoError(t, err)
+	require.True(t, insertTime.IsZero())
+	require.True(t, updateTime.IsZero())
+
+	_, _, err = tsImporter.parseTimestamps(records[3])
+	require.EqualError(t, err, "insert_time is not a valid time")
+}
+
+func TestBooklogCSVImporterPrivate(t *testing.T) {
+	forms := parseCSVWithDetectedImporter(t, `title,author,finish_date,format,location,rating,review,status,start_date,tags,isbn,page_count,insert_time,update_time,private
+Emma,Jane Austen,,text,,,,want_to_read,,,,,,,true
+Ulysses,James Joyce,,text,,,,want_to_read,,,,,,,false
+`)
+	require.Len(t, forms, 2)
+	require.Equal(t, "true", forms[0].Private)
+	require.Equal(t, "", forms[1].Private)
+}
+
+func TestGuessImportMapping(t *testing.T) {
+	for _, tt := range []struct {
+		header   []string
+		expected map[string]string
+	}{
+		{
+			header:   []string{"title", "author", "finish_date", "format", "location", "rating", "review", "status", "start_date", "tags", "isbn", "page_count"},
+			expected: map[string]string{"title": "title", "author": "author", "finish_date": "finishDate", "format": "format", "location": "location", "rating": "rating", "review": "review", "status": "status", "start_date": "startDate", "tags": "tags", "isbn": "isbn", "page_count": "pageCount"},
+		},
+		{
+			header:   []string{"Notes", "Book Title", "Author", "Date Read", "Pages"},
+			expected: map[string]string{"Book Title": "title", "Author": "author", "Date Read": "finishDate", "Pages": "pageCount"},
+		},
+		{
+			header:   []string{"Name", "Writer", "When", "How", "Where"},
+			expected: map[string]string{"Name": "title", "Writer": "author", "When": "finishDate", "How": "format", "Where": "location"},
+		},
+	} {
+		mapping := guessImportMapping(tt.header)
+		require.Equal(t, tt.expected, mapping.Columns, tt.header)
+		require.Equal(t, "text", mapping.DefaultFormat)
+	}
+}
+
+func TestMappedCSVImporter(t *testing.T) {
+	header := []string{"Read On", "Writer", "Ignored", "Name", "Kind"}
+	importer := newCSVImporter(header, &data.ImportMapping{
+		Columns:       map[string]string{"Read On": "finishDate", "Writer": "author", "Name": "title", "Kind": "format"},
+		DateLayout:    "02.01.2006",
+		DefaultFormat: "audio",
+	})
+
+	form, ok := importer.parseRecord([]string{"15.03.2019", "John Milton", "x", "Paradise Lost", ""})
+	require.True(t, ok)
+	require.Equal(t, view.BookEditForm{Title: "Paradise Lost", Author: "John Milton", FinishDate: "2019-03-15", Format: "audio"}, form)
+
+	require.Empty(t, importer.(csvRecordErrorer).recordErrors([]string{"15.03.2019", "John Milton", "x", "Paradise Lost", ""}))
+
+	// A date in another layout is an error instead of being read with the day and month swapped.
+	record := []string{"4/3/2019", "John Milton", "x", "Paradise Lost", "text"}
+	form, ok = importer.parseRecord(record)
+	require.True(t, ok)
+	require.Equal(t, "", form.FinishDate)
+	require.Equal(t, "text", form.Format)
+	require.Equal(t, []string{`finishDate "4/3/2019" is not a date like 15.03.2019`}, importer.(csvRecordErrorer).recordErrors(record))
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+)
+
+const bookFeedSize = 50
+
+// BookFeedAtom renders an Atom feed of the books most recently finished by the path user.
+func BookFeedAtom(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	books, err := getBookFeedBooks(ctx, pathUser)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	return view.WriteXML(w, view.NewAtomFeed(pathUser, books, requestBaseURL(r)))
+}
+
+// BookFeedRSS renders an RSS 2.0 feed of the books most recently finished by the path user.
+func BookFeedRSS(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	books, err := getBookFeedBooks(ctx, pathUser)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	return view.WriteXML(w, view.NewRSSFeed(pathUser, books, requestBaseURL(r)))
+}
+
+// getBookFeedBooks returns the books for the feeds of pathUser. Private books are always excluded, even for the owner,
+// because feed readers commonly share or cache what they fetch.
+func getBookFeedBooks(ctx context.Context, pathUser *data.UserMin) ([]*data.Book, error) {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	filter := data.BookFilter{Status: data.BookStatusFinished, ExcludePrivate: true}
+	page, err := data.GetBooksPage(ctx, db, pathUser.ID, filter, data.BookSortFinishDate, "", bookFeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Books, nil
+}
+
+// requestBaseURL returns the scheme and host for building absolute URLs. The configured base URL is used if there is
+// one. Otherwise, it is derived from r.
+func requestBaseURL(r *http.Request) string {
+	if baseURL, ok := r.Context().Value(RequestBaseURLKey).(string); ok {
+		return baseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/bee"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookFeedAtom(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	owner := &data.UserMin{Username: "test", TimeZone: "UTC", Visibility: data.UserVisibilityPublic}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values($1, 'x', $2) returning id", owner.Username, owner.Visibility).Scan(&owner.ID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, status, finish_date, format) values($1, 'Paradise Lost', 'John Milton', 'finished', '2019-01-01', 'text') returning id",
+		owner.ID,
+	).Scan(&bookID)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx,
+		"insert into books(user_id, title, author, status, finish_date, format, private) values($1, 'Secret Diary', 'Anonymous', 'finished', '2019-02-01', 'text', true)",
+		owner.ID,
+	)
+	require.NoError(t, err)
+
+	// Act as the application role with no user authenticated like a feed reader.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.With(requirePathUserReadAccessHandler()).Method("GET", "/users/{username}/books.atom", (&bee.HandlerBuilder{}).New(BookFeedAtom))
+	serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		rctx := context.WithValue(ctx, RequestDBKey, tx)
+		rctx = context.WithValue(rctx, RequestSessionKey, &Session{})
+		rctx = context.WithValue(rctx, RequestPathUserKey, owner)
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/users/test/books.atom", nil).WithContext(rctx)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "Paradise Lost")
+	require.Contains(t, w.Body.String(), "http://example.com/users/test/books/")
+	require.NotContains(t, w.Body.String(), "Secret Diary")
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = serve(etag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+
+	// Private users have no public feed.
+	owner.Visibility = data.UserVisibilityPrivate
+	w = serve("")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.NotContains(t, w.Body.String(), "Paradise Lost")
+}
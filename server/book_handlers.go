@@ -1,64 +1,134 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/booklog/data"
 	"github.com/jackc/booklog/route"
 	"github.com/jackc/booklog/view"
 	"github.com/jackc/errortree"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/structify"
+	"github.com/rs/zerolog/hlog"
 )
 
-// TODO -- LazyConn? A wrapper around *pgxpool.Pool that only acquires a *pgx.Conn on demand, but then uses the same one
-// for all subsequent calls. Maybe it should not have a direct dependency on *pgxpool.Pool, but instead have functions to acquire and release.
-
-// On second thought, maybe using a database connection is so common that a lazy system isn't the right approach. Maybe
-// HandlerEnv should directly acquire and release the conn. If an endpoint doesn't need it a different handler type
-// could be used of this type could be configurable.
-
-// But then on third thought, maybe it is better to have a lazy system. Or at least the wrapper concept. The win with
-// the wrapper is customizable acquire and release logic such as setting the user for RLS and unsetting it before
-// returning it to the pool.
-
 func BookIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
 	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 
-	books, err := data.GetAllBooks(ctx, db, pathUser.ID)
+	bva := baseViewArgsFromRequest(r)
+
+	prefs, err := data.GetUserPreferences(ctx, db, pathUser.ID)
 	if err != nil {
 		return err
 	}
 
-	yearBooksLists := make([]*view.YearBookList, 0)
-	var ybl *view.YearBookList
+	var indexParams view.BookIndexParams
+	_ = structify.Parse(params, &indexParams)
+	if indexParams.Sort == "" {
+		indexParams.Sort = prefs.DefaultBookSort
+	}
+	filter, sort, verr := indexParams.Parse()
+	filter.Status = data.BookStatusFinished
+	filter.ExcludePrivate = bva.ReadOnly
+	if verr != nil {
+		return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_index.html", map[string]any{
+			"bva":    bva,
+			"status": data.BookStatusFinished,
+			"params": indexParams,
+			"verr":   verr,
+		})
+	}
 
-	for _, book := range books {
-		year := book.FinishDate.Year()
-		if ybl == nil || year != ybl.Year {
-			ybl = &view.YearBookList{Year: year}
-			yearBooksLists = append(yearBooksLists, ybl)
+	page, err := data.GetBooksPage(ctx, db, pathUser.ID, filter, sort, indexParams.After, int(prefs.BooksPerPage))
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidBookCursor) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return nil
 		}
+		return err
+	}
 
-		ybl.Books = append(ybl.Books, book)
+	// Grouping by year only makes sense when books are ordered by finish date.
+	var yearBooksLists []*view.YearBookList
+	if sort == data.BookSortFinishDate {
+		yearBooksLists = view.GroupBooksByYear(page.Books)
+	}
+
+	var nextPagePath string
+	if page.NextCursor != "" {
+		nextPagePath = route.BooksPath(pathUser.Username) + "?" + indexParams.Query(page.NextCursor)
 	}
 
 	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_index.html", map[string]any{
-		"bva":            baseViewArgsFromRequest(r),
+		"bva":            bva,
+		"status":         data.BookStatusFinished,
+		"params":         indexParams,
+		"sort":           sort,
+		"books":          page.Books,
 		"yearBooksLists": yearBooksLists,
+		"nextPagePath":   nextPagePath,
+	})
+}
+
+// BookShelfIndex lists the books with the status in the path. Finished books are listed by BookIndex.
+func BookShelfIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	status, _ := params["status"].(string)
+	if status == data.BookStatusFinished {
+		http.Redirect(w, r, route.BooksPath(pathUser.Username), http.StatusSeeOther)
+		return nil
+	}
+	if !slices.Contains(data.BookStatuses, status) {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
+	books, err := data.GetBooksByStatus(ctx, db, pathUser.ID, status)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_shelf.html", map[string]any{
+		"bva":    baseViewArgsFromRequest(r),
+		"status": status,
+		"books":  books,
+	})
+}
+
+func BookSearch(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	query, _ := params["q"].(string)
+
+	results, err := data.SearchBooks(ctx, db, pathUser.ID, query, 50)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_search.html", map[string]any{
+		"bva":     baseViewArgsFromRequest(r),
+		"query":   query,
+		"results": results,
 	})
 }
 
 func BookNew(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
-	var form view.BookEditForm
+	form := view.BookEditForm{Status: data.BookStatusFinished}
+	if status, ok := params["status"].(string); ok && slices.Contains(data.BookStatuses, status) {
+		form.Status = status
+	}
 	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_new.html", map[string]any{
 		"bva":  baseViewArgsFromRequest(r),
 		"form": form,
@@ -81,7 +151,7 @@ func BookCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 	}
 	attrs.UserID = pathUser.ID
 
-	book, err := data.CreateBook(ctx, db, attrs)
+	book, err := data.CreateBook(ctx, db, attrs, pathUserToday(ctx))
 	if err != nil {
 		var verr *errortree.Node
 		if errors.As(err, &verr) {
@@ -100,9 +170,10 @@ func BookCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 
 func BookConfirmDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 	bookID := int64URLParam(r, "id")
 
-	book, err := data.GetBook(ctx, db, bookID)
+	book, err := data.GetBook(ctx, db, pathUser.ID, bookID)
 	if err != nil {
 		var nfErr *data.NotFoundError
 		if errors.As(err, &nfErr) {
@@ -124,7 +195,7 @@ func BookDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 	bookID := int64URLParam(r, "id")
 
-	err := data.DeleteBook(ctx, db, bookID)
+	err := data.DeleteBook(ctx, db, pathUser.ID, bookID)
 	if err != nil {
 		var nfErr *data.NotFoundError
 		if errors.As(err, &nfErr) {
@@ -141,9 +212,12 @@ func BookDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 
 func BookShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 	bookID := int64URLParam(r, "id")
 
-	book, err := data.GetBook(ctx, db, bookID)
+	bva := baseViewArgsFromRequest(r)
+
+	book, err := data.GetBook(ctx, db, pathUser.ID, bookID)
 	if err != nil {
 		var nfErr *data.NotFoundError
 		if errors.As(err, &nfErr) {
@@ -154,8 +228,14 @@ func BookShow(ctx context.Context, w http.ResponseWriter, r *http.Request, param
 		}
 	}
 
+	// Visitors must not learn that a private book exists.
+	if bva.ReadOnly && book.Private {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
 	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_show.html", map[string]any{
-		"bva":  baseViewArgsFromRequest(r),
+		"bva":  bva,
 		"book": book,
 	})
 }
@@ -165,19 +245,17 @@ func BookEdit(ctx context.Context, w http.ResponseWriter, r *http.Request, param
 	bookID := int64URLParam(r, "id")
 	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 
-	var form view.BookEditForm
-	var FinishDate time.Time
-	err := db.QueryRow(ctx, "select title, author, finish_date, format, coalesce(location, '') from books where id=$1 and user_id=$2", bookID, pathUser.ID).
-		Scan(&form.Title, &form.Author, &FinishDate, &form.Format, &form.Location)
+	book, err := data.GetBook(ctx, db, pathUser.ID, bookID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
 			NotFoundHandler(w, r)
 			return nil
 		} else {
 			return err
 		}
 	}
-	form.FinishDate = FinishDate.Format("2006-01-02")
+	form := view.NewBookEditForm(book)
 
 	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_edit.html", map[string]any{
 		"bva":    baseViewArgsFromRequest(r),
@@ -203,8 +281,9 @@ func BookUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 		})
 	}
 	attrs.ID = bookID
+	attrs.UserID = pathUser.ID
 
-	err := data.UpdateBook(ctx, db, attrs)
+	err := data.UpdateBook(ctx, db, attrs, pathUserToday(ctx))
 	if err != nil {
 		var verr *errortree.Node
 		if errors.As(err, &verr) {
@@ -229,114 +308,117 @@ func BookUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 	return nil
 }
 
-func BookImportCSVForm(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
-	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_csv_form.html", map[string]any{
-		"bva": baseViewArgsFromRequest(r),
+func BookStartReading(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return transitionBook(ctx, w, r, func(db dbconn, userID, bookID int64, date time.Time) error {
+		return data.StartReadingBook(ctx, db, userID, bookID, date)
 	})
 }
 
-// TODO - do transactions right
+func BookFinish(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return transitionBook(ctx, w, r, func(db dbconn, userID, bookID int64, date time.Time) error {
+		return data.FinishBook(ctx, db, userID, bookID, date)
+	})
+}
+
+func BookAbandon(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return transitionBook(ctx, w, r, func(db dbconn, userID, bookID int64, date time.Time) error {
+		return data.AbandonBook(ctx, db, userID, bookID, date)
+	})
+}
 
-func BookImportCSV(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+// transitionBook changes the status of the book in the path with fn as of today in the time zone of the path user and
+// redirects to the book.
+func transitionBook(ctx context.Context, w http.ResponseWriter, r *http.Request, fn func(db dbconn, userID, bookID int64, date time.Time) error) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
 	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	bookID := int64URLParam(r, "id")
 
-	r.ParseMultipartForm(10 << 20)
-
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	err = importBooksFromCSV(ctx, db, pathUser.ID, file)
+	err := fn(db, pathUser.ID, bookID, pathUserToday(ctx))
 	if err != nil {
-		return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_csv_form.html", map[string]any{
-			"bva":       baseViewArgsFromRequest(r),
-			"importErr": err,
-		})
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else if errors.Is(err, data.ErrInvalidBookTransition) {
+			http.Error(w, "Conflict", http.StatusConflict)
+			return nil
+		} else {
+			return err
+		}
 	}
 
-	http.Redirect(w, r, route.BooksPath(pathUser.Username), http.StatusSeeOther)
+	http.Redirect(w, r, route.BookPath(pathUser.Username, bookID), http.StatusSeeOther)
 	return nil
 }
 
-func importBooksFromCSV(ctx context.Context, db dbconn, ownerID int64, r io.Reader) error {
-	records, err := csv.NewReader(r).ReadAll()
-	if err != nil {
-		return err
-	}
-
-	if len(records) < 2 {
-		return errors.New("CSV must have at least 2 rows")
-	}
+// BookExportCSV streams every book of the path user as a CSV file. It is a plain http.HandlerFunc instead of a bee handler
+// so the file is written directly to the client instead of being buffered in memory.
+func BookExportCSV(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
 
-	if len(records[0]) < 5 {
-		return errors.New("CSV must have at least 5 columns")
-	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=booklog-%s.csv", pathUser.Username))
 
-	tx, err := db.Begin(ctx)
+	tw := &trackingWriter{w: w}
+	err := writeBooksCSV(ctx, tw, db, pathUser.ID)
 	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	for i, record := range records[1:] {
-		form := view.BookEditForm{
-			Title:      record[0],
-			Author:     record[1],
-			FinishDate: record[2],
-			Format:     record[3],
-			Location:   record[4],
+		if !tw.written {
+			w.Header().Del("Content-Disposition")
+			InternalServerErrorHandler(w, r, err)
+			return
 		}
-		if form.Format == "" {
-			form.Format = "text"
-		}
-
-		attrs, verr := form.Parse()
-		if verr != nil {
-			return fmt.Errorf("row %d: %w", i+2, verr)
-		}
-		attrs.UserID = ownerID
 
-		_, err := data.CreateBook(ctx, tx, attrs)
-		if err != nil {
-			return fmt.Errorf("row %d: %w", i+2, err)
-		}
+		// Part of the file has already been sent. Aborting the response ensures the client cannot mistake a truncated
+		// file for a complete export.
+		hlog.FromRequest(r).Error().Err(err).Msg("book CSV export failed")
+		panic(http.ErrAbortHandler)
 	}
+}
 
-	return tx.Commit(ctx)
+// trackingWriter records whether anything has been written to w.
+type trackingWriter struct {
+	w       io.Writer
+	written bool
 }
 
-func BookExportCSV(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
-	db := ctx.Value(RequestDBKey).(dbconn)
-	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+func (tw *trackingWriter) Write(p []byte) (int, error) {
+	tw.written = true
+	return tw.w.Write(p)
+}
 
-	buf := &bytes.Buffer{}
-	csvWriter := csv.NewWriter(buf)
-	csvWriter.Write([]string{"title", "author", "finish_date", "format"})
-
-	rows, _ := db.Query(ctx, `select title, author, finish_date, format
-from books
-where user_id=$1
-order by finish_date desc`, pathUser.ID)
-	for rows.Next() {
-		var title, author, format string
-		var finishDate time.Time
-		rows.Scan(&title, &author, &finishDate, &format)
-		csvWriter.Write([]string{title, author, finishDate.Format("2006-01-02"), format})
-	}
-	if rows.Err() != nil {
-		return rows.Err()
+// writeBooksCSV writes every book owned by userID to w in CSV format with the booklogCSVHeader columns.
+func writeBooksCSV(ctx context.Context, w io.Writer, db dbconn, userID int64) error {
+	csvWriter := csv.NewWriter(w)
+	err := csvWriter.Write(booklogCSVHeader)
+	if err != nil {
+		return err
 	}
 
-	csvWriter.Flush()
-	if csvWriter.Error() != nil {
-		return csvWriter.Error()
+	err = data.ForEachBook(ctx, db, userID, func(book *data.Book) error {
+		return csvWriter.Write([]string{
+			book.Title,
+			book.Author,
+			view.FormatDate(book.FinishDate),
+			book.Format,
+			book.Location,
+			view.FormatRating(book.Rating),
+			book.Review,
+			book.Status,
+			view.FormatDate(book.StartDate),
+			strings.Join(book.Tags, ", "),
+			book.ISBN,
+			view.FormatPageCount(book.PageCount),
+			book.InsertTime.UTC().Format(time.RFC3339Nano),
+			book.UpdateTime.UTC().Format(time.RFC3339Nano),
+			strconv.FormatBool(book.Private),
+		})
+	})
+	if err != nil {
+		return err
 	}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=booklog-%s.csv", pathUser.Username))
-	_, err := buf.WriteTo(w)
-	return err
+	csvWriter.Flush()
+	return csvWriter.Error()
 }
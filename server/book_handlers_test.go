@@ -2,11 +2,15 @@ package server
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
 	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/require"
 )
@@ -31,8 +35,8 @@ func TestImportBooksFromCSV(t *testing.T) {
 	require.NoError(t, err)
 	defer tx.Rollback(ctx)
 
-	var userID int64
-	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	user := &data.UserMin{Username: "test"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", user.Username).Scan(&user.ID)
 	require.NoError(t, err)
 
 	in := `Title,Author,Date Finished,Format,
@@ -40,12 +44,245 @@ func TestImportBooksFromCSV(t *testing.T) {
 	The Dilbert Future ,Scott Adams ,7/10/2005,text,
 	Napoleon The Man Behind the Myth,Adam Zamoyski,6/17/2019,audio,`
 
-	err = importBooksFromCSV(ctx, tx, userID, strings.NewReader(in))
-	require.NoError(t, err)
+	importBooksCSV(t, ctx, tx, user, strings.NewReader(in))
 
 	var bookCount int64
-	err = tx.QueryRow(ctx, "select count(*) from books where user_id=$1", userID).Scan(&bookCount)
+	err = tx.QueryRow(ctx, "select count(*) from books where user_id=$1", user.ID).Scan(&bookCount)
 	require.NoError(t, err)
 
 	require.EqualValues(t, 3, bookCount)
 }
+
+func TestImportBooksFromCSVWithRatingAndReview(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	user := &data.UserMin{Username: "test"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", user.Username).Scan(&user.ID)
+	require.NoError(t, err)
+
+	in := `Title,Author,Date Finished,Format,Location,Rating,Review
+Paradise Lost,John Milton,7/2/2005,text,,4.5,"Long.
+
+Worth it."
+The Dilbert Future,Scott Adams,7/10/2005,text,,,`
+
+	importBooksCSV(t, ctx, tx, user, strings.NewReader(in))
+
+	books, err := data.GetAllBooks(ctx, tx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, books, 2)
+
+	require.Equal(t, "The Dilbert Future", books[0].Title)
+	require.EqualValues(t, 0, books[0].Rating)
+	require.Equal(t, "", books[0].Review)
+
+	require.Equal(t, "Paradise Lost", books[1].Title)
+	require.EqualValues(t, 4.5, books[1].Rating)
+	require.Equal(t, "Long.\n\nWorth it.", books[1].Review)
+}
+
+// newBookRequest builds a request as it would look after the middleware for /users/{username}/books/{id} has run with
+// user authenticated and in the path.
+func newBookRequest(ctx context.Context, db dbconn, user *data.UserMin, method string, bookID int64) *http.Request {
+	ctx = context.WithValue(ctx, RequestDBKey, db)
+	ctx = context.WithValue(ctx, RequestSessionKey, &Session{User: *user, IsAuthenticated: true})
+	ctx = context.WithValue(ctx, RequestPathUserKey, user)
+	ctx = context.WithValue(ctx, RequestHTMLTemplateRendererKey, view.NewHTMLTemplateRenderer("../html", nil, false))
+	ctx = context.WithValue(ctx, ctxURLParamKey("id"), bookID)
+
+	return httptest.NewRequest(method, "/", nil).WithContext(ctx)
+}
+
+func TestBookHandlersRejectOtherUsersBook(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var ownerID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&ownerID)
+	require.NoError(t, err)
+
+	other := &data.UserMin{Username: "other"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", other.Username).Scan(&other.ID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, finish_date, format) values($1, $2, $3, $4, $5) returning id",
+		ownerID, "Paradise Lost", "John Milton", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	updateParams := map[string]any{
+		"title":      "Paradise Regained",
+		"author":     "John Milton",
+		"finishDate": "2019-01-01",
+		"format":     "text",
+	}
+
+	for _, tt := range []struct {
+		name    string
+		method  string
+		handler func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error
+		params  map[string]any
+	}{
+		{"BookShow", http.MethodGet, BookShow, map[string]any{}},
+		{"BookEdit", http.MethodGet, BookEdit, map[string]any{}},
+		{"BookConfirmDelete", http.MethodGet, BookConfirmDelete, map[string]any{}},
+		{"BookUpdate", http.MethodPatch, BookUpdate, updateParams},
+		{"BookDelete", http.MethodDelete, BookDelete, map[string]any{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newBookRequest(ctx, tx, other, tt.method, bookID)
+			w := httptest.NewRecorder()
+
+			err := tt.handler(r.Context(), w, r, tt.params)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusNotFound, w.Code)
+			require.NotContains(t, w.Body.String(), "Paradise Lost")
+		})
+	}
+
+	var title string
+	err = tx.QueryRow(ctx, "select title from books where id=$1 and user_id=$2", bookID, ownerID).Scan(&title)
+	require.NoError(t, err)
+	require.Equal(t, "Paradise Lost", title)
+}
+
+func TestBookFinishUsesPathUserTimeZone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	user := &data.UserMin{Username: "test", TimeZone: "Pacific/Auckland"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, time_zone) values($1, 'x', $2) returning id", user.Username, user.TimeZone).Scan(&user.ID)
+	require.NoError(t, err)
+
+	var bookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, status, format) values($1, $2, $3, $4, $5) returning id",
+		user.ID, "Paradise Lost", "John Milton", data.BookStatusReading, "text",
+	).Scan(&bookID)
+	require.NoError(t, err)
+
+	// It is still March 1 at the server but already March 2 in Auckland.
+	r := newBookRequest(ctx, tx, user, http.MethodPost, bookID)
+	r = r.WithContext(context.WithValue(r.Context(), RequestClockKey, func() time.Time {
+		return time.Date(2021, 3, 1, 20, 0, 0, 0, time.UTC)
+	}))
+	w := httptest.NewRecorder()
+
+	err = BookFinish(r.Context(), w, r, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+
+	book, err := data.GetBook(ctx, tx, user.ID, bookID)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC), book.FinishDate)
+}
+
+func TestBookExportCSVRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	source := &data.UserMin{Username: "test"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", source.Username).Scan(&source.ID)
+	require.NoError(t, err)
+
+	target := &data.UserMin{Username: "other"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", target.Username).Scan(&target.ID)
+	require.NoError(t, err)
+
+	for _, book := range []data.Book{
+		{
+			Title:      "Napoleon: A Life",
+			Author:     "Adam Zamoyski",
+			Status:     data.BookStatusFinished,
+			StartDate:  time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC),
+			FinishDate: time.Date(2019, 6, 17, 0, 0, 0, 0, time.UTC),
+			Format:     "audio",
+			Location:   "Home, office",
+			Rating:     4.5,
+			Review:     "First line.\n\n\"Quoted\", with a comma.",
+			Tags:       []string{"biography", "history"},
+			ISBN:       "9780465055937",
+			PageCount:  768,
+			InsertTime: time.Date(2019, 6, 1, 12, 30, 15, 123456000, time.UTC),
+			UpdateTime: time.Date(2019, 6, 18, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			Title:      "The Dilbert Future",
+			Author:     "Scott Adams",
+			Status:     data.BookStatusWantToRead,
+			Format:     "text",
+			InsertTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			UpdateTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	} {
+		book.UserID = source.ID
+		_, err := data.CreateBook(ctx, tx, book, time.Now())
+		require.NoError(t, err)
+	}
+
+	r := newBookRequest(ctx, tx, source, http.MethodGet, 0)
+	w := httptest.NewRecorder()
+	BookExportCSV(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	header, _, _ := strings.Cut(w.Body.String(), "\n")
+	require.Equal(t, strings.Join(booklogCSVHeader, ","), header)
+
+	importBooksCSV(t, ctx, tx, target, w.Body)
+
+	exported, err := data.GetAllBooks(ctx, tx, source.ID)
+	require.NoError(t, err)
+	imported, err := data.GetAllBooks(ctx, tx, target.ID)
+	require.NoError(t, err)
+	require.Len(t, imported, len(exported))
+
+	for i := range exported {
+		exported[i].ID, exported[i].UserID = 0, 0
+		imported[i].ID, imported[i].UserID = 0, 0
+		require.Equal(t, exported[i], imported[i])
+	}
+}
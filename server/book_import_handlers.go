@@ -0,0 +1,522 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+)
+
+const (
+	bookImportActionInsert    = "insert"
+	bookImportActionOverwrite = "overwrite"
+	bookImportActionSkip      = "skip"
+)
+
+// bookImportRow is a CSV record that is ready to be imported.
+type bookImportRow struct {
+	Line        int // Line number in the CSV file. The header is line 1.
+	Form        view.BookEditForm
+	Book        data.Book
+	Errors      []string // Validation errors. The row can only be skipped if there are any.
+	DuplicateID int64    // ID of an existing book that appears to be the same book. 0 if there is none.
+
+	// DuplicateLine is an earlier line in the same file that appears to be the same book. 0 if there is none.
+	DuplicateLine int
+
+	Action string
+}
+
+func BookImportCSVForm(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_csv_form.html", map[string]any{
+		"bva": baseViewArgsFromRequest(r),
+	})
+}
+
+// BookImportCSV stores the uploaded CSV file and redirects to the import preview.
+func BookImportCSV(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	r.ParseMultipartForm(10 << 20)
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, err := readBookImportCSV(file)
+	if err != nil {
+		return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_csv_form.html", map[string]any{
+			"bva":       baseViewArgsFromRequest(r),
+			"importErr": err,
+		})
+	}
+
+	bookImport, err := data.CreateBookImport(ctx, db, pathUser.ID, fileHeader.Filename, records)
+	if err != nil {
+		return err
+	}
+
+	// Files from unrecognized applications need their columns mapped before they can be previewed.
+	if detectCSVImporter(records[0]) == nil {
+		http.Redirect(w, r, route.BookImportMappingPath(pathUser.Username, bookImport.ID), http.StatusSeeOther)
+		return nil
+	}
+
+	http.Redirect(w, r, route.BookImportPath(pathUser.Username, bookImport.ID), http.StatusSeeOther)
+	return nil
+}
+
+// BookImportShow renders the preview of an import. It shows every row with its validation errors and likely duplicates
+// and lets the user choose what to do with each row.
+func BookImportShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	importID := int64URLParam(r, "id")
+
+	bookImport, err := data.GetBookImport(ctx, db, pathUser.ID, importID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	rows, skippedCount, err := prepareBookImportRows(ctx, db, pathUser.ID, bookImport.Records, bookImport.Mapping, pathUserToday(ctx))
+	if err != nil {
+		return err
+	}
+
+	return renderBookImportPreview(ctx, w, r, bookImport, rows, skippedCount, nil)
+}
+
+// BookImportCommit imports the rows of an import according to the actions chosen by the user.
+func BookImportCommit(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	importID := int64URLParam(r, "id")
+
+	bookImport, err := data.GetBookImport(ctx, db, pathUser.ID, importID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	rows, skippedCount, err := prepareBookImportRows(ctx, db, pathUser.ID, bookImport.Records, bookImport.Mapping, pathUserToday(ctx))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if action, ok := params["action_"+strconv.Itoa(row.Line)].(string); ok {
+			row.Action = action
+		}
+	}
+
+	err = commitBookImport(ctx, db, pathUser.ID, bookImport.ID, rows, pathUserToday(ctx))
+	if err != nil {
+		var actionErr *bookImportActionError
+		if errors.As(err, &actionErr) {
+			return renderBookImportPreview(ctx, w, r, bookImport, rows, skippedCount, err)
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.BooksPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// BookImportDelete cancels an import.
+func BookImportDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	importID := int64URLParam(r, "id")
+
+	err := data.DeleteBookImport(ctx, db, pathUser.ID, importID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, route.ImportBookCSVFormPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+func renderBookImportPreview(ctx context.Context, w http.ResponseWriter, r *http.Request, bookImport *data.BookImport, rows []*bookImportRow, skippedCount int, importErr error) error {
+	var errorCount, duplicateCount, repeatedCount int
+	for _, row := range rows {
+		if row.Errors != nil {
+			errorCount++
+		}
+		if row.DuplicateID != 0 {
+			duplicateCount++
+		}
+		if row.DuplicateLine != 0 {
+			repeatedCount++
+		}
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_preview.html", map[string]any{
+		"bva":            baseViewArgsFromRequest(r),
+		"bookImport":     bookImport,
+		"rows":           rows,
+		"skippedCount":   skippedCount,
+		"errorCount":     errorCount,
+		"duplicateCount": duplicateCount,
+		"repeatedCount":  repeatedCount,
+		"importErr":      importErr,
+	})
+}
+
+// importMappingColumn is a column of a CSV file on the column mapping page.
+type importMappingColumn struct {
+	Index   int
+	Header  string
+	Samples []string
+	Field   string
+}
+
+// BookImportMapping renders the column mapping page. It shows the header and sample rows of the CSV file and lets the
+// user map each column to a book field. The mapping is initialized from the profile param, the import's current
+// mapping, the first saved profile that matches the header, or a guess from the header names in that order.
+func BookImportMapping(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	importID := int64URLParam(r, "id")
+
+	bookImport, err := data.GetBookImport(ctx, db, pathUser.ID, importID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	profiles, err := data.GetImportProfiles(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	header := bookImport.Records[0]
+	var mapping *data.ImportMapping
+	var profileName string
+	if profileID, err := strconv.ParseInt(fmt.Sprint(params["profile"]), 10, 64); err == nil {
+		for _, p := range profiles {
+			if p.ID == profileID {
+				mapping = &p.Mapping
+				profileName = p.Name
+			}
+		}
+	}
+	if mapping == nil {
+		mapping = bookImport.Mapping
+	}
+	if mapping == nil {
+		for _, p := range profiles {
+			if p.Mapping.Matches(header) {
+				mapping = &p.Mapping
+				profileName = p.Name
+				break
+			}
+		}
+	}
+	if mapping == nil {
+		guess := guessImportMapping(header)
+		mapping = &guess
+	}
+
+	return renderBookImportMapping(ctx, w, r, bookImport, profiles, *mapping, profileName, nil)
+}
+
+// BookImportMappingUpdate sets the column mapping of an import and optionally saves it as a named import profile.
+func BookImportMappingUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	importID := int64URLParam(r, "id")
+
+	bookImport, err := data.GetBookImport(ctx, db, pathUser.ID, importID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	mapping := data.ImportMapping{Columns: make(map[string]string)}
+	mapping.DateLayout, _ = params["dateLayout"].(string)
+	mapping.DefaultFormat, _ = params["defaultFormat"].(string)
+	for i, name := range bookImport.Records[0] {
+		if field, _ := params["column_"+strconv.Itoa(i)].(string); field != "" {
+			mapping.Columns[name] = field
+		}
+	}
+	profileName, _ := params["profileName"].(string)
+
+	renderErr := func(err error) error {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			profiles, err := data.GetImportProfiles(ctx, db, pathUser.ID)
+			if err != nil {
+				return err
+			}
+			return renderBookImportMapping(ctx, w, r, bookImport, profiles, mapping, profileName, verr)
+		}
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = data.SetBookImportMapping(ctx, tx, pathUser.ID, bookImport.ID, mapping)
+	if err != nil {
+		return renderErr(err)
+	}
+
+	if strings.TrimSpace(profileName) != "" {
+		_, err = data.SaveImportProfile(ctx, tx, pathUser.ID, profileName, mapping)
+		if err != nil {
+			return renderErr(err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.BookImportPath(pathUser.Username, bookImport.ID), http.StatusSeeOther)
+	return nil
+}
+
+func renderBookImportMapping(ctx context.Context, w http.ResponseWriter, r *http.Request, bookImport *data.BookImport, profiles []*data.ImportProfile, mapping data.ImportMapping, profileName string, verr *errortree.Node) error {
+	const sampleCount = 3
+
+	header := bookImport.Records[0]
+	samples := bookImport.Records[1:min(len(bookImport.Records), sampleCount+1)]
+	columns := make([]*importMappingColumn, len(header))
+	for i, name := range header {
+		column := &importMappingColumn{Index: i, Header: name, Field: mapping.Columns[name]}
+		for _, record := range samples {
+			if i < len(record) {
+				column.Samples = append(column.Samples, record[i])
+			}
+		}
+		columns[i] = column
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "book_import_mapping.html", map[string]any{
+		"bva":         baseViewArgsFromRequest(r),
+		"bookImport":  bookImport,
+		"profiles":    profiles,
+		"columns":     columns,
+		"mapping":     mapping,
+		"profileName": profileName,
+		"verr":        verr,
+	})
+}
+
+// ImportProfileDelete deletes a saved import profile and returns to the column mapping page of the import given by the
+// importID param.
+func ImportProfileDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	profileID := int64URLParam(r, "id")
+
+	err := data.DeleteImportProfile(ctx, db, pathUser.ID, profileID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	if importID, err := strconv.ParseInt(fmt.Sprint(params["importID"]), 10, 64); err == nil {
+		http.Redirect(w, r, route.BookImportMappingPath(pathUser.Username, importID), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, route.ImportBookCSVFormPath(pathUser.Username), http.StatusSeeOther)
+	}
+	return nil
+}
+
+// readBookImportCSV reads the records of a CSV file to import.
+func readBookImportCSV(r io.Reader) ([][]string, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 2 {
+		return nil, errors.New("CSV must have at least 2 rows")
+	}
+
+	return records, nil
+}
+
+// prepareBookImportRows parses and validates records with mapping and detects books that are already owned by userID or
+// that appear more than once in records. If mapping is nil the format is detected from the header row. It also returns
+// the number of records the importer skipped such as books on Goodreads shelves other than read. Rows with errors or
+// duplicates default to being skipped. All other rows default to being inserted. today is the current date of the user.
+func prepareBookImportRows(ctx context.Context, db dbconn, userID int64, records [][]string, mapping *data.ImportMapping, today time.Time) ([]*bookImportRow, int, error) {
+	importer := newCSVImporter(records[0], mapping)
+
+	duplicateKeys, err := data.GetBookDuplicateKeys(ctx, db, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// fileDuplicateLines maps the duplicate key of each valid row that is not already owned to its line.
+	fileDuplicateLines := make(map[string]int)
+
+	var rows []*bookImportRow
+	var skippedCount int
+	for i, record := range records[1:] {
+		form, ok := importer.parseRecord(record)
+		if !ok {
+			skippedCount++
+			continue
+		}
+
+		row := &bookImportRow{Line: i + 2, Form: form, Action: bookImportActionInsert}
+
+		if errorer, ok := importer.(csvRecordErrorer); ok {
+			row.Errors = errorer.recordErrors(record)
+		}
+
+		book, verr := form.Parse()
+		if verr == nil {
+			book.Normalize()
+			verr = book.Validate(today)
+		}
+		book.UserID = userID
+		if verr != nil && row.Errors == nil {
+			// Errors in the record would also cause misleading validation errors such as a missing finish date.
+			row.Errors = view.ValidationErrorMessages(verr)
+		}
+
+		if tsImporter, ok := importer.(csvTimestampImporter); ok {
+			var err error
+			book.InsertTime, book.UpdateTime, err = tsImporter.parseTimestamps(record)
+			if err != nil {
+				row.Errors = append(row.Errors, err.Error())
+			}
+		}
+		row.Book = book
+
+		if row.Errors != nil {
+			row.Action = bookImportActionSkip
+		}
+
+		duplicateKey := data.BookDuplicateKey(book.Title, book.Author, book.FinishDate)
+		if id, ok := duplicateKeys[duplicateKey]; ok {
+			row.DuplicateID = id
+			row.Action = bookImportActionSkip
+		} else if line, ok := fileDuplicateLines[duplicateKey]; ok {
+			row.DuplicateLine = line
+			row.Action = bookImportActionSkip
+		} else if row.Errors == nil {
+			fileDuplicateLines[duplicateKey] = row.Line
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, skippedCount, nil
+}
+
+// bookImportActionError is returned when an action cannot be applied to a row.
+type bookImportActionError struct {
+	line   int
+	action string
+}
+
+func (e *bookImportActionError) Error() string {
+	return fmt.Sprintf("line %d: cannot %s", e.line, e.action)
+}
+
+// commitBookImport applies the action of each row and deletes the import specified by importID in a single
+// transaction. today is the current date of the user.
+func commitBookImport(ctx context.Context, db dbconn, userID, importID int64, rows []*bookImportRow, today time.Time) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, row := range rows {
+		switch row.Action {
+		case bookImportActionSkip:
+		case bookImportActionInsert:
+			if row.Errors != nil {
+				return &bookImportActionError{line: row.Line, action: row.Action}
+			}
+			_, err := data.CreateBook(ctx, tx, row.Book, today)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		case bookImportActionOverwrite:
+			if row.Errors != nil || row.DuplicateID == 0 {
+				return &bookImportActionError{line: row.Line, action: row.Action}
+			}
+			existing, err := data.GetBook(ctx, tx, userID, row.DuplicateID)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			book := row.Book
+			book.ID = row.DuplicateID
+			// Most CSV formats cannot mark a book as private. Overwriting must not make a private book visible.
+			book.Private = book.Private || existing.Private
+			err = data.UpdateBook(ctx, tx, book, today)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		default:
+			return &bookImportActionError{line: row.Line, action: row.Action}
+		}
+	}
+
+	err = data.DeleteBookImport(ctx, tx, userID, importID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// importBooksCSV uploads the CSV file r as user through BookImportCSV and commits it with the default actions through
+// BookImportCommit.
+func importBooksCSV(t *testing.T, ctx context.Context, db dbconn, user *data.UserMin, r io.Reader) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "books.csv")
+	require.NoError(t, err)
+	_, err = io.Copy(fw, r)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body).WithContext(newBookRequest(ctx, db, user, http.MethodPost, 0).Context())
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	err = BookImportCSV(req.Context(), w, req, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+
+	// Unrecognized files are redirected to the column mapping but can be committed with the guessed mapping.
+	location := strings.TrimSuffix(w.Header().Get("Location"), "/mapping")
+	importID, err := strconv.ParseInt(path.Base(location), 10, 64)
+	require.NoError(t, err)
+	require.Equal(t, route.BookImportPath(user.Username, importID), location)
+
+	req = newBookRequest(ctx, db, user, http.MethodPost, importID)
+	w = httptest.NewRecorder()
+	err = BookImportCommit(req.Context(), w, req, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+}
+
+func TestBookImportPreviewAndCommit(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('test', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+
+	existing, err := data.CreateBook(ctx, tx, data.Book{
+		UserID:     userID,
+		Title:      "Paradise Lost",
+		Author:     "John Milton",
+		FinishDate: time.Date(2005, 7, 2, 0, 0, 0, 0, time.UTC),
+		Format:     "text",
+	}, time.Now())
+	require.NoError(t, err)
+
+	in := `Title,Author,Date Finished,Format,Location
+paradise  lost,JOHN MILTON,7/2/2005,audio,
+The Dilbert Future,Scott Adams,7/10/2005,text,
+,Adam Zamoyski,6/17/2019,audio,
+Napoleon,Adam Zamoyski,6/17/2019,audio,
+the dilbert future,Scott Adams,7/10/2005,audio,
+Paradise Lost,John Milton,7/2/2005,text,`
+
+	records, err := readBookImportCSV(strings.NewReader(in))
+	require.NoError(t, err)
+
+	bookImport, err := data.CreateBookImport(ctx, tx, userID, "books.csv", records)
+	require.NoError(t, err)
+
+	rows, skippedCount, err := prepareBookImportRows(ctx, tx, userID, bookImport.Records, bookImport.Mapping, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 0, skippedCount)
+	require.Len(t, rows, 6)
+
+	require.Equal(t, 2, rows[0].Line)
+	require.Equal(t, existing.ID, rows[0].DuplicateID)
+	require.Equal(t, bookImportActionSkip, rows[0].Action)
+
+	require.Zero(t, rows[1].DuplicateID)
+	require.Nil(t, rows[1].Errors)
+	require.Equal(t, bookImportActionInsert, rows[1].Action)
+
+	require.Equal(t, []string{"title cannot be blank"}, rows[2].Errors)
+	require.Equal(t, bookImportActionSkip, rows[2].Action)
+
+	// Books repeated in the same file are only inserted once by default.
+	require.Equal(t, 3, rows[4].DuplicateLine)
+	require.Zero(t, rows[4].DuplicateID)
+	require.Equal(t, bookImportActionSkip, rows[4].Action)
+
+	// A repeat of an existing book is reported as a duplicate of that book.
+	require.Equal(t, existing.ID, rows[5].DuplicateID)
+	require.Zero(t, rows[5].DuplicateLine)
+	require.Equal(t, bookImportActionSkip, rows[5].Action)
+
+	// Rows with errors cannot be inserted.
+	rows[2].Action = bookImportActionInsert
+	err = commitBookImport(ctx, tx, userID, bookImport.ID, rows, time.Now())
+	var actionErr *bookImportActionError
+	require.True(t, errors.As(err, &actionErr))
+
+	rows[0].Action = bookImportActionOverwrite
+	rows[2].Action = bookImportActionSkip
+	err = commitBookImport(ctx, tx, userID, bookImport.ID, rows, time.Now())
+	require.NoError(t, err)
+
+	var bookCount int64
+	err = tx.QueryRow(ctx, "select count(*) from books where user_id=$1", userID).Scan(&bookCount)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, bookCount)
+
+	overwritten, err := data.GetBook(ctx, tx, userID, existing.ID)
+	require.NoError(t, err)
+	require.Equal(t, "audio", overwritten.Format)
+
+	_, err = data.GetBookImport(ctx, tx, userID, bookImport.ID)
+	var nfErr *data.NotFoundError
+	require.ErrorAs(t, err, &nfErr)
+}
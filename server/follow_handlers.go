@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+)
+
+const feedPageSize = 50
+
+// UserFollow makes the current user follow the path user.
+func UserFollow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	if !session.IsAuthenticated {
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	err := data.Follow(ctx, db, session.User.ID, pathUser.ID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.UserHomePath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// UserUnfollow makes the current user stop following the path user. It does not require the path user to be visible so
+// users who have made their books private can still be unfollowed.
+func UserUnfollow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	if !session.IsAuthenticated {
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	err := data.Unfollow(ctx, db, session.User.ID, pathUser.ID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		}
+		return err
+	}
+
+	if pathUser.IsVisible() {
+		http.Redirect(w, r, route.UserHomePath(pathUser.Username), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, route.FeedPath(), http.StatusSeeOther)
+	}
+	return nil
+}
+
+// Feed renders the books recently finished by the users the current user follows.
+func Feed(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+
+	if !session.IsAuthenticated {
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	after, _ := params["after"].(string)
+	page, err := data.GetFeedPage(ctx, db, session.User.ID, after, feedPageSize)
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidBookCursor) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return nil
+		}
+		return err
+	}
+
+	followedUsers, err := data.GetFollowedUsers(ctx, db, session.User.ID)
+	if err != nil {
+		return err
+	}
+
+	var nextPagePath string
+	if page.NextCursor != "" {
+		nextPagePath = route.FeedPath() + "?" + url.Values{"after": {page.NextCursor}}.Encode()
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "feed.html", map[string]any{
+		"bva":           baseViewArgsFromRequest(r),
+		"items":         page.Items,
+		"followedUsers": followedUsers,
+		"nextPagePath":  nextPagePath,
+	})
+}
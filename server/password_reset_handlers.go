@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/mail"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/rs/zerolog/hlog"
+)
+
+const passwordResetMessageBody = `Hi %s,
+
+Someone asked to reset the password of your Booklog account. If it was you, follow this link to choose a new password:
+
+%s
+
+The link can be used once and expires in %d minutes. If you did not ask to reset your password you can ignore this message.
+`
+
+func PasswordResetNew(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "password_reset_new.html", map[string]any{
+		"bva": baseViewArgsFromRequest(r),
+	})
+}
+
+// passwordResetMailTimeout limits how long sending a password reset mail in the background can take.
+const passwordResetMailTimeout = time.Minute
+
+// PasswordResetCreate emails a password reset link to the user with the submitted email address. The response is the
+// same whether or not a user has the address so it cannot be used to discover which addresses have accounts. The mail is
+// sent in the background so neither the time it takes nor whether it fails is visible in the response.
+func PasswordResetCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	mailer := ctx.Value(RequestMailerKey).(mail.Mailer)
+
+	email := r.FormValue("email")
+	reset, err := data.CreatePasswordResetToken(ctx, db, email, requestNow(ctx))
+	if err != nil {
+		var verr *errortree.Node
+		var nfErr *data.NotFoundError
+		switch {
+		case errors.As(err, &verr):
+			return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "password_reset_new.html", map[string]any{
+				"bva":   baseViewArgsFromRequest(r),
+				"email": email,
+				"verr":  verr,
+			})
+		case errors.As(err, &nfErr):
+			// Respond as if the mail was sent.
+		default:
+			return err
+		}
+	} else if baseURL, ok := ctx.Value(RequestBaseURLKey).(string); !ok {
+		// Never fall back to requestBaseURL. The Host header could be forged to send the link to another site.
+		hlog.FromRequest(r).Error().Msg("base-url not set. Password reset mail not sent.")
+	} else {
+		link := baseURL + route.PasswordResetTokenPath(reset.Token)
+		msg := &mail.Message{
+			To:      reset.Email,
+			Subject: "Reset your Booklog password",
+			Body:    fmt.Sprintf(passwordResetMessageBody, reset.User.Username, link, int(data.PasswordResetTokenLifetime.Minutes())),
+		}
+		logger := hlog.FromRequest(r)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetMailTimeout)
+			defer cancel()
+
+			err := mailer.Send(ctx, msg)
+			if err != nil {
+				logger.Error().Err(err).Msg("password reset mail failed")
+			}
+		}()
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "password_reset_new.html", map[string]any{
+		"bva":   baseViewArgsFromRequest(r),
+		"email": email,
+		"sent":  true,
+	})
+}
+
+func PasswordResetEdit(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	token, _ := params["token"].(string)
+	_, err := data.FindPasswordResetToken(ctx, db, token, requestNow(ctx))
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if !errors.As(err, &nfErr) {
+			return err
+		}
+	}
+
+	return renderPasswordResetEdit(ctx, w, r, token, err == nil, nil)
+}
+
+// PasswordResetUpdate sets the new password and logs the user out everywhere. The user must log in with the new
+// password afterward.
+func PasswordResetUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	token, _ := params["token"].(string)
+	args := data.ResetPasswordArgs{
+		Password:             r.FormValue("password"),
+		PasswordConfirmation: r.FormValue("passwordConfirmation"),
+	}
+
+	_, err := data.ResetPassword(ctx, db, token, args, requestNow(ctx))
+	if err != nil {
+		var verr *errortree.Node
+		var nfErr *data.NotFoundError
+		switch {
+		case errors.As(err, &verr):
+			return renderPasswordResetEdit(ctx, w, r, token, true, verr)
+		case errors.As(err, &nfErr):
+			return renderPasswordResetEdit(ctx, w, r, token, false, nil)
+		default:
+			return err
+		}
+	}
+
+	clearSessionCookie(w)
+	http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+	return nil
+}
+
+// renderPasswordResetEdit renders the form for choosing a new password. valid is false if token cannot be used.
+func renderPasswordResetEdit(ctx context.Context, w http.ResponseWriter, r *http.Request, token string, valid bool, verr *errortree.Node) error {
+	// The token is in the URL. Do not leak it to other sites.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "password_reset_edit.html", map[string]any{
+		"bva":   baseViewArgsFromRequest(r),
+		"token": token,
+		"valid": valid,
+		"verr":  verr,
+	})
+}
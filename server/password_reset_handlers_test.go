@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/booklog/mail"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg *mail.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestPasswordResetCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+	var userID int64
+	err = tx.QueryRow(ctx, "select id from users where username='test'").Scan(&userID)
+	require.NoError(t, err)
+	err = data.SetUserEmail(ctx, tx, userID, "test@example.com")
+	require.NoError(t, err)
+
+	// Act as the application role with no user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+
+	var mailer mail.Mailer
+	serve := func(email string, baseURL string) *httptest.ResponseRecorder {
+		rctx := context.WithValue(ctx, RequestDBKey, tx)
+		rctx = context.WithValue(rctx, RequestSessionKey, &Session{})
+		rctx = context.WithValue(rctx, RequestHTMLTemplateRendererKey, view.NewHTMLTemplateRenderer("../html", nil, false))
+		rctx = context.WithValue(rctx, RequestMailerKey, mailer)
+		if baseURL != "" {
+			rctx = context.WithValue(rctx, RequestBaseURLKey, baseURL)
+		}
+		form := url.Values{"email": {email}}
+		r := httptest.NewRequest("POST", "/password_reset", strings.NewReader(form.Encode())).WithContext(rctx)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Host = "attacker.example.com"
+		w := httptest.NewRecorder()
+		err := PasswordResetCreate(rctx, w, r, nil)
+		require.NoError(t, err)
+		return w
+	}
+
+	// A mail server failure is not revealed.
+	mailer = failingMailer{}
+	w := serve("test@example.com", "https://booklog.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "has been sent")
+
+	localMailer := &mail.LocalMailer{}
+	mailer = localMailer
+
+	// Without a configured base URL the link would have to come from the forgeable Host header so nothing is sent.
+	w = serve("test@example.com", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "has been sent")
+	require.Empty(t, localMailer.Messages())
+
+	w = serve("nobody@example.com", "https://booklog.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "has been sent")
+	require.Never(t, func() bool { return len(localMailer.Messages()) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	w = serve("test@example.com", "https://booklog.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "has been sent")
+	require.Eventually(t, func() bool { return len(localMailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+	messages := localMailer.Messages()
+	require.Equal(t, "test@example.com", messages[0].To)
+	require.Contains(t, messages[0].Body, "https://booklog.example.com/password_reset/")
+	require.NotContains(t, messages[0].Body, "attacker.example.com")
+}
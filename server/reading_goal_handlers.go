@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/jackc/structify"
+)
+
+// ReadingGoalIndex renders the reading goals for the year param or the current year.
+func ReadingGoalIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	year := int32(pathUserToday(ctx).Year())
+	if s, ok := params["year"].(string); ok {
+		if n, err := strconv.ParseInt(s, 10, 32); err == nil {
+			year = int32(n)
+		}
+	}
+
+	form := view.ReadingGoalForm{Year: strconv.Itoa(int(year))}
+	return renderReadingGoalIndex(ctx, w, r, year, form, nil)
+}
+
+// ReadingGoalCreate creates a reading goal or replaces the target of the existing goal for the same year and format.
+func ReadingGoalCreate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	var form view.ReadingGoalForm
+	_ = structify.Parse(params, &form)
+	attrs, verr := form.Parse()
+	if verr != nil {
+		return renderReadingGoalIndex(ctx, w, r, int32(pathUserToday(ctx).Year()), form, verr)
+	}
+	attrs.UserID = pathUser.ID
+
+	goal, err := data.SaveReadingGoal(ctx, db, attrs)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderReadingGoalIndex(ctx, w, r, int32(pathUserToday(ctx).Year()), form, verr)
+		}
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("%s?year=%d", route.ReadingGoalsPath(pathUser.Username), goal.Year), http.StatusSeeOther)
+	return nil
+}
+
+func ReadingGoalDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	goalID := int64URLParam(r, "id")
+
+	err := data.DeleteReadingGoal(ctx, db, pathUser.ID, goalID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, route.ReadingGoalsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+func renderReadingGoalIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, year int32, form view.ReadingGoalForm, verr *errortree.Node) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	goals, err := data.GetReadingGoals(ctx, db, pathUser.ID, year)
+	if err != nil {
+		return err
+	}
+
+	booksPerYear, err := data.BooksPerYear(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	progress, err := getReadingGoalProgress(ctx, db, pathUser.ID, goals, booksPerYear, pathUserToday(ctx))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "reading_goal_index.html", map[string]any{
+		"bva":          baseViewArgsFromRequest(r),
+		"year":         year,
+		"prevYear":     year - 1,
+		"nextYear":     year + 1,
+		"goalProgress": progress,
+		"form":         form,
+		"verr":         verr,
+	})
+}
+
+// getReadingGoalProgress returns the progress toward each of goals as of today. All goals must be for the same year.
+// booksPerYear is the result of data.BooksPerYear for userID.
+func getReadingGoalProgress(ctx context.Context, db dbconn, userID int64, goals []*data.ReadingGoal, booksPerYear []data.BooksPerTimeItem, today time.Time) ([]data.ReadingGoalProgress, error) {
+	if len(goals) == 0 {
+		return nil, nil
+	}
+	year := goals[0].Year
+
+	var yearCount int32
+	for _, item := range booksPerYear {
+		if item.Time.Year() == int(year) {
+			yearCount = item.Count
+		}
+	}
+
+	booksPerFormat, err := data.BooksPerFormatInYear(ctx, db, userID, year)
+	if err != nil {
+		return nil, err
+	}
+	formatCounts := make(map[string]int32, len(booksPerFormat))
+	for _, item := range booksPerFormat {
+		formatCounts[item.Format] = item.Count
+	}
+
+	progress := make([]data.ReadingGoalProgress, len(goals))
+	for i, goal := range goals {
+		completed := yearCount
+		if goal.Format != "" {
+			completed = formatCounts[goal.Format]
+		}
+		progress[i] = data.NewReadingGoalProgress(goal, completed, today)
+	}
+
+	return progress, nil
+}
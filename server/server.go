@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -17,6 +19,8 @@ import (
 	"github.com/gorilla/securecookie"
 	"github.com/jackc/booklog/bee"
 	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/lazypgxconn"
+	"github.com/jackc/booklog/mail"
 	"github.com/jackc/booklog/route"
 	"github.com/jackc/booklog/view"
 	"github.com/jackc/pgx/v5"
@@ -36,6 +40,9 @@ const (
 	RequestPathUserKey
 	RequestDevModeKey
 	RequestHTMLTemplateRendererKey
+	RequestClockKey // func() time.Time that replaces time.Now. Optional. Used by tests to pin the current time.
+	RequestMailerKey
+	RequestBaseURLKey // string scheme and host of the site. Optional. See requestBaseURL.
 )
 
 type dbconn interface {
@@ -47,6 +54,7 @@ type dbconn interface {
 
 type Session struct {
 	ID              [16]byte
+	PublicID        int64
 	User            data.UserMin
 	IsAuthenticated bool
 	sc              *securecookie.SecureCookie
@@ -60,7 +68,7 @@ type AppServer struct {
 	htr *view.HTMLTemplateRenderer
 }
 
-func NewAppServer(listenAddress string, csrfKey []byte, secureCookies bool, cookieHashKey []byte, cookieBlockKey []byte, dbpool *pgxpool.Pool, htr *view.HTMLTemplateRenderer, devMode bool) (*AppServer, error) {
+func NewAppServer(listenAddress string, csrfKey []byte, secureCookies bool, cookieHashKey []byte, cookieBlockKey []byte, dbpool *pgxpool.Pool, htr *view.HTMLTemplateRenderer, mailer mail.Mailer, baseURL string, devMode bool) (*AppServer, error) {
 
 	log := zerolog.New(os.Stdout).With().
 		Timestamp().
@@ -96,55 +104,145 @@ func NewAppServer(listenAddress string, csrfKey []byte, secureCookies bool, cook
 
 	r.Use(middleware.Recoverer)
 
-	CSRF := csrf.Protect(csrfKey, csrf.Path("/"), csrf.Secure(secureCookies))
-	r.Use(CSRF)
-
-	r.Use(devModeHandler(devMode))
-	r.Use(pgxPoolHandler(dbpool))
-	r.Use(htmlTemplateRendererHandler(htr))
-
-	r.Use(sessionHandler(securecookie.New(cookieHashKey, cookieBlockKey)))
-
-	hb := &bee.HandlerBuilder{
-		ErrorHandlers: []bee.ErrorHandler{
-			func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
-				fmt.Println(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return true, nil
-			},
-		},
-		ETagDigestFilter: regexp.MustCompile(`<input type="hidden" name="gorilla.csrf.Token" value="[^"]+">`),
-	}
-
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	r.Method("GET", "/", hb.New(RootHandler))
-	r.Method("GET", "/user_registration/new", hb.New(UserRegistrationNew))
-	r.Method("POST", "/user_registration", hb.New(UserRegistrationCreate))
-
-	r.Method("GET", "/login", hb.New(UserLoginForm))
-	r.Method("POST", "/login/handle", hb.New(UserLogin))
-
-	r.Method("POST", "/logout", hb.New(UserLogout))
-
-	r.Route("/users/{username}", func(r chi.Router) {
-		r.Use(pathUserHandler())
-		r.Use(requireSameSessionUserAndPathUserHandler())
-		r.Method("GET", "/", hb.New(UserHome))
-		r.Method("GET", "/books", hb.New(BookIndex))
-		r.Method("GET", "/books/new", hb.New(BookNew))
-		r.Method("POST", "/books", hb.New(BookCreate))
-		r.Method("GET", "/books/{id}/edit", parseInt64URLParam("id")(hb.New(BookEdit)))
-		r.Method("GET", "/books/{id}", parseInt64URLParam("id")(hb.New(BookShow)))
-		r.Method("GET", "/books/{id}/confirm_delete", parseInt64URLParam("id")(hb.New(BookConfirmDelete)))
-		r.Method("PATCH", "/books/{id}", parseInt64URLParam("id")(hb.New(BookUpdate)))
-		r.Method("DELETE", "/books/{id}", parseInt64URLParam("id")(hb.New(BookDelete)))
-		r.Method("GET", "/books/import_csv/form", hb.New(BookImportCSVForm))
-		r.Method("POST", "/books/import_csv", hb.New(BookImportCSV))
-		r.Method("GET", "/books.csv", hb.New(BookExportCSV))
+	// The JSON API is authenticated by bearer tokens instead of cookies so it is not subject to CSRF protection.
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(apiTokenHandler(dbpool))
+		r.Use(lazyPgxConnHandler(dbpool))
+
+		apiHB := newAPIHandlerBuilder()
+
+		r.Route("/users/{username}", func(r chi.Router) {
+			r.Use(requireAPIPathUserHandler())
+			r.Method("GET", "/books", apiHB.New(APIBookIndex))
+			r.Method("POST", "/books", apiHB.New(APIBookCreate))
+			r.Method("GET", "/books/{id}", parseInt64URLParam("id")(apiHB.New(APIBookShow)))
+			r.Method("PATCH", "/books/{id}", parseInt64URLParam("id")(apiHB.New(APIBookUpdate)))
+			r.Method("DELETE", "/books/{id}", parseInt64URLParam("id")(apiHB.New(APIBookDelete)))
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		CSRF := csrf.Protect(csrfKey, csrf.Path("/"), csrf.Secure(secureCookies))
+		r.Use(CSRF)
+
+		r.Use(devModeHandler(devMode))
+		r.Use(htmlTemplateRendererHandler(htr))
+		r.Use(mailerHandler(mailer, baseURL))
+
+		sc := securecookie.New(cookieHashKey, cookieBlockKey)
+		sc.MaxAge(int(data.SessionMaxAge / time.Second))
+		r.Use(sessionHandler(sc, dbpool))
+		r.Use(lazyPgxConnHandler(dbpool))
+
+		hb := &bee.HandlerBuilder{
+			ErrorHandlers: []bee.ErrorHandler{
+				func(w http.ResponseWriter, r *http.Request, err error) (bool, error) {
+					fmt.Println(err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return true, nil
+				},
+			},
+			ETagDigestFilter: regexp.MustCompile(`<input type="hidden" name="gorilla.csrf.Token" value="[^"]+">`),
+		}
+
+		r.Method("GET", "/", hb.New(RootHandler))
+		r.Method("GET", "/user_registration/new", hb.New(UserRegistrationNew))
+		r.Method("POST", "/user_registration", hb.New(UserRegistrationCreate))
+
+		r.Method("GET", "/login", hb.New(UserLoginForm))
+		r.Method("POST", "/login/handle", hb.New(UserLogin))
+		r.Method("GET", "/login/two_factor", hb.New(UserLoginTwoFactorForm))
+		r.Method("POST", "/login/two_factor", hb.New(UserLoginTwoFactor))
+
+		r.Method("POST", "/logout", hb.New(UserLogout))
+
+		r.Method("GET", "/password_reset/new", hb.New(PasswordResetNew))
+		r.Method("POST", "/password_reset", hb.New(PasswordResetCreate))
+		r.Method("GET", "/password_reset/{token}", hb.New(PasswordResetEdit))
+		r.Method("POST", "/password_reset/{token}", hb.New(PasswordResetUpdate))
+
+		r.Method("GET", "/shared/years/{token}", hb.New(SharedYearReviewShow))
+
+		r.Method("GET", "/feed", hb.New(Feed))
+
+		r.Route("/users/{username}", func(r chi.Router) {
+			r.Use(pathUserHandler())
+
+			// Any authenticated user can follow a visible user and unfollow anyone.
+			r.Method("POST", "/follow", hb.New(UserFollow))
+			r.Method("DELETE", "/follow", hb.New(UserUnfollow))
+
+			// Calendar applications cannot log in so the calendar can also be read with a calendar token.
+			r.With(requireCalendarReadAccessHandler()).Method("GET", "/books.ics", hb.New(BookCalendar))
+
+			// Pages that visitors can read when the path user's books are visible.
+			r.Group(func(r chi.Router) {
+				r.Use(requirePathUserReadAccessHandler())
+				r.Method("GET", "/", hb.New(UserHome))
+				r.Method("GET", "/books", hb.New(BookIndex))
+				r.Method("GET", "/books/{id}", parseInt64URLParam("id")(hb.New(BookShow)))
+				r.Method("GET", "/books.atom", hb.New(BookFeedAtom))
+				r.Method("GET", "/books.rss", hb.New(BookFeedRSS))
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(requireSameSessionUserAndPathUserHandler())
+				r.Method("GET", "/stats", hb.New(UserStats))
+				r.Method("GET", "/years/{year}", parseInt64URLParam("year")(hb.New(YearReviewShow)))
+				r.Method("POST", "/years/{year}/share", parseInt64URLParam("year")(hb.New(YearReviewShare)))
+				r.Method("DELETE", "/years/{year}/share", parseInt64URLParam("year")(hb.New(YearReviewUnshare)))
+				r.Method("GET", "/settings", hb.New(UserSettings))
+				r.Method("PATCH", "/settings", hb.New(UserSettingsUpdate))
+				r.Method("PATCH", "/settings/password", hb.New(UserPasswordUpdate))
+				r.Method("PATCH", "/settings/username", hb.New(UserUsernameUpdate))
+				r.Method("PATCH", "/settings/email", hb.New(UserEmailUpdate))
+				r.Method("GET", "/two_factor", hb.New(UserTwoFactorShow))
+				r.Method("POST", "/two_factor", hb.New(UserTwoFactorEnable))
+				r.Method("DELETE", "/two_factor", hb.New(UserTwoFactorDisable))
+				r.Method("POST", "/two_factor/recovery_codes", hb.New(UserRecoveryCodesRegenerate))
+				r.Method("POST", "/calendar_token", hb.New(CalendarTokenReset))
+				r.Method("DELETE", "/calendar_token", hb.New(CalendarTokenDelete))
+				r.Method("GET", "/goals", hb.New(ReadingGoalIndex))
+				r.Method("POST", "/goals", hb.New(ReadingGoalCreate))
+				r.Method("DELETE", "/goals/{id}", parseInt64URLParam("id")(hb.New(ReadingGoalDelete)))
+				r.Method("GET", "/books/shelves/{status}", hb.New(BookShelfIndex))
+				r.Method("GET", "/books/search", hb.New(BookSearch))
+				r.Method("GET", "/books/new", hb.New(BookNew))
+				r.Method("POST", "/books", hb.New(BookCreate))
+				r.Method("GET", "/books/{id}/edit", parseInt64URLParam("id")(hb.New(BookEdit)))
+				r.Method("GET", "/books/{id}/confirm_delete", parseInt64URLParam("id")(hb.New(BookConfirmDelete)))
+				r.Method("PATCH", "/books/{id}", parseInt64URLParam("id")(hb.New(BookUpdate)))
+				r.Method("DELETE", "/books/{id}", parseInt64URLParam("id")(hb.New(BookDelete)))
+				r.Method("POST", "/books/{id}/start_reading", parseInt64URLParam("id")(hb.New(BookStartReading)))
+				r.Method("POST", "/books/{id}/finish", parseInt64URLParam("id")(hb.New(BookFinish)))
+				r.Method("POST", "/books/{id}/abandon", parseInt64URLParam("id")(hb.New(BookAbandon)))
+				r.Method("GET", "/books/import_csv/form", hb.New(BookImportCSVForm))
+				r.Method("POST", "/books/import_csv", hb.New(BookImportCSV))
+				r.Method("GET", "/books/imports/{id}", parseInt64URLParam("id")(hb.New(BookImportShow)))
+				r.Method("POST", "/books/imports/{id}/commit", parseInt64URLParam("id")(hb.New(BookImportCommit)))
+				r.Method("DELETE", "/books/imports/{id}", parseInt64URLParam("id")(hb.New(BookImportDelete)))
+				r.Method("GET", "/books/imports/{id}/mapping", parseInt64URLParam("id")(hb.New(BookImportMapping)))
+				r.Method("POST", "/books/imports/{id}/mapping", parseInt64URLParam("id")(hb.New(BookImportMappingUpdate)))
+				r.Method("DELETE", "/import_profiles/{id}", parseInt64URLParam("id")(hb.New(ImportProfileDelete)))
+				r.Get("/books.csv", BookExportCSV)
+				r.Method("GET", "/backup", hb.New(AccountBackup))
+				r.Method("GET", "/export.json", hb.New(AccountExportJSON))
+				r.Method("POST", "/restore", hb.New(AccountRestore))
+				r.Method("GET", "/tags", hb.New(TagIndex))
+				r.Method("GET", "/tags/{tag}", hb.New(TagShow))
+				r.Method("GET", "/api_tokens", hb.New(APITokenIndex))
+				r.Method("POST", "/api_tokens", hb.New(APITokenCreate))
+				r.Method("DELETE", "/api_tokens/{id}", parseInt64URLParam("id")(hb.New(APITokenDelete)))
+				r.Method("GET", "/sessions", hb.New(UserSessionIndex))
+				r.Method("DELETE", "/sessions", hb.New(UserSessionDeleteAll))
+				r.Method("DELETE", "/sessions/{id}", parseInt64URLParam("id")(hb.New(UserSessionDelete)))
+			})
+		})
 	})
 
 	return appServer, nil
@@ -192,11 +290,75 @@ func devModeHandler(devMode bool) func(http.Handler) http.Handler {
 	}
 }
 
-func pgxPoolHandler(dbpool *pgxpool.Pool) func(http.Handler) http.Handler {
+// lazyPgxConnHandler puts a *lazypgxconn.Conn in the request context. When the connection is acquired booklog.user_id
+// is set to the authenticated user's ID so row-level security restricts queries to that user's rows. It is reset before
+// the connection is returned to the pool. It must run after sessionHandler.
+func lazyPgxConnHandler(dbpool *pgxpool.Pool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			session := ctx.Value(RequestSessionKey).(*Session)
+
+			conn := lazypgxconn.New(
+				func() (*pgx.Conn, any, error) {
+					poolConn, err := dbpool.Acquire(ctx)
+					if err != nil {
+						return nil, nil, err
+					}
+
+					var userID string
+					if session.IsAuthenticated {
+						userID = strconv.FormatInt(session.User.ID, 10)
+					}
+
+					_, err = poolConn.Exec(ctx, "select set_config('booklog.user_id', $1, false)", userID)
+					if err != nil {
+						poolConn.Release()
+						return nil, nil, err
+					}
+
+					return poolConn.Conn(), poolConn, nil
+				},
+				func(conn *pgx.Conn, memo any) error {
+					poolConn := memo.(*pgxpool.Conn)
+					defer poolConn.Release()
+
+					_, err := conn.Exec(ctx, "select set_config('booklog.user_id', '', false)")
+					if err != nil {
+						// The user may still be set. Closing the connection ensures the pool will not reuse it.
+						conn.Close(ctx)
+						return err
+					}
+
+					return nil
+				},
+			)
+			defer func() {
+				err := conn.Release()
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("failed to release database connection")
+				}
+			}()
+
+			ctx = context.WithValue(ctx, RequestDBKey, conn)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// mailerHandler puts mailer and baseURL in the request context. Mail containing links is not sent when baseURL is empty
+// because building them from the Host header of the request would let it be forged to make a password reset link point
+// to another site.
+func mailerHandler(mailer mail.Mailer, baseURL string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			ctx = context.WithValue(ctx, RequestDBKey, dbpool)
+			ctx = context.WithValue(ctx, RequestMailerKey, mailer)
+			if baseURL != "" {
+				ctx = context.WithValue(ctx, RequestBaseURLKey, baseURL)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 
@@ -216,7 +378,10 @@ func htmlTemplateRendererHandler(htr *view.HTMLTemplateRenderer) func(http.Handl
 	}
 }
 
-func sessionHandler(sc *securecookie.SecureCookie) func(http.Handler) http.Handler {
+// sessionHandler puts the *Session in the request context. It queries db directly because the per-request connection
+// cannot be acquired until the user is known. Expired sessions are ignored and their cookie is cleared. The last seen
+// time and address of valid sessions are recorded.
+func sessionHandler(sc *securecookie.SecureCookie, db dbconn) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -236,13 +401,10 @@ func sessionHandler(sc *securecookie.SecureCookie) func(http.Handler) http.Handl
 				return
 			}
 
-			db := ctx.Value(RequestDBKey).(dbconn)
-			err = db.QueryRow(ctx,
-				"select user_sessions.id, users.id, users.username from user_sessions join users on user_sessions.user_id=users.id where user_sessions.id=$1",
-				sessionID,
-			).Scan(&session.ID, &session.User.ID, &session.User.Username)
+			userSession, err := data.FindUserSession(ctx, db, sessionID)
 			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
+				var nfErr *data.NotFoundError
+				if errors.As(err, &nfErr) {
 					// invalid session ID
 					next.ServeHTTP(w, r.WithContext(ctx))
 					return
@@ -251,6 +413,24 @@ func sessionHandler(sc *securecookie.SecureCookie) func(http.Handler) http.Handl
 					return
 				}
 			}
+
+			now := requestNow(ctx)
+			if userSession.IsExpired(now) {
+				clearSessionCookie(w)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			err = data.TouchUserSession(ctx, db, userSession, sessionClientFromRequest(r).RemoteAddr, now)
+			if err != nil {
+				InternalServerErrorHandler(w, r, err)
+				return
+			}
+
+			session.ID = userSession.ID
+			session.PublicID = userSession.PublicID
+			session.User.ID = userSession.UserID
+			session.User.Username = userSession.Username
 			session.IsAuthenticated = true
 
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -276,12 +456,32 @@ func setSessionCookie(w http.ResponseWriter, r *http.Request, userSessionID [16]
 		Secure:   false, // TODO - true when not in insecure dev mode
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
+		Expires:  requestNow(ctx).Add(data.SessionMaxAge),
 	}
 	http.SetCookie(w, cookie)
 
 	return nil
 }
 
+// maxUserAgentLength limits how much of the User-Agent header is stored with a session.
+const maxUserAgentLength = 500
+
+// sessionClientFromRequest describes the browser that made r for recording with its session.
+func sessionClientFromRequest(r *http.Request) data.SessionClient {
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	// middleware.RealIP replaces RemoteAddr with an address without a port when the request came through a proxy.
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	return data.SessionClient{UserAgent: userAgent, RemoteAddr: remoteAddr}
+}
+
 func clearSessionCookie(w http.ResponseWriter) {
 	cookie := &http.Cookie{
 		Name:     "booklog-session-id",
@@ -300,11 +500,12 @@ func pathUserHandler() func(http.Handler) http.Handler {
 			ctx := r.Context()
 			db := ctx.Value(RequestDBKey).(dbconn)
 
-			user, err := data.GetUserMinByUsername(ctx, db, chi.URLParam(r, "username"))
+			username := chi.URLParam(r, "username")
+			user, err := data.GetUserMinByUsername(ctx, db, username)
 			if err != nil {
 				var nfErr *data.NotFoundError
 				if errors.As(err, &nfErr) {
-					NotFoundHandler(w, r)
+					redirectRenamedPathUser(w, r, username)
 				} else {
 					InternalServerErrorHandler(w, r, err)
 				}
@@ -319,6 +520,35 @@ func pathUserHandler() func(http.Handler) http.Handler {
 	}
 }
 
+// redirectRenamedPathUser redirects GET and HEAD requests for the paths of a user who was previously named username to
+// the same path with the current username. Otherwise, it responds with not found.
+func redirectRenamedPathUser(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		NotFoundHandler(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	currentUsername, err := data.FindUsernameRedirect(ctx, db, username)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+		} else {
+			InternalServerErrorHandler(w, r, err)
+		}
+		return
+	}
+
+	oldPrefix := route.UserHomePath(username)
+	u := *r.URL
+	u.Path = route.UserHomePath(currentUsername) + strings.TrimPrefix(u.Path, oldPrefix)
+	u.RawPath = ""
+	http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+}
+
 func requireSameSessionUserAndPathUserHandler() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
@@ -342,6 +572,49 @@ func requireSameSessionUserAndPathUserHandler() func(http.Handler) http.Handler
 	}
 }
 
+// requirePathUserReadAccessHandler allows the path user and, if the path user's books are visible, anyone else to read
+// the path user's pages. Handlers must check view.BaseViewArgs.ReadOnly before showing private books or owner controls.
+func requirePathUserReadAccessHandler() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			session := ctx.Value(RequestSessionKey).(*Session)
+			pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+			switch {
+			case session.IsAuthenticated && session.User.ID == pathUser.ID:
+				next.ServeHTTP(w, r)
+			case pathUser.IsVisible():
+				if pathUser.Visibility == data.UserVisibilityUnlisted {
+					w.Header().Set("X-Robots-Tag", "noindex")
+				}
+				next.ServeHTTP(w, r)
+			case session.IsAuthenticated:
+				ForbiddenHandler(w, r)
+			default:
+				http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// requestNow returns the current time according to the clock in the request context.
+func requestNow(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(RequestClockKey).(func() time.Time); ok {
+		return clock()
+	}
+	return time.Now()
+}
+
+// pathUserToday returns the current date in the time zone of the path user.
+func pathUserToday(ctx context.Context) time.Time {
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	return data.Today(requestNow(ctx), pathUser.Location())
+}
+
 type ctxURLParamKey string
 
 func parseInt64URLParam(paramName string) func(http.Handler) http.Handler {
@@ -388,5 +661,6 @@ func baseViewArgsFromRequest(r *http.Request) *view.BaseViewArgs {
 		CurrentUser: currentUser,
 		PathUser:    pathUser,
 		DevMode:     devMode,
+		ReadOnly:    pathUser != nil && (currentUser == nil || currentUser.ID != pathUser.ID),
 	}
 }
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+)
+
+func TagIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	tagCounts, err := data.GetTagCounts(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	var maxCount int32
+	for _, tc := range tagCounts {
+		maxCount = max(maxCount, tc.Count)
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "tag_index.html", map[string]any{
+		"bva":       baseViewArgsFromRequest(r),
+		"tagCounts": tagCounts,
+		"maxCount":  maxCount,
+	})
+}
+
+func TagShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	tag := chi.URLParam(r, "tag")
+
+	books, err := data.GetBooksByTag(ctx, db, pathUser.ID, tag)
+	if err != nil {
+		return err
+	}
+
+	if len(books) == 0 {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
+	// Finished books are grouped by year. Books on other shelves have no finish date and are listed separately.
+	var finishedBooks, otherBooks []*data.Book
+	for _, book := range books {
+		if book.Status == data.BookStatusFinished {
+			finishedBooks = append(finishedBooks, book)
+		} else {
+			otherBooks = append(otherBooks, book)
+		}
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "tag_show.html", map[string]any{
+		"bva":            baseViewArgsFromRequest(r),
+		"tag":            tag,
+		"otherBooks":     otherBooks,
+		"yearBooksLists": view.GroupBooksByYear(finishedBooks),
+	})
+}
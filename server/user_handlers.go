@@ -2,48 +2,331 @@ package server
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
 	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/jackc/structify"
 )
 
 func UserHome(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
 	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	bva := baseViewArgsFromRequest(r)
 
 	booksPerYear, err := data.BooksPerYear(ctx, db, pathUser.ID)
 	if err != nil {
 		return err
 	}
 
-	booksPerMonthForLastYear, err := data.BooksPerMonthForLastYear(ctx, db, pathUser.ID)
+	today := pathUserToday(ctx)
+	booksPerMonthForLastYear, err := data.BooksPerMonthForLastYear(ctx, db, pathUser.ID, today)
 	if err != nil {
 		return err
 	}
 
-	books, err := data.GetAllBooks(ctx, db, pathUser.ID)
+	// Reading goals are not shown to visitors.
+	var goalProgress []data.ReadingGoalProgress
+	if !bva.ReadOnly {
+		goals, err := data.GetReadingGoals(ctx, db, pathUser.ID, int32(today.Year()))
+		if err != nil {
+			return err
+		}
+
+		goalProgress, err = getReadingGoalProgress(ctx, db, pathUser.ID, goals, booksPerYear, today)
+		if err != nil {
+			return err
+		}
+	}
+
+	readingBooks, err := data.GetBooksByStatus(ctx, db, pathUser.ID, data.BookStatusReading)
 	if err != nil {
 		return err
 	}
 
-	yearBooksLists := make([]*view.YearBookList, 0, len(booksPerYear))
-	var ybl *view.YearBookList
+	books, err := data.GetBooksByStatus(ctx, db, pathUser.ID, data.BookStatusFinished)
+	if err != nil {
+		return err
+	}
 
-	for _, book := range books {
-		year := book.FinishDate.Year()
-		if ybl == nil || year != ybl.Year {
-			ybl = &view.YearBookList{Year: year}
-			yearBooksLists = append(yearBooksLists, ybl)
-		}
+	var following bool
+	if bva.ReadOnly {
+		readingBooks = slices.DeleteFunc(readingBooks, isPrivateBook)
+		books = slices.DeleteFunc(books, isPrivateBook)
 
-		ybl.Books = append(ybl.Books, book)
+		if bva.CurrentUser != nil {
+			following, err = data.IsFollowing(ctx, db, bva.CurrentUser.ID, pathUser.ID)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
+	yearBooksLists := view.GroupBooksByYear(books)
+
 	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "user_home.html", map[string]any{
-		"bva":                      baseViewArgsFromRequest(r),
+		"bva":                      bva,
+		"readingBooks":             readingBooks,
 		"yearBooksLists":           yearBooksLists,
 		"booksPerYear":             booksPerYear,
 		"booksPerMonthForLastYear": booksPerMonthForLastYear,
+		"goalProgress":             goalProgress,
+		"following":                following,
+	})
+}
+
+// isPrivateBook reports whether book is private. It is used with slices.DeleteFunc to hide private books from visitors.
+func isPrivateBook(book *data.Book) bool {
+	return book.Private
+}
+
+// UserStats renders reading statistics for the path user.
+func UserStats(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	today := pathUserToday(ctx)
+
+	booksPerYear, err := data.BooksPerYear(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	booksPerFormat, err := data.BooksPerFormat(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	topAuthors, err := data.TopAuthors(ctx, db, pathUser.ID, 10)
+	if err != nil {
+		return err
+	}
+
+	averagePerMonth, err := data.AverageBooksPerMonth(ctx, db, pathUser.ID, today)
+	if err != nil {
+		return err
+	}
+
+	busiestMonth, err := data.BusiestMonth(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	yearOverYear, err := data.BooksYearOverYear(ctx, db, pathUser.ID, today)
+	if err != nil {
+		return err
+	}
+
+	finishDates, err := data.GetFinishDates(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	yearChart := view.BarChart{Title: "Books per year"}
+	for _, item := range booksPerYear {
+		yearChart.Bars = append(yearChart.Bars, view.Bar{Label: item.Time.Format("2006"), Value: float64(item.Count)})
+	}
+
+	formatChart := view.BarChart{Title: "Books per format"}
+	for _, item := range booksPerFormat {
+		formatChart.Bars = append(formatChart.Bars, view.Bar{Label: item.Format, Value: float64(item.Count)})
+	}
+
+	authorChart := view.BarChart{Title: "Top authors"}
+	for _, item := range topAuthors {
+		authorChart.Bars = append(authorChart.Bars, view.Bar{Label: item.Author, Value: float64(item.Count)})
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "user_stats.html", map[string]any{
+		"bva":             baseViewArgsFromRequest(r),
+		"finishedCount":   len(finishDates),
+		"yearChart":       yearChart,
+		"formatChart":     formatChart,
+		"authorChart":     authorChart,
+		"averagePerMonth": averagePerMonth,
+		"busiestMonth":    busiestMonth,
+		"yearOverYear":    yearOverYear,
+		"today":           today,
+		"streak":          data.LongestReadingStreak(finishDates),
+		"droughts":        data.LongestReadingDroughts(finishDates, 5),
 	})
 }
+
+// UserSettings renders the preferences and account settings of the path user.
+func UserSettings(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return renderUserSettings(ctx, w, r, nil)
+}
+
+func UserSettingsUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	var form view.UserSettingsForm
+	_ = structify.Parse(params, &form)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	verr := &errortree.Node{}
+	for _, err := range []error{
+		data.SetUserTimeZone(ctx, tx, pathUser.ID, form.TimeZone),
+		data.SetUserVisibility(ctx, tx, pathUser.ID, form.Visibility),
+		data.SetUserPreferences(ctx, tx, pathUser.ID, form.Preferences()),
+	} {
+		if err != nil {
+			var settingVerr *errortree.Node
+			if !errors.As(err, &settingVerr) {
+				return err
+			}
+			for _, e := range settingVerr.AllErrors() {
+				verr.Add(e.Path, e.Err)
+			}
+		}
+	}
+	if len(verr.AllErrors()) > 0 {
+		return renderUserSettings(ctx, w, r, map[string]any{"form": form, "verr": verr})
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// UserPasswordUpdate changes the password of the path user. All other sessions of the user are logged out.
+func UserPasswordUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	args := data.ChangePasswordArgs{
+		CurrentPassword:         r.FormValue("currentPassword"),
+		NewPassword:             r.FormValue("newPassword"),
+		NewPasswordConfirmation: r.FormValue("newPasswordConfirmation"),
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = data.ChangePassword(ctx, tx, pathUser.ID, session.ID, args)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserSettings(ctx, w, r, map[string]any{"passwordVerr": verr})
+		}
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// UserUsernameUpdate changes the username of the path user. Paths with the old username redirect to the new one.
+func UserUsernameUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	err := data.ChangeUsername(ctx, db, pathUser.ID, username)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserSettings(ctx, w, r, map[string]any{"username": username, "usernameVerr": verr})
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(username), http.StatusSeeOther)
+	return nil
+}
+
+// UserEmailUpdate sets or clears the email address of the path user. The address is only used for password resets.
+func UserEmailUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	err := data.SetUserEmail(ctx, db, pathUser.ID, email)
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserSettings(ctx, w, r, map[string]any{"email": email, "emailVerr": verr})
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.UserSettingsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// renderUserSettings renders the settings page. Each form on the page is populated from the path user unless args
+// contains a submitted form.
+func renderUserSettings(ctx context.Context, w http.ResponseWriter, r *http.Request, args map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	tmplArgs := map[string]any{
+		"bva":      baseViewArgsFromRequest(r),
+		"today":    pathUserToday(ctx),
+		"username": pathUser.Username,
+	}
+
+	if _, ok := args["form"]; !ok {
+		prefs, err := data.GetUserPreferences(ctx, db, pathUser.ID)
+		if err != nil {
+			return err
+		}
+		tmplArgs["form"] = view.NewUserSettingsForm(pathUser, prefs)
+	}
+
+	if _, ok := args["email"]; !ok {
+		email, err := data.GetUserEmail(ctx, db, pathUser.ID)
+		if err != nil {
+			return err
+		}
+		tmplArgs["email"] = email
+	}
+
+	totpStatus, err := data.GetUserTOTPStatus(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+	tmplArgs["totpStatus"] = totpStatus
+
+	calendarURL := requestBaseURL(r) + route.BooksCalendarPath(pathUser.Username)
+	tmplArgs["calendarURL"] = calendarURL
+	calendarToken, err := data.GetCalendarToken(ctx, db, pathUser.ID)
+	if err == nil {
+		tmplArgs["calendarTokenURL"] = calendarURL + "?token=" + url.QueryEscape(calendarToken)
+	} else {
+		var nfErr *data.NotFoundError
+		if !errors.As(err, &nfErr) {
+			return err
+		}
+	}
+
+	for k, v := range args {
+		tmplArgs[k] = v
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "user_settings.html", tmplArgs)
+}
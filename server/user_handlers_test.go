@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePathUserReadAccessHandler(t *testing.T) {
+	t.Parallel()
+
+	anonymous := &Session{}
+	other := &Session{User: data.UserMin{ID: 2, Username: "other"}, IsAuthenticated: true}
+	owner := &Session{User: data.UserMin{ID: 1, Username: "test"}, IsAuthenticated: true}
+
+	for _, tt := range []struct {
+		visibility string
+		session    *Session
+		expected   int
+		noindex    bool
+	}{
+		{data.UserVisibilityPrivate, anonymous, http.StatusSeeOther, false},
+		{data.UserVisibilityPrivate, other, http.StatusForbidden, false},
+		{data.UserVisibilityPrivate, owner, http.StatusOK, false},
+		{data.UserVisibilityUnlisted, anonymous, http.StatusOK, true},
+		{data.UserVisibilityUnlisted, other, http.StatusOK, true},
+		{data.UserVisibilityUnlisted, owner, http.StatusOK, false},
+		{data.UserVisibilityPublic, anonymous, http.StatusOK, false},
+		{data.UserVisibilityPublic, other, http.StatusOK, false},
+		{data.UserVisibilityPublic, owner, http.StatusOK, false},
+	} {
+		t.Run(tt.visibility+" "+tt.session.User.Username, func(t *testing.T) {
+			pathUser := &data.UserMin{ID: 1, Username: "test", Visibility: tt.visibility}
+
+			r := chi.NewRouter()
+			r.With(requirePathUserReadAccessHandler()).Get("/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/test", nil)
+			ctx := context.WithValue(req.Context(), RequestSessionKey, tt.session)
+			ctx = context.WithValue(ctx, RequestPathUserKey, pathUser)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req.WithContext(ctx))
+
+			require.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusOK {
+				require.Equal(t, "ok", w.Body.String())
+			}
+			if tt.noindex {
+				require.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"))
+			} else {
+				require.Empty(t, w.Header().Get("X-Robots-Tag"))
+			}
+		})
+	}
+}
+
+func TestVisitorsCannotSeePrivateBooksOrOwnerControls(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	owner := &data.UserMin{Username: "test", TimeZone: "UTC", Visibility: data.UserVisibilityPublic}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest, visibility) values($1, 'x', $2) returning id", owner.Username, owner.Visibility).Scan(&owner.ID)
+	require.NoError(t, err)
+
+	other := data.UserMin{Username: "other"}
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values($1, 'x') returning id", other.Username).Scan(&other.ID)
+	require.NoError(t, err)
+
+	var publicBookID, privateBookID int64
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, status, finish_date, format) values($1, 'Paradise Lost', 'John Milton', 'finished', '2019-01-01', 'text') returning id",
+		owner.ID,
+	).Scan(&publicBookID)
+	require.NoError(t, err)
+	err = tx.QueryRow(ctx,
+		"insert into books(user_id, title, author, status, finish_date, format, private) values($1, 'Secret Diary', 'Anonymous', 'finished', '2019-02-01', 'text', true) returning id",
+		owner.ID,
+	).Scan(&privateBookID)
+	require.NoError(t, err)
+
+	// Act as the application role so row-level security applies.
+	testutil.SetAppRole(t, ctx, tx)
+
+	type handlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error
+
+	serve := func(t *testing.T, session *Session, handler handlerFunc, bookID int64) *httptest.ResponseRecorder {
+		var userID string
+		if session.IsAuthenticated {
+			userID = strconv.FormatInt(session.User.ID, 10)
+		}
+		_, err := tx.Exec(ctx, "select set_config('booklog.user_id', $1, true)", userID)
+		require.NoError(t, err)
+
+		rctx := context.WithValue(ctx, RequestDBKey, tx)
+		rctx = context.WithValue(rctx, RequestSessionKey, session)
+		rctx = context.WithValue(rctx, RequestPathUserKey, owner)
+		rctx = context.WithValue(rctx, RequestHTMLTemplateRendererKey, view.NewHTMLTemplateRenderer("../html", nil, false))
+		rctx = context.WithValue(rctx, ctxURLParamKey("id"), bookID)
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(rctx)
+		w := httptest.NewRecorder()
+
+		err = handler(rctx, w, r, map[string]any{})
+		require.NoError(t, err)
+		return w
+	}
+
+	for _, visitor := range []struct {
+		name    string
+		session *Session
+	}{
+		{"anonymous", &Session{}},
+		{"other user", &Session{User: other, IsAuthenticated: true}},
+	} {
+		t.Run(visitor.name, func(t *testing.T) {
+			for _, tt := range []struct {
+				name    string
+				handler handlerFunc
+			}{
+				{"UserHome", UserHome},
+				{"BookIndex", BookIndex},
+			} {
+				w := serve(t, visitor.session, tt.handler, 0)
+				require.Equal(t, http.StatusOK, w.Code, tt.name)
+				require.Contains(t, w.Body.String(), "Paradise Lost", tt.name)
+				require.NotContains(t, w.Body.String(), "Secret Diary", tt.name)
+				require.NotContains(t, w.Body.String(), "New Book", tt.name)
+			}
+
+			w := serve(t, visitor.session, BookShow, publicBookID)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Contains(t, w.Body.String(), "Paradise Lost")
+			require.NotContains(t, w.Body.String(), "Edit")
+			require.NotContains(t, w.Body.String(), "Delete")
+
+			w = serve(t, visitor.session, BookShow, privateBookID)
+			require.Equal(t, http.StatusNotFound, w.Code)
+			require.NotContains(t, w.Body.String(), "Secret Diary")
+		})
+	}
+
+	t.Run("owner", func(t *testing.T) {
+		session := &Session{User: *owner, IsAuthenticated: true}
+
+		w := serve(t, session, UserHome, 0)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "Secret Diary")
+		require.Contains(t, w.Body.String(), "New Book")
+
+		w = serve(t, session, BookShow, privateBookID)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "Secret Diary")
+		require.Contains(t, w.Body.String(), "Edit")
+	})
+}
+
+func TestPathUserHandlerRedirectsRenamedUsers(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "insert into users(username, password_digest) values('old', 'x') returning id").Scan(&userID)
+	require.NoError(t, err)
+	require.NoError(t, data.ChangeUsername(ctx, tx, userID, "new"))
+
+	// Act as the application role with no user authenticated like a visitor following an old link.
+	testutil.SetAppRole(t, ctx, tx)
+	_, err = tx.Exec(ctx, "select set_config('booklog.user_id', '', true)")
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Route("/users/{username}", func(r chi.Router) {
+		r.Use(pathUserHandler())
+		r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Context().Value(RequestPathUserKey).(*data.UserMin).Username))
+		})
+	})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rctx := context.WithValue(ctx, RequestDBKey, tx)
+		r := httptest.NewRequest(method, path, nil).WithContext(rctx)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/users/new/books")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "new", w.Body.String())
+
+	w = serve(http.MethodGet, "/users/old/books?sort=title")
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	require.Equal(t, "/users/new/books?sort=title", w.Header().Get("Location"))
+
+	w = serve(http.MethodPost, "/users/old/books")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(http.MethodGet, "/users/missing/books")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/jackc/booklog/data"
 	"github.com/jackc/booklog/route"
@@ -25,10 +26,26 @@ func UserLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, para
 	la := data.UserLoginArgs{
 		Username: r.FormValue("username"),
 		Password: r.FormValue("password"),
+		Client:   sessionClientFromRequest(r),
 	}
 
 	userSessionID, err := data.UserLogin(ctx, db, la)
 	if err != nil {
+		var totpErr *data.TOTPRequiredError
+		if errors.As(err, &totpErr) {
+			err = setLoginChallengeCookie(w, r, &loginChallenge{
+				UserID:     totpErr.UserID,
+				Username:   totpErr.Username,
+				ExpireTime: requestNow(ctx).Add(loginChallengeLifetime),
+			})
+			if err != nil {
+				return err
+			}
+
+			http.Redirect(w, r, route.LoginTwoFactorPath(), http.StatusSeeOther)
+			return nil
+		}
+
 		var verr *errortree.Node
 		if errors.As(err, &verr) {
 			return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "login.html", map[string]any{
@@ -50,6 +67,53 @@ func UserLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, para
 	return nil
 }
 
+// UserLoginTwoFactorForm asks for the two-factor authentication code of the user whose password was accepted by
+// UserLogin.
+func UserLoginTwoFactorForm(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	if getLoginChallenge(r) == nil {
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "login_two_factor.html", map[string]any{
+		"bva": baseViewArgsFromRequest(r),
+	})
+}
+
+// UserLoginTwoFactor completes the login with a code from the user's authenticator or a recovery code. The session
+// cookie is only set once the code is accepted.
+func UserLoginTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	challenge := getLoginChallenge(r)
+	if challenge == nil {
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	userSessionID, err := data.UserLoginTOTP(ctx, db, challenge.UserID, r.FormValue("code"), sessionClientFromRequest(r), requestNow(ctx))
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "login_two_factor.html", map[string]any{
+				"bva":  baseViewArgsFromRequest(r),
+				"verr": verr,
+			})
+		}
+
+		return err
+	}
+
+	clearLoginChallengeCookie(w)
+	err = setSessionCookie(w, r, userSessionID)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.UserHomePath(challenge.Username), http.StatusSeeOther)
+	return nil
+}
+
 func UserLogout(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
 	db := ctx.Value(RequestDBKey).(dbconn)
 	session := ctx.Value(RequestSessionKey).(*Session)
@@ -66,3 +130,71 @@ func UserLogout(ctx context.Context, w http.ResponseWriter, r *http.Request, par
 	http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
 	return nil
 }
+
+// loginChallengeLifetime is how long a user has to enter their two-factor authentication code after entering their
+// password.
+const loginChallengeLifetime = 5 * time.Minute
+
+// loginChallenge is kept in a signed and encrypted cookie between the password and two-factor authentication steps of
+// logging in. It is not a session. sessionHandler never reads it so it grants no access to anything but the second step.
+type loginChallenge struct {
+	UserID     int64
+	Username   string
+	ExpireTime time.Time
+}
+
+func setLoginChallengeCookie(w http.ResponseWriter, r *http.Request, challenge *loginChallenge) error {
+	session := r.Context().Value(RequestSessionKey).(*Session)
+
+	encoded, err := session.sc.Encode("booklog-login-challenge", challenge)
+	if err != nil {
+		return err
+	}
+
+	cookie := &http.Cookie{
+		Name:     "booklog-login-challenge",
+		Value:    encoded,
+		Path:     "/login",
+		Secure:   false, // TODO - true when not in insecure dev mode
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  challenge.ExpireTime,
+	}
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+// getLoginChallenge returns the login challenge of r or nil if there is none or it has expired.
+func getLoginChallenge(r *http.Request) *loginChallenge {
+	session := r.Context().Value(RequestSessionKey).(*Session)
+
+	cookie, err := r.Cookie("booklog-login-challenge")
+	if err != nil {
+		return nil
+	}
+
+	var challenge loginChallenge
+	err = session.sc.Decode("booklog-login-challenge", cookie.Value, &challenge)
+	if err != nil {
+		return nil
+	}
+
+	if !requestNow(r.Context()).Before(challenge.ExpireTime) {
+		return nil
+	}
+
+	return &challenge
+}
+
+func clearLoginChallengeCookie(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     "booklog-login-challenge",
+		Value:    "",
+		Path:     "/login",
+		Secure:   false, // TODO - true when not in insecure dev mode
+		HttpOnly: true,
+		Expires:  time.Unix(0, 0),
+	}
+	http.SetCookie(w, cookie)
+}
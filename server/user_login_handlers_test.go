@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/securecookie"
+	"github.com/jackc/booklog/bee"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserLoginWithTwoFactorAuthentication(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+	var userID int64
+	err = tx.QueryRow(ctx, "select id from users where username='test'").Scan(&userID)
+	require.NoError(t, err)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+	_, err = data.EnableUserTOTP(ctx, tx, userID, totp.EncodeSecret(secret), totp.Code(secret, now), now)
+	require.NoError(t, err)
+
+	// Act as the application role with no user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+
+	sc := securecookie.New(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32))
+	hb := &bee.HandlerBuilder{}
+	router := chi.NewRouter()
+	router.Method("POST", "/login/handle", hb.New(UserLogin))
+	router.Method("GET", "/login/two_factor", hb.New(UserLoginTwoFactorForm))
+	router.Method("POST", "/login/two_factor", hb.New(UserLoginTwoFactor))
+
+	serve := func(method, path string, form url.Values, cookies []*http.Cookie, at time.Time) *httptest.ResponseRecorder {
+		rctx := context.WithValue(ctx, RequestDBKey, tx)
+		rctx = context.WithValue(rctx, RequestSessionKey, &Session{sc: sc})
+		rctx = context.WithValue(rctx, RequestHTMLTemplateRendererKey, view.NewHTMLTemplateRenderer("../html", nil, false))
+		rctx = context.WithValue(rctx, RequestClockKey, func() time.Time { return at })
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode())).WithContext(rctx)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	findCookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+
+	later := now.Add(totp.Period)
+
+	// The correct password only leads to the second step. No session is issued.
+	w := serve("POST", "/login/handle", url.Values{"username": {"test"}, "password": {"password"}}, nil, later)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/login/two_factor", w.Header().Get("Location"))
+	require.Nil(t, findCookie(w, "booklog-session-id"))
+	challengeCookie := findCookie(w, "booklog-login-challenge")
+	require.NotNil(t, challengeCookie)
+
+	// The login challenge cannot be used as a session.
+	var sessionID [16]byte
+	require.Error(t, sc.Decode("booklog-session-id", challengeCookie.Value, &sessionID))
+
+	w = serve("GET", "/login/two_factor", nil, nil, later)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/login", w.Header().Get("Location"))
+
+	w = serve("GET", "/login/two_factor", nil, []*http.Cookie{challengeCookie}, later)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("POST", "/login/two_factor", url.Values{"code": {"000000"}}, []*http.Cookie{challengeCookie}, later)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "is incorrect")
+	require.Nil(t, findCookie(w, "booklog-session-id"))
+
+	// The challenge expires.
+	expired := later.Add(loginChallengeLifetime)
+	w = serve("POST", "/login/two_factor", url.Values{"code": {totp.Code(secret, expired)}}, []*http.Cookie{challengeCookie}, expired)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/login", w.Header().Get("Location"))
+	require.Nil(t, findCookie(w, "booklog-session-id"))
+
+	w = serve("POST", "/login/two_factor", url.Values{"code": {totp.Code(secret, later)}}, []*http.Cookie{challengeCookie}, later)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/users/test", w.Header().Get("Location"))
+	sessionCookie := findCookie(w, "booklog-session-id")
+	require.NotNil(t, sessionCookie)
+	require.NoError(t, sc.Decode("booklog-session-id", sessionCookie.Value, &sessionID))
+	require.Equal(t, "", findCookie(w, "booklog-login-challenge").Value)
+}
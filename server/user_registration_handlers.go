@@ -25,6 +25,7 @@ func UserRegistrationCreate(ctx context.Context, w http.ResponseWriter, r *http.
 	rua := data.RegisterUserArgs{
 		Username: r.FormValue("username"),
 		Password: r.FormValue("password"),
+		Client:   sessionClientFromRequest(r),
 	}
 
 	userSessionID, err := data.RegisterUser(ctx, db, rua)
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+)
+
+// UserSessionIndex lists the sessions of the path user that have not expired.
+func UserSessionIndex(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	sessions, err := data.GetUserSessions(ctx, db, pathUser.ID, requestNow(ctx))
+	if err != nil {
+		return err
+	}
+
+	loc := pathUser.Location()
+	for _, s := range sessions {
+		s.LoginTime = s.LoginTime.In(loc)
+		s.LastSeenTime = s.LastSeenTime.In(loc)
+	}
+
+	tmplArgs := map[string]any{
+		"bva":                    baseViewArgsFromRequest(r),
+		"sessions":               sessions,
+		"currentSessionPublicID": session.PublicID,
+		"sessionIdleTimeoutDays": int(data.SessionIdleTimeout.Hours() / 24),
+		"sessionMaxAgeDays":      int(data.SessionMaxAge.Hours() / 24),
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "user_session_index.html", tmplArgs)
+}
+
+// UserSessionDelete logs out one session of the path user. Logging out the current session is the same as logging out.
+func UserSessionDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	session := ctx.Value(RequestSessionKey).(*Session)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+	publicID := int64URLParam(r, "id")
+
+	err := data.DeleteUserSession(ctx, db, pathUser.ID, publicID)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	if publicID == session.PublicID {
+		clearSessionCookie(w)
+		http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+		return nil
+	}
+
+	http.Redirect(w, r, route.UserSessionsPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// UserSessionDeleteAll logs out every session of the path user including the current one.
+func UserSessionDeleteAll(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	err := data.DeleteAllUserSessions(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	clearSessionCookie(w)
+	http.Redirect(w, r, route.NewLoginPath(), http.StatusSeeOther)
+	return nil
+}
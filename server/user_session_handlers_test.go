@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHandlerExpiresSessions(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("BOOKLOG_TEST_DB_CONN_STRING"))
+	require.NoError(t, err)
+	defer closeConn(t, conn)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	sessionID, err := data.RegisterUser(ctx, tx, data.RegisterUserArgs{Username: "test", Password: "password"})
+	require.NoError(t, err)
+
+	loginTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err = tx.Exec(ctx, "update user_sessions set login_time=$1, last_seen_time=$1", loginTime)
+	require.NoError(t, err)
+
+	// Act as the application role with no user authenticated.
+	testutil.SetAppRole(t, ctx, tx)
+
+	sc := securecookie.New(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32))
+	encoded, err := sc.Encode("booklog-session-id", sessionID)
+	require.NoError(t, err)
+
+	var session *Session
+	handler := sessionHandler(sc, tx)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session = r.Context().Value(RequestSessionKey).(*Session)
+	}))
+
+	serve := func(at time.Time) *httptest.ResponseRecorder {
+		rctx := context.WithValue(ctx, RequestClockKey, func() time.Time { return at })
+		r := httptest.NewRequest("GET", "/", nil).WithContext(rctx)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.AddCookie(&http.Cookie{Name: "booklog-session-id", Value: encoded})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Each use pushes back the idle timeout.
+	lastSeenTime := loginTime.Add(data.SessionIdleTimeout - time.Hour)
+	serve(lastSeenTime)
+	require.True(t, session.IsAuthenticated)
+	require.Equal(t, "test", session.User.Username)
+
+	userSession, err := data.FindUserSession(ctx, tx, sessionID)
+	require.NoError(t, err)
+	require.True(t, lastSeenTime.Equal(userSession.LastSeenTime))
+	require.Equal(t, "192.0.2.1", userSession.RemoteAddr)
+
+	lastSeenTime = loginTime.Add(data.SessionIdleTimeout)
+	serve(lastSeenTime)
+	require.True(t, session.IsAuthenticated)
+
+	w := serve(lastSeenTime.Add(data.SessionIdleTimeout))
+	require.False(t, session.IsAuthenticated)
+	require.Len(t, w.Result().Cookies(), 1)
+	require.Equal(t, "", w.Result().Cookies()[0].Value)
+}
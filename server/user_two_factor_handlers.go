@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/totp"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+)
+
+// totpIssuer names the site in authenticator applications.
+const totpIssuer = "Booklog"
+
+// UserTwoFactorShow renders the two-factor authentication status of the path user. If it is not enabled a new secret key
+// is generated for the user to add to their authenticator.
+func UserTwoFactorShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	return renderUserTwoFactor(ctx, w, r, map[string]any{})
+}
+
+// UserTwoFactorEnable enables two-factor authentication once the user proves their authenticator works by entering a
+// code. The recovery codes are rendered directly instead of redirecting so they are never stored anywhere.
+func UserTwoFactorEnable(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	secret := r.FormValue("secret")
+	recoveryCodes, err := data.EnableUserTOTP(ctx, db, pathUser.ID, secret, r.FormValue("code"), requestNow(ctx))
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserTwoFactor(ctx, w, r, map[string]any{"secret": secret, "enableVerr": verr})
+		}
+		return err
+	}
+
+	return renderUserTwoFactor(ctx, w, r, map[string]any{"recoveryCodes": recoveryCodes})
+}
+
+func UserTwoFactorDisable(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	err := data.DisableUserTOTP(ctx, db, pathUser.ID, r.FormValue("password"))
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserTwoFactor(ctx, w, r, map[string]any{"disableVerr": verr})
+		}
+		return err
+	}
+
+	http.Redirect(w, r, route.UserTwoFactorPath(pathUser.Username), http.StatusSeeOther)
+	return nil
+}
+
+// UserRecoveryCodesRegenerate replaces the recovery codes of the path user. The old codes stop working.
+func UserRecoveryCodesRegenerate(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	recoveryCodes, err := data.RegenerateRecoveryCodes(ctx, db, pathUser.ID, r.FormValue("password"))
+	if err != nil {
+		var verr *errortree.Node
+		if errors.As(err, &verr) {
+			return renderUserTwoFactor(ctx, w, r, map[string]any{"recoveryCodesVerr": verr})
+		}
+		return err
+	}
+
+	return renderUserTwoFactor(ctx, w, r, map[string]any{"recoveryCodes": recoveryCodes})
+}
+
+// renderUserTwoFactor renders the two-factor authentication page. When two-factor authentication is not enabled args may
+// contain the secret key that was already shown to the user. Otherwise, a new one is generated.
+func renderUserTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request, args map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	status, err := data.GetUserTOTPStatus(ctx, db, pathUser.ID)
+	if err != nil {
+		return err
+	}
+
+	if !status.Enabled {
+		secret, _ := args["secret"].(string)
+		secretKey, err := totp.DecodeSecret(secret)
+		if err != nil || len(secretKey) == 0 {
+			secretKey, err = totp.NewSecret()
+			if err != nil {
+				return err
+			}
+		}
+		args["secret"] = totp.EncodeSecret(secretKey)
+		args["provisioningURI"] = view.OTPAuthURL(totp.URI(totpIssuer, pathUser.Username, secretKey))
+	}
+
+	// The page may contain a secret key or recovery codes.
+	w.Header().Set("Cache-Control", "no-store")
+
+	args["bva"] = baseViewArgsFromRequest(r)
+	args["status"] = status
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "user_two_factor.html", args)
+}
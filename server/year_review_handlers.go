@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+	"github.com/jackc/booklog/view"
+)
+
+// YearReviewShow renders the year in review of the path user for the year in the path.
+func YearReviewShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	year, ok := yearURLParam(r)
+	if !ok {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
+	share, err := data.GetYearReviewShare(ctx, db, pathUser.ID, year)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if !errors.As(err, &nfErr) {
+			return err
+		}
+	}
+
+	return renderYearReview(ctx, w, r, pathUser, year, share, false)
+}
+
+// YearReviewShare makes the year in review readable by anyone with its link.
+func YearReviewShare(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	year, ok := yearURLParam(r)
+	if !ok {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
+	_, err := data.ShareYearReview(ctx, db, pathUser.ID, year)
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, route.YearReviewPath(pathUser.Username, int(year)), http.StatusSeeOther)
+	return nil
+}
+
+func YearReviewUnshare(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+	pathUser := ctx.Value(RequestPathUserKey).(*data.UserMin)
+
+	year, ok := yearURLParam(r)
+	if !ok {
+		NotFoundHandler(w, r)
+		return nil
+	}
+
+	err := data.UnshareYearReview(ctx, db, pathUser.ID, year)
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, route.YearReviewPath(pathUser.Username, int(year)), http.StatusSeeOther)
+	return nil
+}
+
+// SharedYearReviewShow renders a shared year in review. It does not require authentication.
+func SharedYearReviewShow(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]any) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	owner, year, err := data.FindYearReviewShare(ctx, db, chi.URLParam(r, "token"))
+	if err != nil {
+		var nfErr *data.NotFoundError
+		if errors.As(err, &nfErr) {
+			NotFoundHandler(w, r)
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	return renderYearReview(ctx, w, r, owner, year, nil, true)
+}
+
+// renderYearReview renders the year in review of owner. When shared is true the page is rendered for visitors: books
+// are not linked, private books are excluded, and the owner's controls are omitted.
+func renderYearReview(ctx context.Context, w http.ResponseWriter, r *http.Request, owner *data.UserMin, year int32, share *data.YearReviewShare, shared bool) error {
+	db := ctx.Value(RequestDBKey).(dbconn)
+
+	review, err := data.GetYearReview(ctx, db, owner.ID, year, !shared)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Value(RequestHTMLTemplateRendererKey).(*view.HTMLTemplateRenderer).ExecuteTemplate(w, "year_review_show.html", map[string]any{
+		"bva":             baseViewArgsFromRequest(r),
+		"owner":           owner,
+		"year":            int(year),
+		"prevYear":        int(year) - 1,
+		"nextYear":        int(year) + 1,
+		"review":          review,
+		"monthBooksLists": view.GroupBooksByMonth(review.Books),
+		"share":           share,
+		"shared":          shared,
+	})
+}
+
+// yearURLParam returns the year in the path. It returns false if the year is out of the range of dates booklog
+// supports.
+func yearURLParam(r *http.Request) (int32, bool) {
+	year := int64URLParam(r, "year")
+	if year < 1 || year > 9999 {
+		return 0, false
+	}
+	return int32(year), true
+}
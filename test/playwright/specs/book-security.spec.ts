@@ -32,3 +32,68 @@ test("other user sees forbidden", async ({ page, serverURL, db }) => {
   await page.goto(`${serverURL}/users/test/books`);
   await expect(page.locator("body")).toContainText("Forbidden");
 });
+
+test("user cannot access another user's book under their own username", async ({ page, serverURL, db }) => {
+  const owner = await createUser(db, { username: "test", password: "secret phrase" });
+  const book = await createBook(db, {
+    user_id: owner.id,
+    title: "Foo",
+    author: "Bar",
+    finish_date: "2019-01-01",
+    format: "text",
+  });
+
+  await createUser(db, { username: "other", password: "secret phrase" });
+  await login(page, serverURL, "other", "secret phrase");
+
+  for (const path of [`/books/${book.id}`, `/books/${book.id}/edit`, `/books/${book.id}/confirm_delete`]) {
+    const response = await page.goto(`${serverURL}/users/other${path}`);
+    expect(response?.status()).toBe(404);
+    await expect(page.locator("body")).not.toContainText("Foo");
+  }
+});
+
+test("user cannot update or delete another user's book under their own username", async ({ page, serverURL, db }) => {
+  const owner = await createUser(db, { username: "test", password: "secret phrase" });
+  const book = await createBook(db, {
+    user_id: owner.id,
+    title: "Foo",
+    author: "Bar",
+    finish_date: "2019-01-01",
+    format: "text",
+  });
+
+  const other = await createUser(db, { username: "other", password: "secret phrase" });
+  const otherBook = await createBook(db, {
+    user_id: other.id,
+    title: "Mine",
+    author: "Me",
+    finish_date: "2019-01-01",
+    format: "text",
+  });
+
+  await login(page, serverURL, "other", "secret phrase");
+
+  // Submit the user's own edit form with the action pointed at the foreign book.
+  await page.goto(`${serverURL}/users/other/books/${otherBook.id}/edit`);
+  await page.locator("form").last().evaluate((form, action) => form.setAttribute("action", action), `/users/other/books/${book.id}`);
+  await page.getByLabel("Title").fill("Hijacked");
+  const updateResponse = await Promise.all([
+    page.waitForResponse((r) => r.request().method() === "POST"),
+    page.getByRole("button", { name: "Save" }).click(),
+  ]);
+  expect(updateResponse[0].status()).toBe(404);
+
+  // Submit the user's own delete form with the action pointed at the foreign book.
+  await page.goto(`${serverURL}/users/other/books/${otherBook.id}/confirm_delete`);
+  await page.locator("form").last().evaluate((form, action) => form.setAttribute("action", action), `/users/other/books/${book.id}`);
+  const deleteResponse = await Promise.all([
+    page.waitForResponse((r) => r.request().method() === "POST"),
+    page.getByRole("button", { name: "Delete" }).click(),
+  ]);
+  expect(deleteResponse[0].status()).toBe(404);
+
+  const result = await db.query("SELECT title FROM books WHERE id = $1", [book.id]);
+  expect(result.rows).toHaveLength(1);
+  expect(result.rows[0].title).toBe("Foo");
+});
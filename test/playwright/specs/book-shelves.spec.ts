@@ -0,0 +1,35 @@
+import { test, expect } from "../helpers/fixtures";
+import { createUser, createBook } from "../helpers/factories";
+import { login } from "../helpers/login";
+
+test("book moves through shelves", async ({ page, serverURL, db }) => {
+  const user = await createUser(db, { username: "john", password: "mysecret" });
+  const book = await createBook(db, {
+    user_id: user.id,
+    title: "Paradise Lost",
+    author: "John Milton",
+    status: "want_to_read",
+    format: "text",
+  });
+  await login(page, serverURL, "john", "mysecret");
+
+  await page.goto(`${serverURL}/users/john/books/shelves/want_to_read`);
+  await expect(page.getByRole("link", { name: "Paradise Lost" })).toBeVisible();
+
+  await page.getByRole("button", { name: "Start Reading" }).click();
+  await expect(page.locator("dl")).toContainText("Currently Reading");
+
+  await page.goto(`${serverURL}/users/john/books/shelves/reading`);
+  await expect(page.getByRole("link", { name: "Paradise Lost" })).toBeVisible();
+
+  await page.getByRole("button", { name: "Mark Finished" }).click();
+  await expect(page.locator("dl")).toContainText("Finished");
+
+  const result = await db.query("SELECT status, start_date, finish_date FROM books WHERE id = $1", [book.id]);
+  expect(result.rows[0].status).toBe("finished");
+  expect(result.rows[0].start_date).not.toBeNull();
+  expect(result.rows[0].finish_date).not.toBeNull();
+
+  await page.goto(`${serverURL}/users/john/books`);
+  await expect(page.getByRole("link", { name: "Paradise Lost" })).toBeVisible();
+});
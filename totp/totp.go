@@ -0,0 +1,123 @@
+// Package totp implements time-based one-time passwords as described in RFC 6238.
+//
+// Codes are the 6 digit, 30 second, HMAC-SHA1 variant that all common authenticator applications support.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits in a code.
+	Digits = 6
+
+	// Period is how long each code is valid.
+	Period = 30 * time.Second
+
+	// Skew is the number of periods before and after the current one whose codes are also accepted. It allows for clock
+	// drift and for the time it takes the user to type the code.
+	Skew = 1
+
+	secretSize = 20
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a new random secret key.
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns secret in the unpadded base32 form that users type into authenticator applications.
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// DecodeSecret is the inverse of EncodeSecret. It ignores case and spaces.
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	return secretEncoding.DecodeString(s)
+}
+
+// URI returns the otpauth:// provisioning URI for secret. Authenticator applications add the account by scanning it as a
+// QR code or by opening it as a link.
+func URI(issuer, accountName string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Step returns the time step that t is in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for secret at t.
+func Code(secret []byte, t time.Time) string {
+	return hotp(secret, Step(t), Digits)
+}
+
+// Validate checks code against the codes for secret near t. It returns the time step of the matching code so the caller
+// can reject it if it is used again. Codes for steps at or before lastStep are never accepted.
+func Validate(secret []byte, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(code), []byte(hotp(secret, step, Digits))) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp implements HOTP from RFC 4226 with step as the counter.
+func hotp(secret []byte, step int64, digits int) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHOTPRFC6238TestVectors(t *testing.T) {
+	t.Parallel()
+
+	// SHA1 test vectors from RFC 6238 Appendix B.
+	secret := []byte("12345678901234567890")
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		require.Equalf(t, tt.code, hotp(secret, Step(time.Unix(tt.unix, 0)), 8), "%d", tt.unix)
+	}
+
+	require.Equal(t, "287082", Code(secret, time.Unix(59, 0)))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	step, ok := Validate(secret, Code(secret, now), now, 0)
+	require.True(t, ok)
+	require.Equal(t, current, step)
+
+	step, ok = Validate(secret, Code(secret, now.Add(-Period)), now, 0)
+	require.True(t, ok)
+	require.Equal(t, current-1, step)
+
+	_, ok = Validate(secret, Code(secret, now.Add(-2*Period)), now, 0)
+	require.False(t, ok)
+
+	// A code cannot be used twice.
+	_, ok = Validate(secret, Code(secret, now), now, current)
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	require.False(t, ok)
+}
+
+func TestSecretEncoding(t *testing.T) {
+	t.Parallel()
+
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 20)
+
+	decoded, err := DecodeSecret(EncodeSecret(secret))
+	require.NoError(t, err)
+	require.Equal(t, secret, decoded)
+
+	decoded, err = DecodeSecret("gezd gnbv gy3t qojq")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1234567890"), decoded)
+}
+
+func TestURI(t *testing.T) {
+	t.Parallel()
+
+	uri := URI("Booklog", "jack", []byte("12345678901234567890"))
+	require.Equal(t, "otpauth://totp/Booklog:jack?algorithm=SHA1&digits=6&issuer=Booklog&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri)
+}
@@ -50,6 +50,21 @@ func (v *Validator) MinLength(attr string, value string, minLength int) {
 	}
 }
 
+type MaxLengthError struct {
+	attr      string
+	maxLength int
+}
+
+func (e MaxLengthError) Error() string {
+	return fmt.Sprintf("%s must have a maximum length of %d", e.attr, e.maxLength)
+}
+
+func (v *Validator) MaxLength(attr string, value string, maxLength int) {
+	if len(value) > maxLength {
+		v.e.Add([]any{attr}, MaxLengthError{attr: attr, maxLength: maxLength})
+	}
+}
+
 func (v *Validator) Err() error {
 	if len(v.e.AllErrors()) == 0 {
 		return nil
@@ -0,0 +1,209 @@
+package view
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/validate"
+	"github.com/jackc/errortree"
+)
+
+// BookJSON is the JSON API representation of a book.
+type BookJSON struct {
+	ID         int64     `json:"id,string"`
+	Title      string    `json:"title"`
+	Author     string    `json:"author"`
+	Status     string    `json:"status"`
+	StartDate  *string   `json:"startDate"`
+	FinishDate *string   `json:"finishDate"`
+	Format     string    `json:"format"`
+	Location   string    `json:"location"`
+	Rating     *float64  `json:"rating"`
+	Review     string    `json:"review"`
+	Tags       []string  `json:"tags"`
+	ISBN       *string   `json:"isbn"`
+	PageCount  *int32    `json:"pageCount"`
+	Private    bool      `json:"private"`
+	InsertTime time.Time `json:"insertTime"`
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+func NewBookJSON(book *data.Book) *BookJSON {
+	bj := &BookJSON{
+		ID:         book.ID,
+		Title:      book.Title,
+		Author:     book.Author,
+		Status:     book.Status,
+		Format:     book.Format,
+		Location:   book.Location,
+		Review:     book.Review,
+		Tags:       book.Tags,
+		Private:    book.Private,
+		InsertTime: book.InsertTime,
+		UpdateTime: book.UpdateTime,
+	}
+	if bj.Tags == nil {
+		bj.Tags = []string{}
+	}
+	if !book.StartDate.IsZero() {
+		s := FormatDate(book.StartDate)
+		bj.StartDate = &s
+	}
+	if !book.FinishDate.IsZero() {
+		s := FormatDate(book.FinishDate)
+		bj.FinishDate = &s
+	}
+	if book.Rating != 0 {
+		bj.Rating = &book.Rating
+	}
+	if book.ISBN != "" {
+		bj.ISBN = &book.ISBN
+	}
+	if book.PageCount != 0 {
+		bj.PageCount = &book.PageCount
+	}
+
+	return bj
+}
+
+// BookJSONInput is the JSON API input for creating or updating a book. Omitted fields are left unchanged.
+type BookJSONInput struct {
+	Title      *string   `json:"title"`
+	Author     *string   `json:"author"`
+	Status     *string   `json:"status"`
+	StartDate  *string   `json:"startDate"`
+	FinishDate *string   `json:"finishDate"`
+	Format     *string   `json:"format"`
+	Location   *string   `json:"location"`
+	Rating     *float64  `json:"rating"`
+	Review     *string   `json:"review"`
+	Tags       *[]string `json:"tags"`
+	ISBN       *string   `json:"isbn"`
+	PageCount  *int32    `json:"pageCount"`
+	Private    *bool     `json:"private"`
+}
+
+// Apply sets the fields of book present in input. JSON null is treated the same as an omitted field. Dates are in
+// YYYY-MM-DD format and an empty string clears the date. A rating or page count of 0 clears the field.
+func (input BookJSONInput) Apply(book *data.Book) *errortree.Node {
+	v := validate.New()
+
+	if input.Title != nil {
+		book.Title = *input.Title
+	}
+	if input.Author != nil {
+		book.Author = *input.Author
+	}
+	if input.Status != nil {
+		book.Status = *input.Status
+	}
+	if input.Format != nil {
+		book.Format = *input.Format
+	}
+	if input.Location != nil {
+		book.Location = *input.Location
+	}
+	if input.Review != nil {
+		book.Review = *input.Review
+	}
+	if input.Tags != nil {
+		book.Tags = *input.Tags
+	}
+
+	if input.ISBN != nil {
+		book.ISBN = *input.ISBN
+	}
+	if input.PageCount != nil {
+		book.PageCount = *input.PageCount
+	}
+	if input.Rating != nil {
+		book.Rating = *input.Rating
+	}
+	if input.Private != nil {
+		book.Private = *input.Private
+	}
+
+	var err error
+	if input.StartDate != nil {
+		book.StartDate, err = parseJSONDate(*input.StartDate)
+		if err != nil {
+			v.Add("startDate", err)
+		}
+	}
+	if input.FinishDate != nil {
+		book.FinishDate, err = parseJSONDate(*input.FinishDate)
+		if err != nil {
+			v.Add("finishDate", err)
+		}
+	}
+
+	if v.Err() != nil {
+		return v.Err().(*errortree.Node)
+	}
+
+	return nil
+}
+
+func parseJSONDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, errors.New("must be in YYYY-MM-DD format")
+	}
+
+	return t, nil
+}
+
+// ValidationErrorsJSON converts a validation error tree into a map of attribute path to error messages suitable for a
+// JSON API response. Paths are formatted like "tags" or "items[0].name". Errors on the root are stored under "base".
+func ValidationErrorsJSON(node *errortree.Node) map[string][]string {
+	m := make(map[string][]string)
+	for _, e := range node.AllErrors() {
+		path := formatErrorPath(e.Path)
+		if path == "" {
+			path = "base"
+		}
+		m[path] = append(m[path], e.Err.Error())
+	}
+
+	return m
+}
+
+// ValidationErrorMessages converts a validation error tree into a list of messages that include the attribute path.
+func ValidationErrorMessages(node *errortree.Node) []string {
+	var messages []string
+	for _, e := range node.AllErrors() {
+		path := formatErrorPath(e.Path)
+		msg := e.Err.Error()
+		if path != "" && !strings.HasPrefix(msg, path) {
+			msg = path + " " + msg
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+func formatErrorPath(path []any) string {
+	sb := &strings.Builder{}
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(step)
+		case int:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(step))
+			sb.WriteByte(']')
+		}
+	}
+	return sb.String()
+}
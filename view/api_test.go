@@ -0,0 +1,86 @@
+package view_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/jackc/errortree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookJSONInputApply(t *testing.T) {
+	book := &data.Book{
+		Title:      "Paradise Lost",
+		Author:     "John Milton",
+		Status:     data.BookStatusFinished,
+		FinishDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Format:     "text",
+		Rating:     4,
+	}
+
+	var input view.BookJSONInput
+	err := json.Unmarshal([]byte(`{"title": "Paradise Regained", "rating": 4.5, "startDate": "2018-12-01", "tags": ["poetry"], "private": true}`), &input)
+	require.NoError(t, err)
+	require.Nil(t, input.Apply(book))
+	require.Equal(t, "Paradise Regained", book.Title)
+	require.Equal(t, "John Milton", book.Author)
+	require.Equal(t, 4.5, book.Rating)
+	require.Equal(t, time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC), book.StartDate)
+	require.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), book.FinishDate)
+	require.Equal(t, []string{"poetry"}, book.Tags)
+	require.True(t, book.Private)
+
+	input = view.BookJSONInput{}
+	err = json.Unmarshal([]byte(`{"finishDate": "", "startDate": "12/1/2018"}`), &input)
+	require.NoError(t, err)
+	verr := input.Apply(book)
+	require.NotNil(t, verr)
+	require.Len(t, verr.Get("startDate"), 1)
+	require.True(t, book.FinishDate.IsZero())
+
+	err = json.Unmarshal([]byte(`{"rating": "high"}`), &view.BookJSONInput{})
+	require.Error(t, err)
+}
+
+func TestNewBookJSON(t *testing.T) {
+	bj := view.NewBookJSON(&data.Book{ID: 1234567890123456789, Title: "Emma", FinishDate: time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)})
+	buf, err := json.Marshal(bj)
+	require.NoError(t, err)
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(buf, &m))
+	require.Equal(t, "1234567890123456789", m["id"])
+	require.Equal(t, "2019-01-02", m["finishDate"])
+	require.Nil(t, m["startDate"])
+	require.Nil(t, m["rating"])
+	require.Equal(t, []any{}, m["tags"])
+}
+
+func TestValidationErrorsJSON(t *testing.T) {
+	node := &errortree.Node{}
+	node.Add(nil, errors.New("something is wrong"))
+	node.Add([]any{"title"}, errors.New("title cannot be blank"))
+	node.Add([]any{"tags"}, errors.New("too long"))
+	node.Add([]any{"tags"}, errors.New("has a comma"))
+
+	require.Equal(t, map[string][]string{
+		"base":  {"something is wrong"},
+		"title": {"title cannot be blank"},
+		"tags":  {"too long", "has a comma"},
+	}, view.ValidationErrorsJSON(node))
+}
+
+func TestValidationErrorMessages(t *testing.T) {
+	node := &errortree.Node{}
+	node.Add([]any{"title"}, errors.New("title cannot be blank"))
+	node.Add([]any{"finishDate"}, errors.New("is required for finished books"))
+
+	require.Equal(t, []string{
+		"finishDate is required for finished books",
+		"title cannot be blank",
+	}, view.ValidationErrorMessages(node))
+}
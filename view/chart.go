@@ -0,0 +1,90 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bar is a single bar in a BarChart.
+type Bar struct {
+	Label      string
+	Value      float64
+	ValueLabel string // Displayed after the bar. The formatted Value is used if empty.
+}
+
+// BarChart is a horizontal bar chart rendered as inline SVG.
+type BarChart struct {
+	Title string // Accessible name of the chart.
+	Bars  []Bar
+}
+
+const (
+	barChartRowHeight   = 24
+	barChartBarHeight   = 16
+	barChartLabelWidth  = 160
+	barChartBarWidth    = 280
+	barChartValueWidth  = 60
+	barChartLabelLength = 24
+)
+
+// SVG renders the chart as an SVG element. Bars are scaled relative to the largest value. The chart scales to the width
+// of its container and is styled with the bar-chart CSS classes.
+func (c BarChart) SVG() template.HTML {
+	var maxValue float64
+	for _, bar := range c.Bars {
+		maxValue = max(maxValue, bar.Value)
+	}
+
+	width := barChartLabelWidth + barChartBarWidth + barChartValueWidth
+	height := max(len(c.Bars), 1) * barChartRowHeight
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, `<svg class="bar-chart" role="img" aria-label="%s" viewBox="0 0 %d %d" width="100%%" preserveAspectRatio="xMinYMin meet">`,
+		html.EscapeString(c.Title), width, height)
+
+	for i, bar := range c.Bars {
+		y := i * barChartRowHeight
+		textY := y + barChartRowHeight/2
+
+		var barWidth float64
+		if maxValue > 0 {
+			barWidth = bar.Value / maxValue * barChartBarWidth
+		}
+
+		valueLabel := bar.ValueLabel
+		if valueLabel == "" {
+			valueLabel = formatChartValue(bar.Value)
+		}
+
+		sb.WriteString(`<g class="bar">`)
+		fmt.Fprintf(sb, `<title>%s: %s</title>`, html.EscapeString(bar.Label), html.EscapeString(valueLabel))
+		fmt.Fprintf(sb, `<text class="label" x="%d" y="%d" text-anchor="end" dominant-baseline="middle">%s</text>`,
+			barChartLabelWidth-8, textY, html.EscapeString(truncateChartLabel(bar.Label)))
+		fmt.Fprintf(sb, `<rect x="%d" y="%d" width="%.1f" height="%d" rx="2"></rect>`,
+			barChartLabelWidth, y+(barChartRowHeight-barChartBarHeight)/2, barWidth, barChartBarHeight)
+		fmt.Fprintf(sb, `<text class="value" x="%.1f" y="%d" dominant-baseline="middle">%s</text>`,
+			barChartLabelWidth+barWidth+6, textY, html.EscapeString(valueLabel))
+		sb.WriteString(`</g>`)
+	}
+
+	sb.WriteString(`</svg>`)
+
+	return template.HTML(sb.String())
+}
+
+// formatChartValue formats v with at most one decimal place.
+func formatChartValue(v float64) string {
+	s := fmt.Sprintf("%.1f", v)
+	return strings.TrimSuffix(s, ".0")
+}
+
+func truncateChartLabel(s string) string {
+	if utf8.RuneCountInString(s) <= barChartLabelLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:barChartLabelLength-1]) + "…"
+}
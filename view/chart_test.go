@@ -0,0 +1,43 @@
+package view_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBarChartSVG(t *testing.T) {
+	chart := view.BarChart{
+		Title: "Top <authors>",
+		Bars: []view.Bar{
+			{Label: "Adam Zamoyski", Value: 4},
+			{Label: "A & B", Value: 2, ValueLabel: "2 books"},
+			{Label: "An author with an extremely long name", Value: 1.5},
+		},
+	}
+
+	svg := string(chart.SVG())
+	require.True(t, strings.HasPrefix(svg, `<svg class="bar-chart" role="img" aria-label="Top &lt;authors&gt;" viewBox="0 0 500 72"`))
+	require.True(t, strings.HasSuffix(svg, `</svg>`))
+	require.Equal(t, 3, strings.Count(svg, "<rect "))
+
+	// Bars are scaled relative to the largest value.
+	require.Contains(t, svg, `width="280.0"`)
+	require.Contains(t, svg, `width="140.0"`)
+	require.Contains(t, svg, `width="105.0"`)
+
+	require.Contains(t, svg, `>A &amp; B</text>`)
+	require.Contains(t, svg, `>2 books</text>`)
+	require.Contains(t, svg, `>1.5</text>`)
+	require.Contains(t, svg, `>4</text>`)
+	require.Contains(t, svg, `>An author with an extre…</text>`)
+	require.Contains(t, svg, `<title>An author with an extremely long name: 1.5</title>`)
+}
+
+func TestBarChartSVGEmpty(t *testing.T) {
+	svg := string(view.BarChart{Title: "Empty", Bars: []view.Bar{{Label: "None", Value: 0}}}.SVG())
+	require.Contains(t, svg, `width="0.0"`)
+	require.NotContains(t, svg, "NaN")
+}
@@ -0,0 +1,306 @@
+package view
+
+import (
+	"html/template"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/booklog/data"
+)
+
+// FormatRating formats a rating for use as a form value. A rating of 0 is formatted as an empty string.
+func FormatRating(rating float64) string {
+	if rating == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(rating, 'f', -1, 64)
+}
+
+// FormatPageCount formats a page count for a form field. 0 means unknown and is formatted as an empty string.
+func FormatPageCount(n int32) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(n), 10)
+}
+
+// BookStatusLabel returns the human readable name of a book status.
+func BookStatusLabel(status string) string {
+	switch status {
+	case data.BookStatusWantToRead:
+		return "Want to Read"
+	case data.BookStatusReading:
+		return "Currently Reading"
+	case data.BookStatusFinished:
+		return "Finished"
+	case data.BookStatusAbandoned:
+		return "Did Not Finish"
+	default:
+		return status
+	}
+}
+
+// BookSortLabel returns the human readable name of a book sort order.
+func BookSortLabel(sort string) string {
+	switch sort {
+	case data.BookSortFinishDate:
+		return "Finish Date"
+	case data.BookSortTitle:
+		return "Title"
+	case data.BookSortAuthor:
+		return "Author"
+	case data.BookSortInsertTime:
+		return "Recently Added"
+	default:
+		return sort
+	}
+}
+
+// ImportFieldLabel returns the human readable name of a book field a CSV column can be mapped to.
+func ImportFieldLabel(field string) string {
+	switch field {
+	case "title":
+		return "Title"
+	case "author":
+		return "Author"
+	case "status":
+		return "Status"
+	case "startDate":
+		return "Start Date"
+	case "finishDate":
+		return "Finish Date"
+	case "format":
+		return "Format"
+	case "location":
+		return "Location"
+	case "rating":
+		return "Rating"
+	case "review":
+		return "Review"
+	case "tags":
+		return "Tags"
+	case "isbn":
+		return "ISBN"
+	case "pageCount":
+		return "Pages"
+	default:
+		return field
+	}
+}
+
+// ImportDateLayoutLabel returns a description of a date layout for CSV imports using an example date.
+func ImportDateLayoutLabel(layout string) string {
+	if layout == "" {
+		return "Automatic (2019-03-15 or 3/15/2019)"
+	}
+	return time.Date(2019, 3, 15, 0, 0, 0, 0, time.UTC).Format(layout)
+}
+
+// FormatPaceDifference describes how many books ahead (positive) or behind (negative) of pace a reading goal is.
+func FormatPaceDifference(n int) string {
+	books := func(n int) string {
+		if n == 1 {
+			return "1 book"
+		}
+		return strconv.Itoa(n) + " books"
+	}
+
+	switch {
+	case n > 0:
+		return books(n) + " ahead of pace"
+	case n < 0:
+		return books(-n) + " behind pace"
+	default:
+		return "On pace"
+	}
+}
+
+// RatingStars returns rating as a string of five stars.
+func RatingStars(rating float64) string {
+	full := int(math.Floor(rating))
+	half := rating-float64(full) >= 0.5
+
+	sb := &strings.Builder{}
+	sb.WriteString(strings.Repeat("★", full))
+	empty := 5 - full
+	if half {
+		sb.WriteString("½")
+		empty--
+	}
+	sb.WriteString(strings.Repeat("☆", empty))
+
+	return sb.String()
+}
+
+// Highlight escapes s and converts the matches marked by data.HighlightStart and data.HighlightStop to <mark> elements.
+// Markers that do not form a pair are removed so the result is always balanced.
+func Highlight(s string) template.HTML {
+	s = template.HTMLEscapeString(s)
+
+	sb := &strings.Builder{}
+	var open bool
+	for {
+		i := strings.IndexAny(s, data.HighlightStart+data.HighlightStop)
+		if i < 0 {
+			break
+		}
+		sb.WriteString(s[:i])
+		if s[i:i+1] == data.HighlightStart && !open {
+			sb.WriteString("<mark>")
+			open = true
+		} else if s[i:i+1] == data.HighlightStop && open {
+			sb.WriteString("</mark>")
+			open = false
+		}
+		s = s[i+1:]
+	}
+	sb.WriteString(s)
+	if open {
+		sb.WriteString("</mark>")
+	}
+
+	return template.HTML(sb.String())
+}
+
+// OTPAuthURL marks uri as safe to use in an href if it is an otpauth:// provisioning URI. html/template would otherwise
+// replace it because it only trusts a few schemes.
+func OTPAuthURL(uri string) template.URL {
+	if !strings.HasPrefix(uri, "otpauth://") {
+		return ""
+	}
+	return template.URL(uri)
+}
+
+// TagCloudSize returns a size from 1 to 5 for a tag used count times where the most used tag is used maxCount times.
+func TagCloudSize(count, maxCount int32) int {
+	if maxCount <= 1 {
+		return 1
+	}
+	return 1 + int(math.Round(4*float64(count-1)/float64(maxCount-1)))
+}
+
+var (
+	markdownCodeRegexp   = regexp.MustCompile("`([^`]+)`")
+	markdownStrongRegexp = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	markdownEmRegexp     = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+)
+
+// RenderMarkdown converts a small subset of Markdown to HTML. The source is escaped before any markup is added so the
+// only HTML in the result is generated here.
+//
+// Supported syntax is paragraphs separated by blank lines, lists where every line starts with "- " or "* ", block
+// quotes where every line starts with ">", **strong**, *emphasis*, and `code`. Single line breaks are preserved.
+func RenderMarkdown(src string) template.HTML {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	sb := &strings.Builder{}
+	for _, block := range markdownBlocks(src) {
+		switch {
+		case allLinesHavePrefix(block, "- ", "* "):
+			sb.WriteString("<ul>\n")
+			for _, line := range block {
+				sb.WriteString("<li>")
+				sb.WriteString(renderMarkdownInline(line[2:]))
+				sb.WriteString("</li>\n")
+			}
+			sb.WriteString("</ul>\n")
+		case allLinesHavePrefix(block, ">"):
+			lines := make([]string, len(block))
+			for i, line := range block {
+				lines[i] = strings.TrimPrefix(line[1:], " ")
+			}
+			sb.WriteString("<blockquote><p>")
+			sb.WriteString(renderMarkdownLines(lines))
+			sb.WriteString("</p></blockquote>\n")
+		default:
+			sb.WriteString("<p>")
+			sb.WriteString(renderMarkdownLines(block))
+			sb.WriteString("</p>\n")
+		}
+	}
+
+	return template.HTML(sb.String())
+}
+
+// markdownBlocks splits src into blocks of trimmed non-blank lines.
+func markdownBlocks(src string) [][]string {
+	var blocks [][]string
+	var block []string
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if block != nil {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if block != nil {
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func allLinesHavePrefix(lines []string, prefixes ...string) bool {
+	for _, line := range lines {
+		found := false
+		for _, p := range prefixes {
+			if strings.HasPrefix(line, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func renderMarkdownLines(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = renderMarkdownInline(line)
+	}
+	return strings.Join(rendered, "<br>\n")
+}
+
+func renderMarkdownInline(s string) string {
+	s = template.HTMLEscapeString(s)
+
+	sb := &strings.Builder{}
+	for {
+		loc := markdownCodeRegexp.FindStringSubmatchIndex(s)
+		if loc == nil {
+			sb.WriteString(renderMarkdownEmphasis(s))
+			break
+		}
+		sb.WriteString(renderMarkdownEmphasis(s[:loc[0]]))
+		sb.WriteString("<code>")
+		sb.WriteString(s[loc[2]:loc[3]])
+		sb.WriteString("</code>")
+		s = s[loc[1]:]
+	}
+
+	return sb.String()
+}
+
+func renderMarkdownEmphasis(s string) string {
+	s = markdownStrongRegexp.ReplaceAllString(s, "<strong>$1</strong>")
+	s = markdownEmRegexp.ReplaceAllString(s, "<em>$1</em>")
+	return s
+}
+
+// formatCheckbox formats b as the value of a checkbox form field.
+func formatCheckbox(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
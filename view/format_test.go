@@ -0,0 +1,88 @@
+package view_test
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingStars(t *testing.T) {
+	for _, tt := range []struct {
+		rating   float64
+		expected string
+	}{
+		{0, "☆☆☆☆☆"},
+		{0.5, "½☆☆☆☆"},
+		{3, "★★★☆☆"},
+		{4.5, "★★★★½"},
+		{5, "★★★★★"},
+	} {
+		require.Equal(t, tt.expected, view.RatingStars(tt.rating), "rating %v", tt.rating)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		src      string
+		expected template.HTML
+	}{
+		{
+			name:     "paragraphs",
+			src:      "First line\nsecond line\n\nNext paragraph",
+			expected: "<p>First line<br>\nsecond line</p>\n<p>Next paragraph</p>\n",
+		},
+		{
+			name:     "inline",
+			src:      "**bold**, *italic*, and `*code*`",
+			expected: "<p><strong>bold</strong>, <em>italic</em>, and <code>*code*</code></p>\n",
+		},
+		{
+			name:     "list",
+			src:      "- one\n* two",
+			expected: "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n",
+		},
+		{
+			name:     "block quote",
+			src:      "> quoted\n>text",
+			expected: "<blockquote><p>quoted<br>\ntext</p></blockquote>\n",
+		},
+		{
+			name:     "escapes HTML",
+			src:      `<script>alert("x")</script> & **<b>**`,
+			expected: "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; <strong>&lt;b&gt;</strong></p>\n",
+		},
+		{
+			name:     "unmatched markers",
+			src:      "2 * 3 * 4 and ** alone",
+			expected: "<p>2 * 3 * 4 and ** alone</p>\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, view.RenderMarkdown(tt.src))
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	s := "<b>" + data.HighlightStart + "Paradise" + data.HighlightStop + " & Hell"
+	require.Equal(t, template.HTML("&lt;b&gt;<mark>Paradise</mark> &amp; Hell"), view.Highlight(s))
+
+	// Stray markers never produce unbalanced elements.
+	s = data.HighlightStop + "a" + data.HighlightStart + "b" + data.HighlightStart + "c" + data.HighlightStop + "d" + data.HighlightStart + "e"
+	require.Equal(t, template.HTML("a<mark>bc</mark>d<mark>e</mark>"), view.Highlight(s))
+}
+
+func TestOTPAuthURL(t *testing.T) {
+	require.Equal(t, template.URL("otpauth://totp/Booklog:jack?secret=ABC"), view.OTPAuthURL("otpauth://totp/Booklog:jack?secret=ABC"))
+	require.Equal(t, template.URL(""), view.OTPAuthURL("javascript:alert(1)"))
+}
+
+func TestFormatPaceDifference(t *testing.T) {
+	require.Equal(t, "2 books ahead of pace", view.FormatPaceDifference(2))
+	require.Equal(t, "1 book behind pace", view.FormatPaceDifference(-1))
+	require.Equal(t, "On pace", view.FormatPaceDifference(0))
+}
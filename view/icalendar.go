@@ -0,0 +1,88 @@
+package view
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+)
+
+// icalendarLineLength is the maximum length in octets of a content line excluding the CRLF (RFC 5545 section 3.1).
+const icalendarLineLength = 75
+
+var icalendarTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// EscapeICalendarText escapes s for use as an iCalendar TEXT value (RFC 5545 section 3.3.11).
+func EscapeICalendarText(s string) string {
+	return icalendarTextEscaper.Replace(s)
+}
+
+// FoldICalendarLine folds line into lines of at most 75 octets joined by CRLF and a space (RFC 5545 section 3.1). UTF-8
+// sequences are never split. The result does not end with a CRLF.
+func FoldICalendarLine(line string) string {
+	if len(line) <= icalendarLineLength {
+		return line
+	}
+
+	sb := &strings.Builder{}
+	limit := icalendarLineLength
+	for len(line) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		if n == 0 { // Invalid UTF-8. Split anywhere rather than loop forever.
+			n = limit
+		}
+		sb.WriteString(line[:n])
+		sb.WriteString("\r\n ")
+		line = line[n:]
+		limit = icalendarLineLength - 1 // The leading space of a continuation line counts toward the limit.
+	}
+	sb.WriteString(line)
+
+	return sb.String()
+}
+
+// WriteBookCalendar writes an iCalendar document to w with an all-day event on the finish date of each book. baseURL is
+// the scheme and host used to make links absolute. The timestamp of each event is the update time of its book as in
+// bookFeedUpdated.
+func WriteBookCalendar(w io.Writer, user *data.UserMin, books []*data.Book, baseURL string) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Booklog//Booklog//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + EscapeICalendarText(fmt.Sprintf("Books finished by %s", user.Username)),
+	}
+
+	for _, book := range books {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+BookFeedID(book.ID),
+			"DTSTAMP:"+book.UpdateTime.UTC().Format("20060102T150405Z"),
+			"DTSTART;VALUE=DATE:"+book.FinishDate.Format("20060102"),
+			"DTEND;VALUE=DATE:"+book.FinishDate.AddDate(0, 0, 1).Format("20060102"),
+			"SUMMARY:"+EscapeICalendarText(fmt.Sprintf("Finished %s", book.Title)),
+			"DESCRIPTION:"+EscapeICalendarText(bookFeedSummary(book)),
+			"URL:"+baseURL+route.BookPath(user.Username, book.ID),
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		_, err := io.WriteString(w, FoldICalendarLine(line)+"\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
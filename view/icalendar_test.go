@@ -0,0 +1,71 @@
+package view_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeICalendarText(t *testing.T) {
+	require.Equal(t, `a\\b\;c\,d\ne\nf`, view.EscapeICalendarText("a\\b;c,d\ne\r\nf"))
+}
+
+func TestFoldICalendarLine(t *testing.T) {
+	short := strings.Repeat("a", 75)
+	require.Equal(t, short, view.FoldICalendarLine(short))
+
+	folded := view.FoldICalendarLine(strings.Repeat("a", 200))
+	lines := strings.Split(folded, "\r\n")
+	require.Len(t, lines, 3)
+	require.Len(t, lines[0], 75)
+	require.Len(t, lines[1], 75)
+	require.True(t, strings.HasPrefix(lines[1], " "))
+	require.Equal(t, strings.Repeat("a", 200), strings.ReplaceAll(folded, "\r\n ", ""))
+
+	// Multi-octet characters must not be split across lines.
+	line := "SUMMARY:" + strings.Repeat("é", 100)
+	folded = view.FoldICalendarLine(line)
+	for _, l := range strings.Split(folded, "\r\n") {
+		require.LessOrEqual(t, len(l), 75)
+		require.True(t, utf8.ValidString(l), l)
+	}
+	require.Equal(t, line, strings.ReplaceAll(folded, "\r\n ", ""))
+}
+
+func TestWriteBookCalendar(t *testing.T) {
+	user := &data.UserMin{ID: 1, Username: "jack"}
+	books := []*data.Book{
+		{ID: 101, Title: "Pride, Prejudice; and More", Author: "Jane Austen", Format: "audio", FinishDate: time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), UpdateTime: time.Date(2021, 1, 2, 8, 30, 0, 0, time.UTC)},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, view.WriteBookCalendar(buf, user, books, "https://example.com"))
+	cal := buf.String()
+
+	require.True(t, strings.HasPrefix(cal, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	require.True(t, strings.HasSuffix(cal, "END:VCALENDAR\r\n"))
+	require.NotContains(t, strings.ReplaceAll(cal, "\r\n", ""), "\n")
+
+	unfolded := strings.ReplaceAll(cal, "\r\n ", "")
+	require.Contains(t, unfolded, "\r\nUID:urn:booklog:book:101\r\n")
+	require.Contains(t, unfolded, "\r\nDTSTAMP:20210102T083000Z\r\n")
+	require.Contains(t, unfolded, "\r\nDTSTART;VALUE=DATE:20201231\r\n")
+	require.Contains(t, unfolded, "\r\nDTEND;VALUE=DATE:20210101\r\n")
+	require.Contains(t, unfolded, "\r\nSUMMARY:Finished Pride\\, Prejudice\\; and More\r\n")
+	require.Contains(t, unfolded, "\r\nURL:https://example.com/users/jack/books/101\r\n")
+
+	// An empty calendar must still be valid and must not depend on the current time.
+	buf.Reset()
+	require.NoError(t, view.WriteBookCalendar(buf, user, nil, "https://example.com"))
+	require.NotContains(t, buf.String(), "VEVENT")
+	emptyCal := buf.String()
+	buf.Reset()
+	require.NoError(t, view.WriteBookCalendar(buf, user, nil, "https://example.com"))
+	require.Equal(t, emptyCal, buf.String())
+}
@@ -0,0 +1,171 @@
+package view
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/route"
+)
+
+// BookFeedID returns the Atom entry ID and RSS guid of the book with id. Book IDs are DUIDs so the ID is unique across
+// users and does not change when the book is edited or the user is renamed.
+func BookFeedID(id int64) string {
+	return fmt.Sprintf("urn:booklog:book:%d", id)
+}
+
+// bookFeedSummary returns the plain text summary of a finished book for a feed entry.
+func bookFeedSummary(book *data.Book) string {
+	return fmt.Sprintf("%s by %s. Finished %s in %s format.", book.Title, book.Author, book.FinishDate.Format("January 2, 2006"), book.Format)
+}
+
+// bookFeedUpdated returns the time the feed of books was last updated. The feed must not depend on the current time so
+// the ETag only changes when the books do. The Unix epoch is used when there are no books.
+func bookFeedUpdated(books []*data.Book) time.Time {
+	updated := time.Unix(0, 0).UTC()
+	for _, book := range books {
+		if book.UpdateTime.After(updated) {
+			updated = book.UpdateTime
+		}
+	}
+	return updated.UTC()
+}
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  AtomPerson  `xml:"author"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []AtomLink     `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// NewAtomFeed returns an Atom feed of the finished books of user. baseURL is the scheme and host used to make links
+// absolute. books should be ordered by most recently finished.
+func NewAtomFeed(user *data.UserMin, books []*data.Book, baseURL string) *AtomFeed {
+	feed := &AtomFeed{
+		ID:      baseURL + route.BooksAtomPath(user.Username),
+		Title:   fmt.Sprintf("Books finished by %s", user.Username),
+		Updated: bookFeedUpdated(books).Format(time.RFC3339),
+		Author:  AtomPerson{Name: user.Username},
+		Links: []AtomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: baseURL + route.BooksAtomPath(user.Username)},
+			{Rel: "alternate", Type: "text/html", Href: baseURL + route.UserHomePath(user.Username)},
+		},
+		Entries: make([]AtomEntry, 0, len(books)),
+	}
+
+	for _, book := range books {
+		entry := AtomEntry{
+			ID:         BookFeedID(book.ID),
+			Title:      book.Title,
+			Updated:    book.UpdateTime.UTC().Format(time.RFC3339),
+			Published:  book.FinishDate.Format(time.RFC3339),
+			Links:      []AtomLink{{Rel: "alternate", Type: "text/html", Href: baseURL + route.BookPath(user.Username, book.ID)}},
+			Summary:    bookFeedSummary(book),
+			Categories: []AtomCategory{{Term: book.Format}},
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+type RSSFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []RSSItem `xml:"item"`
+}
+
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// NewRSSFeed returns an RSS 2.0 feed of the finished books of user. baseURL is the scheme and host used to make links
+// absolute. books should be ordered by most recently finished.
+func NewRSSFeed(user *data.UserMin, books []*data.Book, baseURL string) *RSSFeed {
+	feed := &RSSFeed{
+		Version: "2.0",
+		Channel: RSSChannel{
+			Title:         fmt.Sprintf("Books finished by %s", user.Username),
+			Link:          baseURL + route.UserHomePath(user.Username),
+			Description:   fmt.Sprintf("Books recently finished by %s on Booklog.", user.Username),
+			LastBuildDate: bookFeedUpdated(books).Format(time.RFC1123Z),
+			Items:         make([]RSSItem, 0, len(books)),
+		},
+	}
+
+	for _, book := range books {
+		feed.Channel.Items = append(feed.Channel.Items, RSSItem{
+			Title:       book.Title,
+			Link:        baseURL + route.BookPath(user.Username, book.ID),
+			Description: bookFeedSummary(book),
+			Category:    book.Format,
+			GUID:        RSSGUID{Value: BookFeedID(book.ID)},
+			PubDate:     book.FinishDate.Format(time.RFC1123Z),
+		})
+	}
+
+	return feed
+}
+
+// WriteXML writes v to w as an XML document.
+func WriteXML(w io.Writer, v any) error {
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(v)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
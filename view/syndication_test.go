@@ -0,0 +1,62 @@
+package view_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomFeed(t *testing.T) {
+	user := &data.UserMin{ID: 1, Username: "jack"}
+	books := []*data.Book{
+		{ID: 101, Title: "Pride & Prejudice", Author: "Jane Austen", Format: "audio", FinishDate: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), UpdateTime: time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)},
+		{ID: 102, Title: "Emma", Author: "Jane Austen", Format: "text", FinishDate: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), UpdateTime: time.Date(2020, 4, 1, 8, 0, 0, 0, time.UTC)},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, view.WriteXML(buf, view.NewAtomFeed(user, books, "https://example.com")))
+	require.Contains(t, buf.String(), "Pride &amp; Prejudice")
+
+	var feed view.AtomFeed
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &feed))
+	require.Equal(t, "https://example.com/users/jack/books.atom", feed.ID)
+	require.Equal(t, "2020-04-01T08:00:00Z", feed.Updated)
+	require.Len(t, feed.Entries, 2)
+	require.Equal(t, "urn:booklog:book:101", feed.Entries[0].ID)
+	require.Equal(t, "2020-03-02T08:00:00Z", feed.Entries[0].Updated)
+	require.Equal(t, "https://example.com/users/jack/books/101", feed.Entries[0].Links[0].Href)
+	require.Equal(t, "Pride & Prejudice by Jane Austen. Finished March 1, 2020 in audio format.", feed.Entries[0].Summary)
+	require.Equal(t, "audio", feed.Entries[0].Categories[0].Term)
+
+	// An empty feed must still be valid and must not depend on the current time.
+	buf.Reset()
+	require.NoError(t, view.WriteXML(buf, view.NewAtomFeed(user, nil, "https://example.com")))
+	var emptyFeed view.AtomFeed
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &emptyFeed))
+	require.Equal(t, "1970-01-01T00:00:00Z", emptyFeed.Updated)
+	require.Empty(t, emptyFeed.Entries)
+}
+
+func TestRSSFeed(t *testing.T) {
+	user := &data.UserMin{ID: 1, Username: "jack"}
+	books := []*data.Book{
+		{ID: 101, Title: "Emma", Author: "Jane Austen", Format: "text", FinishDate: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), UpdateTime: time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, view.WriteXML(buf, view.NewRSSFeed(user, books, "https://example.com")))
+	require.Contains(t, buf.String(), `<guid isPermaLink="false">urn:booklog:book:101</guid>`)
+
+	var feed view.RSSFeed
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &feed))
+	require.Equal(t, "2.0", feed.Version)
+	require.Equal(t, "Mon, 02 Mar 2020 08:00:00 +0000", feed.Channel.LastBuildDate)
+	require.Len(t, feed.Channel.Items, 1)
+	require.Equal(t, "Sun, 01 Mar 2020 00:00:00 +0000", feed.Channel.Items[0].PubDate)
+	require.Equal(t, "https://example.com/users/jack/books/101", feed.Channel.Items[0].Link)
+}
@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"os"
 
+	"github.com/jackc/booklog/data"
 	"github.com/jackc/booklog/route"
 	"github.com/jackc/cachet"
 )
@@ -70,18 +71,74 @@ func NewHTMLTemplateRenderer(templatePath string, assetMap map[string]string, li
 	funcMap := template.FuncMap{
 		"UserHomePath":            route.UserHomePath,
 		"BooksPath":               route.BooksPath,
+		"BookImportPath":          route.BookImportPath,
+		"BookImportCommitPath":    route.BookImportCommitPath,
+		"BookImportMappingPath":   route.BookImportMappingPath,
+		"ImportProfilePath":       route.ImportProfilePath,
+		"ImportFields":            func() []string { return data.ImportFields },
+		"ImportFieldLabel":        ImportFieldLabel,
+		"ImportDateLayouts":       func() []string { return data.ImportDateLayouts },
+		"ImportDateLayoutLabel":   ImportDateLayoutLabel,
+		"APITokensPath":           route.APITokensPath,
+		"APITokenPath":            route.APITokenPath,
+		"BookShelfPath":           route.BookShelfPath,
+		"BookSearchPath":          route.BookSearchPath,
 		"BookPath":                route.BookPath,
 		"BookConfirmDeletePath":   route.BookConfirmDeletePath,
 		"EditBookPath":            route.EditBookPath,
+		"StartReadingBookPath":    route.StartReadingBookPath,
+		"FinishBookPath":          route.FinishBookPath,
+		"AbandonBookPath":         route.AbandonBookPath,
 		"NewBookPath":             route.NewBookPath,
 		"ImportBookCSVFormPath":   route.ImportBookCSVFormPath,
 		"ImportBookCSVPath":       route.ImportBookCSVPath,
 		"ExportBookCSVPath":       route.ExportBookCSVPath,
+		"AccountBackupPath":       route.AccountBackupPath,
+		"AccountExportJSONPath":   route.AccountExportJSONPath,
+		"AccountRestorePath":      route.AccountRestorePath,
+		"TagsPath":                route.TagsPath,
+		"UserStatsPath":           route.UserStatsPath,
+		"YearReviewPath":          route.YearReviewPath,
+		"YearReviewSharePath":     route.YearReviewSharePath,
+		"SharedYearReviewPath":    route.SharedYearReviewPath,
+		"UserSettingsPath":        route.UserSettingsPath,
+		"UserPasswordPath":        route.UserPasswordPath,
+		"UserUsernamePath":        route.UserUsernamePath,
+		"UserEmailPath":           route.UserEmailPath,
+		"UserTwoFactorPath":       route.UserTwoFactorPath,
+		"UserRecoveryCodesPath":   route.UserRecoveryCodesPath,
+		"UserSessionsPath":        route.UserSessionsPath,
+		"UserSessionPath":         route.UserSessionPath,
+		"ReadingGoalsPath":        route.ReadingGoalsPath,
+		"ReadingGoalPath":         route.ReadingGoalPath,
+		"FollowPath":              route.FollowPath,
+		"FeedPath":                route.FeedPath,
+		"BooksAtomPath":           route.BooksAtomPath,
+		"BooksRSSPath":            route.BooksRSSPath,
+		"BooksCalendarPath":       route.BooksCalendarPath,
+		"CalendarTokenPath":       route.CalendarTokenPath,
+		"TagPath":                 route.TagPath,
 		"NewUserRegistrationPath": route.NewUserRegistrationPath,
 		"UserRegistrationPath":    route.UserRegistrationPath,
 		"NewLoginPath":            route.NewLoginPath,
 		"LoginPath":               route.LoginPath,
+		"LoginTwoFactorPath":      route.LoginTwoFactorPath,
+		"NewPasswordResetPath":    route.NewPasswordResetPath,
+		"PasswordResetPath":       route.PasswordResetPath,
+		"PasswordResetTokenPath":  route.PasswordResetTokenPath,
 		"LogoutPath":              route.LogoutPath,
+		"BookStatuses":            func() []string { return data.BookStatuses },
+		"BookStatusLabel":         BookStatusLabel,
+		"BookSorts":               func() []string { return data.BookSorts },
+		"BookSortLabel":           BookSortLabel,
+		"BooksPerPageOptions":     func() []int32 { return data.BooksPerPageOptions },
+		"Highlight":               Highlight,
+		"RatingStars":             RatingStars,
+		"FormatPaceDifference":    FormatPaceDifference,
+		"TagCloudSize":            TagCloudSize,
+		"RenderMarkdown":          RenderMarkdown,
+		"list":                    func(items ...string) []string { return items },
+		"dict":                    dict,
 	}
 
 	if assetMap == nil {
@@ -128,6 +185,24 @@ func NewHTMLTemplateRenderer(templatePath string, assetMap map[string]string, li
 	}
 }
 
+// dict builds a map from alternating keys and values. It allows passing multiple values to a nested template.
+func dict(keysAndValues ...any) (map[string]any, error) {
+	if len(keysAndValues)%2 != 0 {
+		return nil, fmt.Errorf("dict requires an even number of arguments")
+	}
+
+	m := make(map[string]any, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings")
+		}
+		m[key] = keysAndValues[i+1]
+	}
+
+	return m, nil
+}
+
 func (htr *HTMLTemplateRenderer) ExecuteTemplate(wr io.Writer, name string, data any) error {
 	rootTemplate, err := htr.cache.Get()
 	if err != nil {
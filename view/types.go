@@ -3,6 +3,10 @@ package view
 import (
 	"errors"
 	"html/template"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/booklog/data"
@@ -15,6 +19,10 @@ type BaseViewArgs struct {
 	CurrentUser *data.UserMin
 	PathUser    *data.UserMin
 	DevMode     bool
+
+	// ReadOnly is true when the current user is visiting the pages of another user. Links to pages only the path user can
+	// use are hidden.
+	ReadOnly bool
 }
 
 type YearBookList struct {
@@ -22,12 +30,105 @@ type YearBookList struct {
 	Books []*data.Book
 }
 
+// GroupBooksByYear groups books by the year they were finished. books must be ordered by finish date.
+func GroupBooksByYear(books []*data.Book) []*YearBookList {
+	return groupBooks(books,
+		func(book *data.Book) int { return book.FinishDate.Year() },
+		func(year int, books []*data.Book) *YearBookList { return &YearBookList{Year: year, Books: books} },
+	)
+}
+
+type MonthBookList struct {
+	Month time.Time // First day of the month.
+	Books []*data.Book
+}
+
+// GroupBooksByMonth groups books by the month they were finished. books must be ordered by finish date.
+func GroupBooksByMonth(books []*data.Book) []*MonthBookList {
+	return groupBooks(books,
+		func(book *data.Book) time.Time {
+			return time.Date(book.FinishDate.Year(), book.FinishDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+		},
+		func(month time.Time, books []*data.Book) *MonthBookList {
+			return &MonthBookList{Month: month, Books: books}
+		},
+	)
+}
+
+// groupBooks groups consecutive books with the same key. newList is called with the key and books of each group.
+func groupBooks[K comparable, L any](books []*data.Book, key func(*data.Book) K, newList func(K, []*data.Book) L) []L {
+	lists := make([]L, 0)
+
+	for i := 0; i < len(books); {
+		k := key(books[i])
+		j := i + 1
+		for j < len(books) && key(books[j]) == k {
+			j++
+		}
+		lists = append(lists, newList(k, books[i:j:j]))
+		i = j
+	}
+
+	return lists
+}
+
+type UserSettingsForm struct {
+	TimeZone        string
+	Visibility      string
+	DefaultBookSort string
+	BooksPerPage    string
+}
+
+// NewUserSettingsForm returns a UserSettingsForm populated from user and prefs.
+func NewUserSettingsForm(user *data.UserMin, prefs *data.UserPreferences) UserSettingsForm {
+	return UserSettingsForm{
+		TimeZone:        user.TimeZone,
+		Visibility:      user.Visibility,
+		DefaultBookSort: prefs.DefaultBookSort,
+		BooksPerPage:    strconv.FormatInt(int64(prefs.BooksPerPage), 10),
+	}
+}
+
+// Preferences returns the display preferences in the form. An invalid BooksPerPage is returned as 0 so it fails
+// validation.
+func (f UserSettingsForm) Preferences() data.UserPreferences {
+	booksPerPage, _ := strconv.ParseInt(strings.TrimSpace(f.BooksPerPage), 10, 32)
+	return data.UserPreferences{DefaultBookSort: f.DefaultBookSort, BooksPerPage: int32(booksPerPage)}
+}
+
 type BookEditForm struct {
 	Title      string
 	Author     string
+	Status     string
+	StartDate  string
 	FinishDate string
 	Format     string
 	Location   string
+	Rating     string
+	Review     string
+	Tags       string
+	ISBN       string
+	PageCount  string
+	Private    string // Any non-empty value means private. Checkboxes are omitted from the form when not checked.
+}
+
+// NewBookEditForm returns a BookEditForm populated from book.
+func NewBookEditForm(book *data.Book) BookEditForm {
+	return BookEditForm{
+		Title:      book.Title,
+		Author:     book.Author,
+		Status:     book.Status,
+		StartDate:  FormatDate(book.StartDate),
+		FinishDate: FormatDate(book.FinishDate),
+		Format:     book.Format,
+		Location:   book.Location,
+		Rating:     FormatRating(book.Rating),
+		Review:     book.Review,
+		Tags:       strings.Join(book.Tags, ", "),
+		ISBN:       book.ISBN,
+		PageCount:  FormatPageCount(book.PageCount),
+		Private:    formatCheckbox(book.Private),
+	}
 }
 
 func (f BookEditForm) Parse() (data.Book, *errortree.Node) {
@@ -35,26 +136,182 @@ func (f BookEditForm) Parse() (data.Book, *errortree.Node) {
 	book := data.Book{
 		Title:    f.Title,
 		Author:   f.Author,
+		Status:   f.Status,
 		Format:   f.Format,
 		Location: f.Location,
+		Review:   f.Review,
+		Tags:     data.ParseTags(f.Tags),
+		ISBN:     f.ISBN,
+		Private:  f.Private != "",
 	}
 	v := validate.New()
 
+	book.StartDate, err = parseDate(f.StartDate)
+	if err != nil {
+		v.Add("startDate", err)
+	}
+
+	book.FinishDate, err = parseDate(f.FinishDate)
+	if err != nil {
+		v.Add("finishDate", err)
+	}
+
+	if strings.TrimSpace(f.Rating) != "" {
+		book.Rating, err = strconv.ParseFloat(strings.TrimSpace(f.Rating), 64)
+		if err != nil {
+			v.Add("rating", errors.New("is not a number"))
+		}
+	}
+
+	if strings.TrimSpace(f.PageCount) != "" {
+		n, err := strconv.ParseInt(strings.TrimSpace(f.PageCount), 10, 32)
+		if err != nil {
+			v.Add("pageCount", errors.New("is not a whole number"))
+		}
+		book.PageCount = int32(n)
+	}
+
+	if v.Err() != nil {
+		return book, v.Err().(*errortree.Node)
+	}
+
+	return book, nil
+}
+
+// parseDate parses s in any of the date formats accepted from forms and CSV files. An empty string is parsed as the zero
+// time.
+func parseDate(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+
 	dateFormats := []string{"2006-01-02", "1/2/2006", "1/2/06"}
 
 	for _, df := range dateFormats {
-		book.FinishDate, err = time.Parse(df, f.FinishDate)
+		t, err := time.Parse(df, s)
 		if err == nil {
-			break
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("is not a date")
+}
+
+// FormatDate formats t as YYYY-MM-DD for date inputs and CSV files. The zero time is formatted as an empty string.
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// BookIndexParams are the query parameters for filtering, sorting, and paginating the book index.
+type BookIndexParams struct {
+	Format   string
+	Author   string
+	Location string
+	FromYear string
+	ToYear   string
+	Sort     string
+	After    string
+}
+
+func (p BookIndexParams) Parse() (data.BookFilter, string, *errortree.Node) {
+	filter := data.BookFilter{
+		Format:   strings.TrimSpace(p.Format),
+		Author:   strings.TrimSpace(p.Author),
+		Location: strings.TrimSpace(p.Location),
+	}
+	v := validate.New()
+
+	filter.FromYear = parseFilterYear(v, "fromYear", p.FromYear)
+	filter.ToYear = parseFilterYear(v, "toYear", p.ToYear)
+
+	sort := p.Sort
+	if sort == "" {
+		sort = data.BookSortFinishDate
+	}
+	if !slices.Contains(data.BookSorts, sort) {
+		v.Add("sort", errors.New("is not a valid sort"))
+	}
+
+	if v.Err() != nil {
+		return filter, sort, v.Err().(*errortree.Node)
+	}
+
+	return filter, sort, nil
+}
+
+// parseFilterYear parses s as a year for filtering by finish date. An empty string is parsed as 0 which means no filter.
+// Years outside of 1 to 9999 are rejected because they cannot be a date in PostgreSQL.
+func parseFilterYear(v *validate.Validator, attr, s string) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+
+	year, err := strconv.Atoi(s)
+	if err != nil {
+		v.Add(attr, errors.New("is not a year"))
+		return 0
+	}
+	if year < 1 || year > 9999 {
+		v.Add(attr, errors.New("must be from 1 to 9999"))
+		return 0
+	}
+
+	return year
+}
+
+// IsFiltered returns true if any filter is set.
+func (p BookIndexParams) IsFiltered() bool {
+	return p.Format != "" || p.Author != "" || p.Location != "" || p.FromYear != "" || p.ToYear != ""
+}
+
+// Query returns p encoded as a URL query string with After replaced by after. Empty parameters are omitted.
+func (p BookIndexParams) Query(after string) string {
+	values := url.Values{}
+	for _, kv := range [][2]string{
+		{"format", p.Format},
+		{"author", p.Author},
+		{"location", p.Location},
+		{"fromYear", p.FromYear},
+		{"toYear", p.ToYear},
+		{"sort", p.Sort},
+		{"after", after},
+	} {
+		if kv[1] != "" {
+			values.Set(kv[0], kv[1])
 		}
 	}
+	return values.Encode()
+}
+
+type ReadingGoalForm struct {
+	Year   string
+	Format string // Empty means books of any format.
+	Target string
+}
+
+func (f ReadingGoalForm) Parse() (data.ReadingGoal, *errortree.Node) {
+	goal := data.ReadingGoal{Format: f.Format}
+	v := validate.New()
+
+	year, err := strconv.ParseInt(strings.TrimSpace(f.Year), 10, 32)
 	if err != nil {
-		v.Add("finishDate", errors.New("is not a date"))
+		v.Add("year", errors.New("is not a year"))
 	}
+	goal.Year = int32(year)
+
+	target, err := strconv.ParseInt(strings.TrimSpace(f.Target), 10, 32)
+	if err != nil {
+		v.Add("target", errors.New("is not a whole number"))
+	}
+	goal.Target = int32(target)
 
 	if v.Err() != nil {
-		return book, v.Err().(*errortree.Node)
+		return goal, v.Err().(*errortree.Node)
 	}
 
-	return book, nil
+	return goal, nil
 }
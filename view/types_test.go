@@ -0,0 +1,64 @@
+package view_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/booklog/data"
+	"github.com/jackc/booklog/view"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupBooksByMonth(t *testing.T) {
+	require.Empty(t, view.GroupBooksByMonth(nil))
+
+	books := []*data.Book{
+		{ID: 1, FinishDate: time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, FinishDate: time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{ID: 3, FinishDate: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 4, FinishDate: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	lists := view.GroupBooksByMonth(books)
+	require.Len(t, lists, 3)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), lists[0].Month)
+	require.Equal(t, books[0:2], lists[0].Books)
+	require.Equal(t, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), lists[1].Month)
+	require.Equal(t, books[2:3], lists[1].Books)
+	require.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), lists[2].Month)
+
+	years := view.GroupBooksByYear(books)
+	require.Len(t, years, 2)
+	require.Equal(t, 2020, years[0].Year)
+	require.Equal(t, books[0:3], years[0].Books)
+	require.Equal(t, 2021, years[1].Year)
+}
+
+func TestBookEditFormPrivate(t *testing.T) {
+	form := view.NewBookEditForm(&data.Book{Title: "Emma", Private: true})
+	require.Equal(t, "true", form.Private)
+
+	book, verr := form.Parse()
+	require.Nil(t, verr)
+	require.True(t, book.Private)
+
+	// An unchecked checkbox is omitted from the submitted form.
+	form.Private = ""
+	book, verr = form.Parse()
+	require.Nil(t, verr)
+	require.False(t, book.Private)
+}
+
+func TestBookIndexParamsParseYears(t *testing.T) {
+	filter, _, verr := view.BookIndexParams{FromYear: " 2019 ", ToYear: "2020"}.Parse()
+	require.Nil(t, verr)
+	require.Equal(t, 2019, filter.FromYear)
+	require.Equal(t, 2020, filter.ToYear)
+
+	for _, year := range []string{"0", "-1", "10000", "99999999", "2147483647", "abc"} {
+		_, _, verr = view.BookIndexParams{FromYear: year, ToYear: year}.Parse()
+		require.NotNil(t, verr, year)
+		require.Len(t, verr.Get("fromYear"), 1, year)
+		require.Len(t, verr.Get("toYear"), 1, year)
+	}
+}